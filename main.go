@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -8,22 +9,37 @@ import (
 	"os"
 	"shcomp2/pkg/generators"
 	"shcomp2/pkg/lib"
+	"shcomp2/pkg/spec"
 )
 
 type Options struct {
 	args        []string
 	checkReload bool
+	shell       string
+	format      string
+	emit        string
+	debug       bool
+	logLevel    string
 }
 
 func main() {
-	logCleanup := lib.SetupLogger()
-	defer logCleanup()
-
 	options := Options{}
 	flag.BoolVar(&options.checkReload, "reload-check", false, "")
+	flag.StringVar(&options.shell, "shell", "", "shell to generate completions for (bash, zsh, fish)")
+	flag.StringVar(&options.format, "format", "", "spec format (dsl, json, yaml), inferred from the file extension by default")
+	flag.StringVar(&options.emit, "emit", "shell", "what to print (shell, json), json is the resolved spec instead of a completion script")
+	flag.BoolVar(&options.debug, "debug", false, "log to $XDG_STATE_HOME/shcomp2/shcomp2.log and compile scripts that log there too")
+	flag.StringVar(&options.logLevel, "log-level", "debug", "level of -debug logs (trace, debug, info, warn, error)")
 	flag.Parse()
 	options.args = flag.Args()
+
+	logCleanup, err := lib.SetupLogger(options.debug, options.logLevel)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
 	exitCode := entry(os.Stdin, os.Stdout, os.Stderr, options)
+	logCleanup()
 	os.Exit(exitCode)
 }
 
@@ -35,17 +51,35 @@ func entry(stdin io.Reader, stdout io.Writer, stderr io.Writer, options Options)
 			return 0
 		}
 	} else {
-		err := HandleCompileShell(options.args[0], stdin, stdout, stderr)
-		if err != nil {
-			_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+		if len(options.args) == 0 {
+			_, _ = fmt.Fprintf(stderr, "error: must provide - or spec files as arguments\n")
 			return 1
-		} else {
-			return 0
 		}
+		code = 0
+		for _, infile := range options.args {
+			err := HandleCompileShell(infile, options, stdin, stdout, stderr)
+			if err != nil {
+				printError(stderr, infile, err)
+				code = 1
+			}
+		}
+		return code
 	}
 }
 
-func HandleCompileShell(infile string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+func HandleCompileShell(infile string, options Options, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	var cli lib.Cli
+	var err error
+	format := options.format
+	if format == "" {
+		format = spec.FormatOf(infile)
+	}
+	switch format {
+	case spec.FormatDSL, spec.FormatJSON, spec.FormatYAML:
+	default:
+		return fmt.Errorf("unknown format %q, expected %s, %s or %s", format, spec.FormatDSL, spec.FormatJSON, spec.FormatYAML)
+	}
+
 	if infile == "-" {
 		content, err := io.ReadAll(stdin)
 		if err != nil {
@@ -56,28 +90,83 @@ func HandleCompileShell(infile string, stdin io.Reader, stdout io.Writer, stderr
 			return errors.New("stdin is empty but infile is - ")
 		}
 
-		cli, err := lib.ParseOperations(string(content))
+		if format == spec.FormatDSL {
+			cli, err = lib.ParseOperations(string(content))
+		} else {
+			cli, err = spec.ParseDocumentBytes(content, format)
+		}
 		if err != nil {
 			return err
 		}
-
-		if cli.Config.AutogenLang == "py" {
-			cli = generators.GeneratePythonOperations(cli)
+	} else {
+		if format == spec.FormatDSL {
+			cli, err = lib.ParseOperationsFile(infile)
+		} else {
+			cli, err = spec.ParseDocumentFile(infile, format)
 		}
-
-		compiledShell, err := lib.CompileCli(cli)
 		if err != nil {
-			_, _ = fmt.Fprintf(stderr, "%s\n", err)
-			return errors.New("unable to compile shell")
+			return err
 		}
-		err = lib.CommitCli(cli, compiledShell, stdout)
-		if err != nil {
-			_, _ = fmt.Fprintf(stderr, "%s\n", err)
-			return errors.New("unable to commit shell")
+	}
+
+	if options.shell != "" {
+		// keep the override in operations so reloads compile for the same shell
+		cli.Config.Shell = options.shell
+		cli.Operations = append(cli.Operations, "cfg shell="+options.shell)
+	}
+	if options.debug {
+		// kept in operations too so reloaded scripts still log
+		cli.Config.LogLevel = options.logLevel
+		cli.Operations = append(cli.Operations, "cfg log_level="+options.logLevel)
+	}
+
+	cli, err = generators.Generate(cli)
+	if err != nil {
+		return err
+	}
+
+	switch options.emit {
+	case "", "shell":
+	case "json":
+		return emitJSON(cli, stdout)
+	default:
+		return fmt.Errorf("unknown emit %q, expected shell or json", options.emit)
+	}
+
+	compiledShell, err := lib.CompileCli(cli)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return errors.New("unable to compile shell")
+	}
+	err = lib.CommitCli(cli, compiledShell, stdout)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err)
+		return errors.New("unable to commit shell")
+	}
+	return nil
+}
+
+// emitJSON prints the resolved spec, one document per spec file
+func emitJSON(cli lib.Cli, stdout io.Writer) error {
+	content, err := json.MarshalIndent(cli, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%s\n", content)
+	return err
+}
+
+// printError prints parse errors compiler-style as infile:line:column: msg
+func printError(stderr io.Writer, infile string, err error) {
+	var parseErrors lib.ParseErrors
+	if errors.As(err, &parseErrors) {
+		if infile == "-" {
+			infile = "<stdin>"
+		}
+		for _, parseError := range parseErrors {
+			_, _ = fmt.Fprintf(stderr, "%s:%v\n", infile, parseError)
 		}
-		return nil
 	} else {
-		_, _ = fmt.Fprintf(stderr, "must provide - as first argument\n")
-		return errors.New("infile as other files not implemented yet")
+		_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
 	}
 }
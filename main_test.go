@@ -4,14 +4,17 @@ import (
 	"bytes"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/suite"
 	"io"
 	"os"
+	"os/exec"
 	"path"
 	"shcomp2/pkg/lib"
 	"shcomp2/pkg/testutil"
+	"strings"
 	"testing"
 	"time"
 )
@@ -137,6 +140,45 @@ func (suite *Suite) TestCases() {
 		suite.RequireComplete(shell, "testcli --tree ", "c8 c9 c10")
 	})
 
+	suite.Run("options with values that can't be completed", func() {
+		shell := testutil.ParseOperations(`
+			cfg cli_name=testcli
+			opt "--name" --complete=value
+			opt "--flag"
+		`)
+		suite.RequireComplete(shell, "testcli ", "--name --flag")
+		suite.RequireComplete(shell, "testcli --name ", "")
+		suite.RequireComplete(shell, "testcli --name bob ", "--flag")
+		suite.RequireComplete(shell, "testcli --flag ", "--name")
+	})
+
+	suite.Run("words are split like the shell splits them", func() {
+		shell := testutil.ParseOperations(`
+			cfg cli_name=testcli
+			opt "--host" --choices="db:5432 web:80"
+			pos --choices="one two"
+			pos --choices="three four"
+		`)
+		suite.RequireComplete(shell, `testcli "a b" `, "three four --host")
+		suite.RequireComplete(shell, `testcli 'a b' t`, "three")
+		suite.RequireComplete(shell, `testcli a\ b `, "three four --host")
+		suite.RequireComplete(shell, `testcli "a \" b" `, "three four --host")
+		suite.RequireComplete(shell, `testcli user@host `, "three four --host")
+		suite.RequireComplete(shell, `testcli ü `, "three four --host")
+		// readline only inserts after the last COMP_WORDBREAKS character of the word
+		suite.RequireCompleteInserted(shell, `testcli --host db:`, "testcli --host db:5432")
+		suite.RequireCompleteInserted(shell, `testcli --host=w`, "testcli --host=web:80")
+		suite.RequireCompleteInserted(shell, `testcli --host=db:`, "testcli --host=db:5432")
+		suite.RequireCompleteInserted(shell, `testcli --host d`, "testcli --host db:5432")
+		suite.RequireCompleteInserted(shell, `testcli --host "db:`, `testcli --host "db:5432`)
+		// the current and previous word are compared without their quotes and escapes
+		suite.RequireComplete(shell, `testcli "o`, "one")
+		suite.RequireComplete(shell, `testcli 'tw`, "two")
+		suite.RequireComplete(shell, `testcli t\w`, "two")
+		suite.RequireComplete(shell, `testcli --host "d`, "db:5432")
+		suite.RequireComplete(shell, `testcli "--host" w`, "web:80")
+	})
+
 	suite.Run("order of operations is always the same", func() {
 		shell := testutil.ParseOperations(`
 			cfg cli_name=testcli
@@ -310,9 +352,112 @@ func (suite *Suite) TestCases() {
 		suite.RequireComplete(shell, "testcli -aaa", "-aaab")
 		suite.RequireComplete(shell, "testcli -ab", "-aba")
 	})
+	suite.Run("descriptions", func() {
+		shell := testutil.ParseOperations(`
+			cfg cli_name=testcli
+			opt --verbose|-v --help="Print more output"
+			opt --mode --choices="fast slow" --desc=fast="Go fast"
+			psr run --help="Run a task"
+			psr list
+			pos -p=list --choices="all mine" --desc=all="Every task" --desc=mine="My tasks"
+		`)
+		suite.RequireComplete(shell, "testcli -", "--verbose -- Print more output -v        -- Print more output --mode")
+		suite.RequireComplete(shell, "testcli --mo", "--mode")
+		suite.RequireComplete(shell, "testcli --mode ", "fast -- Go fast slow")
+		suite.RequireComplete(shell, "testcli --mode f", "fast")
+		suite.RequireComplete(shell, "testcli l", "list")
+		suite.RequireComplete(shell, "testcli list ", "all  -- Every task mine -- My tasks")
+	})
 	suite.Run("allow closures through comments", func() {})
 }
 
+func (suite *Suite) TestShellGolden() {
+	tests := []struct {
+		name       string
+		operations string
+	}{
+		{"options", `
+			cfg cli_name=testcli
+			opt --help|-help|-h
+			opt -v --nargs=3
+			opt "--key" --choices="val1 val2"
+			opt "--tree" --closure="__testcli_completer"
+			opt --color --choices="auto never" --value-style=equals
+			opt --level --choices="1 2" --value-style=space
+			opt --name --complete=value
+		`},
+		{"positionals", `
+			cfg cli_name=testcli
+			pos --choices="c1 c2 c3"
+			pos --choices="one two three" --nargs=3 --nargs-unique
+			pos --closure="__testcli_completer" --nargs=*
+			opt -h
+		`},
+		{"subparsers", `
+			cfg cli_name=testcli
+			opt "--help"
+			pos -p="sub-cmd" --choices="c1 c2 c3"
+			opt -p="sub-cmd" "--awesome"
+			opt -p="sub-b" --help-b
+			opt -p="sub-b.sub-c" --help-c
+			psr standalone
+		`},
+		{"descriptions", `
+			cfg cli_name=testcli
+			opt --verbose|-v --help="Print more output"
+			opt --mode --choices="fast slow" --desc=fast="Go fast"
+			psr run --help="Run a task"
+			pos -p=run --choices="all mine" --desc=all="Every task" --help="Tasks to run"
+		`},
+		{"paths", `
+			cfg cli_name=testcli
+			opt --config --complete=file:*.json,*.yaml
+			opt --out --complete=dir
+			pos --complete=file
+		`},
+		{"groups", `
+			cfg cli_name=testcli
+			grp flavor --exclusive
+			opt --vanilla --group=flavor
+			opt --chocolate|-c --group=flavor
+			opt --sprinkles --nargs=3 --group=flavor
+		`},
+		{"closures", `
+			cfg cli_name=testcli
+			cfg include_source=/usr/share/testcli/lib.sh
+			cfg merge_single_opt=1
+			pos --closure="__testcli_pos_1_completer"
+			opt -a
+			opt -b
+		`},
+	}
+
+	// a timestamp from the environment would be the only difference
+	suite.T().Setenv("SOURCE_DATE_EPOCH", "")
+	for _, shellName := range []string{lib.ShellBash, lib.ShellZsh, lib.ShellFish} {
+		for _, tt := range tests {
+			suite.Run(shellName+" "+tt.name, func() {
+				shell := testutil.ParseOperations("cfg shell=" + shellName + "\n" + lib.Dedent(tt.operations))
+				suite.RequireGolden(path.Join("testdata", shellName, tt.name+"."+shellName), shell)
+				if _, err := exec.LookPath(shellName); err == nil {
+					out, err := exec.Command(shellName, "-n", "-c", shell).CombinedOutput()
+					suite.Require().NoError(err, string(out))
+				}
+			})
+		}
+	}
+}
+
+func (suite *Suite) TestMainShellFlag() {
+	result := mainWithArgs(Options{args: []string{"-"}, shell: "zsh"}, lib.Dedent(`
+		cfg cli_name=testcli
+		opt --help
+	`))
+	suite.Require().Equal(0, result.code, result.stderr)
+	suite.Require().Contains(result.stdout, "#compdef testcli")
+	suite.Require().Contains(result.stdout, "# cfg shell=zsh")
+}
+
 func (suite *Suite) TestCompleteWithExpectTcl() {
 	shell := testutil.ParseOperations(`
 		cfg cli_name=testcli
@@ -323,11 +468,113 @@ func (suite *Suite) TestCompleteWithExpectTcl() {
 	suite.RequireCompleteWithExpectTcl(shell, "testcli -ab", "testcli -aba")
 }
 
+func (suite *Suite) TestCompletePaths() {
+	dir := suite.TempDir()
+	suite.Require().NoError(os.MkdirAll(path.Join(dir, "configs", "nested"), 0755))
+	suite.Require().NoError(os.MkdirAll(path.Join(dir, "data dir"), 0755))
+	suite.CreateFile("configs/app.json", "{}")
+	suite.CreateFile("configs/app.yaml", "")
+	suite.CreateFile("configs/app.txt", "")
+	suite.CreateFile("data dir/notes.txt", "")
+
+	shell := testutil.ParseOperations(`
+		cfg cli_name=testcli
+		opt --config --complete=file:*.json,*.yaml
+		opt --out --complete=dir
+		pos --complete=file
+	`)
+	configs := path.Join(dir, "configs")
+	suite.RequireComplete(shell, "testcli --config "+configs+"/", configs+"/nested "+configs+"/app.json "+configs+"/app.yaml")
+	suite.RequireComplete(shell, "testcli --out "+configs+"/", configs+"/nested")
+	suite.RequireComplete(shell, "testcli "+configs+"/app.t", configs+"/app.txt")
+	suite.RequireComplete(shell, "testcli --", "--config --out")
+
+	suite.RequireCompleteWithExpectTcl(shell, "testcli --out "+dir+"/da", "testcli --out "+dir+"/data\\ dir/")
+	suite.RequireCompleteWithExpectTcl(shell, "testcli "+dir+"/data\\ dir/no", "testcli "+dir+"/data\\ dir/notes.txt ")
+	suite.RequireCompleteWithExpectTcl(shell, "testcli --config "+configs+"/app.j", "testcli --config "+configs+"/app.json ")
+}
+
+func (suite *Suite) TestOptionValueStyle() {
+	suite.Run("complete option value like --opt=value", func() {
+		shell := testutil.ParseOperations(`
+			cfg cli_name=testcli
+			opt --key --choices="val1 val2 other"
+			opt --tree --closure="__testcli_completer"
+			opt -v
+		`)
+		shell += "\n" + `__testcli_completer () { COMPREPLY=("${shcomp2_CURRENT_WORD}-tree"); }`
+		suite.RequireComplete(shell, "testcli --key=", "val1 val2 other")
+		suite.RequireComplete(shell, "testcli --key=v", "val1 val2")
+		suite.RequireComplete(shell, "testcli --key=val1 ", "--tree -v")
+		suite.RequireComplete(shell, "testcli --key=val1 --tree=oak", "oak-tree")
+	})
+	suite.Run("allow opt=val and opt val", func() {
+		shell := testutil.ParseOperations(`
+			cfg cli_name=testcli
+			opt --both --choices="a1 a2" --value-style=both
+			opt --space --choices="b1 b2" --value-style=space
+			opt --equals --choices="c1 c2" --value-style=equals
+		`)
+		suite.RequireComplete(shell, "testcli --both ", "a1 a2")
+		suite.RequireComplete(shell, "testcli --both=", "a1 a2")
+		suite.RequireComplete(shell, "testcli --space ", "b1 b2")
+		suite.RequireComplete(shell, "testcli --space=", "")
+		suite.RequireComplete(shell, "testcli --equals=", "c1 c2")
+		suite.RequireComplete(shell, "testcli --equals ", "--both --space")
+	})
+	suite.Run("tab complete opt -> opt=", func() {
+		shell := testutil.ParseOperations(`
+			cfg cli_name=testcli
+			opt --color --choices="auto never always" --value-style=equals
+			opt --verbose
+		`)
+		suite.RequireComplete(shell, "testcli ", "--color= --verbose")
+		suite.RequireComplete(shell, "testcli --col", "--color=")
+		suite.RequireCompleteWithExpectTcl(shell, "testcli --col", "testcli --color=")
+		suite.RequireCompleteWithExpectTcl(shell, "testcli --color=ne", "testcli --color=never ")
+	})
+}
+
+func (suite *Suite) TestExclusiveGroups() {
+	suite.Run("exclusive options --vanilla --chocolate", func() {
+		shell := testutil.ParseOperations(`
+			cfg cli_name=testcli
+			grp flavor --exclusive
+			opt --vanilla --group=flavor
+			opt --chocolate|-c --group=flavor
+			opt --sprinkles
+		`)
+		suite.RequireComplete(shell, "testcli ", "--vanilla --chocolate -c --sprinkles")
+		suite.RequireComplete(shell, "testcli --vanilla ", "--sprinkles")
+		suite.RequireComplete(shell, "testcli -c ", "--sprinkles")
+		suite.RequireComplete(shell, "testcli --sprinkles ", "--vanilla --chocolate -c")
+	})
+	suite.Run("groups that aren't exclusive", func() {
+		shell := testutil.ParseOperations(`
+			cfg cli_name=testcli
+			grp toppings
+			opt --sprinkles --group=toppings
+			opt --nuts --group=toppings
+		`)
+		suite.RequireComplete(shell, "testcli --nuts ", "--sprinkles")
+	})
+	suite.Run("exclusive groups in subparsers", func() {
+		shell := testutil.ParseOperations(`
+			cfg cli_name=testcli
+			opt --vanilla
+			grp -p=order flavor --exclusive
+			opt -p=order --vanilla --group=flavor
+			opt -p=order --chocolate --group=flavor
+		`)
+		suite.RequireComplete(shell, "testcli --vanilla ", "order")
+		suite.RequireComplete(shell, "testcli order --chocolate ", "")
+	})
+}
+
 func (suite *Suite) FutureTests() {
 	suite.Run("include other source files error handling when missing include source", func() {})
 	suite.Run("sort results by pos -> --help option", func() {})
 	suite.Run("options with values but prefer equals sign", func() {})
-	suite.Run("autgenpy follow imports to other files", func() {})
 	suite.Run("subparsers cmds are always the first positional and cannot clash", func() {})
 	suite.Run("custom log", func() {})
 	suite.Run("source ~/.bashrc is FAST with MANY 'autogen calls'", func() {})
@@ -337,8 +584,6 @@ func (suite *Suite) FutureTests() {
 	suite.Run("positionals without hints are recognized countwise", func() {})
 	suite.Run("py_autogen detect disabling --help/-h", func() {})
 	suite.Run("shcomp2_autogen specify out file", func() {})
-	suite.Run("exclusive options --vanilla --chocolate", func() {})
-	suite.Run("complete option value like --opt=value", func() {})
 	suite.Run("add flag to auto add = if only one arg option left and it requires an argument", func() {})
 	suite.Run("complete single -s type options like -f filepath", func() {})
 	suite.Run("complete single -s type options like -ffilepath (if that makes sense)", func() {})
@@ -356,8 +601,6 @@ func (suite *Suite) FutureTests() {
 	suite.Run("benchmark source compiled scripts", func() {})
 	suite.Run("use -- in util scripts to separate arguments from options", func() {})
 	suite.Run("allow single -longopt like golang", func() {})
-	suite.Run("allow opt=val and opt val", func() {})
-	suite.Run("tab complete opt -> opt=", func() {})
 	suite.Run("choices for options with arguments", func() {})
 	suite.Run("scan python script for auto generate", func() {})
 	suite.Run("get compiled script version", func() {})
@@ -368,9 +611,6 @@ func (suite *Suite) FutureTests() {
 	suite.Run("provide custom functions -F to autocomplete option values", func() {})
 	suite.Run("provide custom functions -F to autocomplete subparsers option values", func() {})
 	suite.Run("invalid usages of shcomp2 utility functions", func() {})
-	suite.Run("stateless in environment after compilation. no leftover variables.", func() {})
-	suite.Run("zero logging when in production mode", func() {})
-	suite.Run("doesnt share variable state between different cli_name", func() {})
 	suite.Run("can provide autocompletion custom git extensions", func() {})
 	suite.Run("has full documentation", func() {})
 	suite.Run("compatable with bash,sh,zsh,ksh,msys2,fish,cygwin,bashwin (docker emulation)", func() {})
@@ -382,7 +622,6 @@ func (suite *Suite) FutureTests() {
 	suite.Run("git plugin", func() {})
 	suite.Run("npm plugin", func() {})
 	suite.Run("autogen_py plugin", func() {})
-	suite.Run("autogen_node plugin", func() {})
 	suite.Run("autogen_golang plugin", func() {})
 	suite.Run("autogen_sh plugin", func() {})
 	suite.Run("compiled scripts are actually readable", func() {})
@@ -394,6 +633,62 @@ func (suite *Suite) FutureTests() {
 	suite.Run("rethink nargs complexity. is specifying a lower range really necessary", func() {})
 }
 
+func (suite *Suite) TestStateless() {
+	// the user's own functions and variables with the names scripts use internally
+	setup := lib.Dedent(`
+		log () { echo "user log"; }
+		word=mine parser=mine choice=mine subparser_candidate=mine real_carg_index=mine
+		__testcli_completer () { COMPREPLY=("$1-$2-$#"); }
+	`)
+	shell := testutil.ParseOperations(`
+		cfg cli_name=testcli
+		cfg merge_single_opt=1
+		grp flavor --exclusive
+		opt --vanilla --group=flavor
+		opt --chocolate --group=flavor
+		opt -a
+		opt -b
+		opt --tree --closure="__testcli_completer"
+		opt --color --choices="auto never" --desc=auto="pick one" --value-style=equals
+		opt --config --complete=file:*.json
+		psr run --help="run a task"
+		pos -p=run --choices="one two three" --nargs=2 --nargs-unique
+		pos -p=run --closure="__testcli_completer"
+		opt -p=run --fast
+		psr build
+	`)
+	suite.RequireStateless(setup, shell, "testcli",
+		"testcli ",
+		"testcli --vanilla -ab ",
+		"testcli --tree oak",
+		"testcli --tree=oak",
+		"testcli --color=",
+		"testcli --config ",
+		"testcli run one ",
+		"testcli run one two ",
+		"testcli run one two x",
+		"testcli run --f",
+	)
+
+	suite.Run("closures get the current word and the words before it", func() {
+		suite.RequireComplete(setup+"\n"+shell, "testcli --tree oak", "oak-testcli-3")
+		suite.RequireComplete(setup+"\n"+shell, "testcli --tree=oak", "oak-testcli-2")
+		suite.RequireComplete(setup+"\n"+shell, "testcli run one two x", "x-testcli-5")
+	})
+
+	suite.Run("clis don't share state", func() {
+		other := testutil.ParseOperations(`
+			cfg cli_name=othercli
+			pos --choices="one two three" --nargs=2 --nargs-unique
+		`)
+		both := setup + "\n" + shell + "\n" + other
+		suite.RequireStateless(setup+"\n"+shell, other, "othercli", "othercli one ")
+		suite.RequireComplete(both, "testcli run one ", "two three --fast")
+		suite.RequireComplete(both, "othercli two ", "one three")
+		suite.RequireComplete(both, "testcli run one ", "two three --fast")
+	})
+}
+
 func (suite *Suite) TestMainToStdout() {
 	stdout := mainWithStdout(
 		`
@@ -466,25 +761,306 @@ func (suite *Suite) TestEndToEndAutoGenWithReload() {
 		return hex.EncodeToString(hasher.Sum(nil))
 	}
 
-	// todo: test that it only reloads when changes are made to trigger files
 	suite.RequireCompleteFile(completeFile, "bobman ", "--awesome")
 
 	hashBeforeReload := hashFile("cmd.bash")
 
+	// touching the trigger without changing it doesn't regenerate
+	cmdFile := path.Join(tmpDir, "cmd.py")
+	later := time.Now().Add(time.Hour)
+	lib.Check(os.Chtimes(cmdFile, later, later))
+	suite.RequireCompleteFile(completeFile, "bobman ", "--awesome")
+	suite.Equal(hashBeforeReload, hashFile("cmd.bash"))
+
+	// the trigger is racy, its modification time is within a filesystem tick of the compile, so the
+	// script keeps checking and edits that keep the time are found by their hash
 	writeFile("cmd.py", `
 			from argparse import ArgumentParser
 			parser = ArgumentParser()
 			parser.add_argument("--awesome-times-infinity")
 		`)
-	time.Sleep(time.Millisecond) // allow reload to pickup time change
-
+	lib.Check(os.Chtimes(cmdFile, later, later))
 	suite.RequireCompleteFile(completeFile, "bobman ", "--awesome-times-infinity")
 	hashAfterReload := hashFile("cmd.bash")
-	suite.RequireCompleteFile(completeFile, "bobman ", "--awesome-times-infinity")
-	hashAfterNoReload := hashFile("cmd.bash")
-
 	suite.NotEqual(hashBeforeReload, hashAfterReload)
-	suite.Equal(hashAfterNoReload, hashAfterReload)
+
+	// same size and modification time as the state the script was just regenerated with
+	writeFile("cmd.py", `
+			from argparse import ArgumentParser
+			parser = ArgumentParser()
+			parser.add_argument("--infinity-times-awesome")
+		`)
+	lib.Check(os.Chtimes(cmdFile, later, later))
+	suite.RequireCompleteFile(completeFile, "bobman ", "--infinity-times-awesome")
+	hashAfterSameTimeEdit := hashFile("cmd.bash")
+	suite.RequireCompleteFile(completeFile, "bobman ", "--infinity-times-awesome")
+
+	suite.NotEqual(hashAfterReload, hashAfterSameTimeEdit)
+	suite.Equal(hashAfterSameTimeEdit, hashFile("cmd.bash"))
+}
+
+// TestReloadCheckLatency guards the cost every TAB pays for an autogen cli whose triggers didn't change,
+// the reloader must not fork shcomp2
+func (suite *Suite) TestReloadCheckLatency() {
+	suite.CreateFile("src/cmd.py", `
+		from argparse import ArgumentParser
+		parser = ArgumentParser()
+		parser.add_argument("--awesome", action="store_true")
+	`)
+	suite.CreateFile("src/sub/args.py", "ARGS = []\n")
+	// files written just now are racy and checked on every TAB, these were edited a while ago
+	earlier := time.Now().Add(-time.Hour)
+	for _, name := range []string{"src/cmd.py", "src/sub/args.py", "src/sub", "src"} {
+		lib.Check(os.Chtimes(path.Join(suite.TempDir(), name), earlier, earlier))
+	}
+	completeFile := path.Join(suite.TempDir(), "cmd.bash")
+	mainWithStdout(fmt.Sprintf(`
+		cfg cli_name=bobman
+		cfg autogen_lang=py
+		cfg autogen_file=%[1]s/src/cmd.py
+		cfg autogen_reload_trigger=%[1]s/src/**/*.py
+		cfg outfile=%[2]s
+	`, suite.TempDir(), completeFile))
+
+	// the first completion writes the stamp
+	suite.RequireCompleteFile(completeFile, "bobman ", "--awesome")
+
+	// only the reloader is timed, the completion it wraps and shcomp2 are stubbed
+	const tabs = 1000
+	script := fmt.Sprintf(`
+		source %s
+		__shcomp2_v2_autocomplete_bobman () { :; }
+		shcomp2 () { echo "shcomp2 $*" >&2; }
+		start="$EPOCHREALTIME"
+		for ((i = 0; i < %d; i++)); do __shcomp2_v2_autocomplete_autogen_reloader_bobman; done
+		echo "$(( ${EPOCHREALTIME/./} - ${start/./} ))"
+	`, completeFile, tabs)
+	cmd := exec.Command("bash", "-c", lib.Dedent(script))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	suite.Require().NoError(err, stderr.String())
+	suite.Require().Empty(stderr.String(), "the reloader ran shcomp2 without a change")
+
+	var elapsedUs int64
+	_, err = fmt.Sscanf(string(out), "%d", &elapsedUs)
+	suite.Require().NoError(err, string(out))
+	// without a fork it's microseconds, the bound is loose enough for a loaded machine but not for a fork+exec
+	perTab := time.Duration(elapsedUs) * time.Microsecond / tabs
+	suite.T().Logf("reload check takes %s per completion", perTab)
+	suite.Require().Less(perTab, 5*time.Millisecond, "the reload check is too slow for every TAB")
+}
+
+// TestProductionMode runs the built binary, main sets up logging before entry
+func (suite *Suite) TestProductionMode() {
+	home := suite.TempDir()
+	suite.T().Setenv("HOME", home)
+	suite.T().Setenv("XDG_STATE_HOME", "")
+	cmd := exec.Command("build/shcomp2", "-")
+	cmd.Stdin = strings.NewReader("cfg cli_name=testcli\nopt --help\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	suite.Require().NoError(err, stderr.String())
+
+	suite.NotContains(string(out), "log")
+	suite.NotContains(string(out), "$HOME")
+	entries, err := os.ReadDir(home)
+	suite.Require().NoError(err)
+	suite.Empty(entries, "shcomp2 wrote to $HOME without -debug")
+}
+
+func (suite *Suite) TestDebugMode() {
+	stateHome := path.Join(suite.TempDir(), "state")
+	suite.T().Setenv("XDG_STATE_HOME", stateHome)
+	logFile := path.Join(stateHome, "shcomp2", "shcomp2.log")
+	completeFile := path.Join(suite.TempDir(), "testcli.bash")
+	cmd := exec.Command("build/shcomp2", "-debug", "-")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("cfg cli_name=testcli\ncfg outfile=%s\nopt --help\n", completeFile))
+	out, err := cmd.CombinedOutput()
+	suite.Require().NoError(err, string(out))
+	suite.Require().FileExists(logFile)
+
+	compiled, err := os.ReadFile(completeFile)
+	suite.Require().NoError(err)
+	suite.Contains(string(compiled), "# cfg log_level=debug")
+	suite.RequireCompleteFile(completeFile, "testcli --he", "--help")
+	logs, err := os.ReadFile(logFile)
+	suite.Require().NoError(err)
+	suite.Contains(string(logs), "DBG testcli: parser=baseparser word=--he candidates=1")
+
+	// above debug the script doesn't log, only shcomp2 does
+	cmd = exec.Command("build/shcomp2", "-debug", "-log-level=warn", "-")
+	cmd.Stdin = strings.NewReader("cfg cli_name=testcli\nopt --help\n")
+	out, err = cmd.Output()
+	suite.Require().NoError(err)
+	suite.Contains(string(out), "# cfg log_level=warn")
+	suite.NotContains(string(out), "__shcomp2_v2_log_testcli")
+
+	cmd = exec.Command("build/shcomp2", "-debug", "-log-level=loud", "-")
+	out, err = cmd.CombinedOutput()
+	suite.Require().Error(err)
+	suite.Equal("error: invalid log level \"loud\", expected one of trace, debug, info, warn, error\n", string(out))
+}
+
+func (suite *Suite) TestMainEmitJSON() {
+	result := mainWithArgs(Options{args: []string{"-"}, emit: "json"}, lib.Dedent(`
+		cfg cli_name=testcli
+		opt --mode|-m --choices="fast slow" --help="how fast"
+		pos --nargs=*
+		psr run
+	`))
+	suite.Require().Equal(0, result.code, result.stderr)
+
+	var dump struct {
+		CliName string `json:"cli_name"`
+		Parsers []lib.CliParser
+	}
+	suite.Require().NoError(json.Unmarshal([]byte(result.stdout), &dump))
+	suite.Require().Equal("testcli", dump.CliName)
+	suite.Require().Len(dump.Parsers, 2)
+	suite.Require().Equal(lib.CliParserName(lib.DefaultParser), dump.Parsers[0].Name)
+	suite.Require().Equal([]string{"run"}, dump.Parsers[0].Subparsers)
+	suite.Require().Equal(lib.CliParserName("run"), dump.Parsers[1].Name)
+
+	mode := dump.Parsers[0].Optionals[0]
+	suite.Require().Equal("--mode", mode.Name)
+	suite.Require().Equal([]string{"-m"}, mode.Alternatives)
+	suite.Require().Equal([]string{"fast", "slow"}, mode.Choices)
+	suite.Require().Equal("how fast", mode.Help)
+	suite.Require().Equal(1, dump.Parsers[0].Positionals[0].Number)
+	suite.Require().Contains(result.stdout, `"nargs": {
+            "min": 0,
+            "max": null,`)
+	suite.Require().Contains(result.stdout, `"include_source": [],`)
+	suite.Require().Contains(result.stdout, `"autogen_reload_trigger": [],`)
+
+	result = mainWithArgs(Options{args: []string{"-"}, emit: "yaml"}, "cfg cli_name=testcli")
+	suite.Require().Equal(1, result.code)
+	suite.Require().Equal("error: unknown emit \"yaml\", expected shell or json\n", result.stderr)
+}
+
+func (suite *Suite) TestMainEmitJSONAfterAutogen() {
+	suite.CreateFile("cmd.py", `
+		from argparse import ArgumentParser
+		parser = ArgumentParser()
+		parser.add_argument("--awesome", choices=["a", "b"])
+	`)
+	specFile := suite.CreateFile("cmd.shcomp", `
+		cfg cli_name=cmd
+		cfg autogen_lang=py
+		cfg autogen_file=cmd.py
+	`)
+
+	result := mainWithArgs(Options{args: []string{specFile}, emit: "json"}, "")
+	suite.Require().Equal(0, result.code, result.stderr)
+	var dump struct {
+		Parsers []lib.CliParser
+	}
+	suite.Require().NoError(json.Unmarshal([]byte(result.stdout), &dump))
+	suite.Require().Equal("--awesome", dump.Parsers[0].Optionals[0].Name)
+	suite.Require().Equal([]string{"a", "b"}, dump.Parsers[0].Optionals[0].Choices)
+}
+
+func (suite *Suite) TestMainFromSpecFile() {
+	suite.CreateFile("lib.sh", `
+		__testcli_pos_1_completer() {
+			mapfile -t COMPREPLY < <(compgen -W "c8 c9 c10" -- "$current_word")
+		}
+	`)
+	specFile := suite.CreateFile("testcli.shcomp", `
+		cfg cli_name=testcli
+		cfg include_source=lib.sh
+		pos --closure="__testcli_pos_1_completer"
+		opt --awesome
+	`)
+
+	result := executeEntry("", specFile)
+	suite.Require().Equal(0, result.code, result.stderr)
+	suite.Require().Contains(result.stdout, path.Join(suite.TempDir(), "lib.sh"))
+	suite.RequireComplete(result.stdout, "testcli ", "c8 c9 c10 --awesome")
+}
+
+func (suite *Suite) TestMainFromStructuredSpecFile() {
+	suite.CreateFile("lib.sh", `
+		__testcli_pos_1_completer() {
+			mapfile -t COMPREPLY < <(compgen -W "c8 c9 c10" -- "$current_word")
+		}
+	`)
+	jsonFile := suite.CreateFile("testcli.json", `
+		{
+			"cli_name": "testcli",
+			"config": {"include_source": ["lib.sh"]},
+			"positionals": [{"closure": "__testcli_pos_1_completer"}],
+			"options": [{"name": "--awesome"}]
+		}
+	`)
+	yamlFile := suite.CreateFile("testcli.yaml", `
+		cli_name: testcli
+		config: {include_source: [lib.sh]}
+		positionals:
+		- closure: __testcli_pos_1_completer
+		options:
+		- name: --awesome
+	`)
+
+	for _, specFile := range []string{jsonFile, yamlFile} {
+		result := executeEntry("", specFile)
+		suite.Require().Equal(0, result.code, result.stderr)
+		suite.Require().Contains(result.stdout, path.Join(suite.TempDir(), "lib.sh"))
+		suite.RequireComplete(result.stdout, "testcli ", "c8 c9 c10 --awesome")
+	}
+}
+
+func (suite *Suite) TestMainFormatFlag() {
+	result := mainWithArgs(Options{args: []string{"-"}, format: "yaml"}, lib.Dedent(`
+		cli_name: testcli
+		options:
+		- {name: --mode, choices: [fast, slow]}
+	`))
+	suite.Require().Equal(0, result.code, result.stderr)
+	suite.RequireComplete(result.stdout, "testcli --mode ", "fast slow")
+
+	result = mainWithArgs(Options{args: []string{"-"}, format: "toml"}, "cli_name = 'testcli'")
+	suite.Require().Equal(1, result.code)
+	suite.Require().Equal("error: unknown format \"toml\", expected dsl, json or yaml\n", result.stderr)
+
+	result = mainWithArgs(Options{args: []string{"-"}, format: "json"}, `{"cli_name": "testcli", "options": [{"name": "--mode", "complete": "socket"}]}`)
+	suite.Require().Equal(1, result.code)
+	suite.Require().Equal("error: option --mode: unknown complete type \"socket\", expected file, dir or value\n", result.stderr)
+}
+
+func (suite *Suite) TestMainFromMultipleSpecFiles() {
+	specFileA := suite.CreateFile("clia.shcomp", `
+		cfg cli_name=clia
+		opt --alpha
+	`)
+	specFileB := suite.CreateFile("clib.shcomp", `
+		cfg cli_name=clib
+		opt --beta
+	`)
+
+	result := executeEntry("", specFileA, specFileB)
+	suite.Require().Equal(0, result.code, result.stderr)
+	suite.RequireComplete(result.stdout, "clia ", "--alpha")
+	suite.RequireComplete(result.stdout, "clib ", "--beta")
+}
+
+func (suite *Suite) TestMainMissingSpecFile() {
+	missingFile := path.Join(suite.TempDir(), "missing.shcomp")
+	result := executeEntry("", missingFile)
+	suite.Require().Equal(1, result.code)
+	suite.Require().Equal(fmt.Sprintf("error: unable to read spec file: open %s: no such file or directory\n", missingFile), result.stderr)
+
+	missingDocument := path.Join(suite.TempDir(), "missing.yaml")
+	result = executeEntry("", missingDocument)
+	suite.Require().Equal(1, result.code)
+	suite.Require().Equal(fmt.Sprintf("error: unable to read spec file: open %s: no such file or directory\n", missingDocument), result.stderr)
+
+	// the reason is kept so a directory or an unreadable file isn't reported as missing
+	result = executeEntry("", suite.TempDir())
+	suite.Require().Equal(1, result.code)
+	suite.Require().Equal(fmt.Sprintf("error: unable to read spec file: read %s: is a directory\n", suite.TempDir()), result.stderr)
 }
 
 func (suite *Suite) TestMainHandlesError() {
@@ -494,7 +1070,29 @@ func (suite *Suite) TestMainHandlesError() {
 		pos
 	`))
 	suite.Require().Equal(1, result.code)
-	suite.Require().Equal("error: cannot have a positional come after a indeterminant narg positional\n", result.stderr)
+	suite.Require().Equal("<stdin>:3:1: cannot have a positional come after a indeterminant narg positional\n", result.stderr)
+}
+
+func (suite *Suite) TestMainReportsParseErrors() {
+	specFile := suite.CreateFile("tool.shcomp", `
+		cfg cli_name=testcli
+		opts --verbose
+		cfg outfile
+		opt -p="sub"
+		pos --nargs=bob
+		cfg autogen_reload_trigger=missing.py
+	`)
+
+	result := executeEntry("", specFile)
+	suite.Require().Equal(1, result.code)
+	suite.Require().Equal("", result.stdout)
+	suite.Require().Equal(lib.Dedent(fmt.Sprintf(`
+		%[1]s:2:1: unknown operation "opts"
+		%[1]s:3:5: invalid config "outfile", expected name=value
+		%[1]s:4:13: missing option name
+		%[1]s:5:5: unable to parse nargs bob
+		%[1]s:6:5: reload trigger file not found %[2]s
+	`, specFile, path.Join(suite.TempDir(), "missing.py"))), result.stderr)
 }
 
 func (suite *Suite) TestNargsErrorHandling() {
@@ -512,7 +1110,7 @@ func (suite *Suite) TestNargsErrorHandling() {
 				pos --nargs=*
 				pos
 				`,
-			errIndeterm,
+			"3:1: " + errIndeterm,
 		},
 		{
 			"pos after range",
@@ -521,7 +1119,7 @@ func (suite *Suite) TestNargsErrorHandling() {
 				pos --nargs={0,1}
 				pos
 				`,
-			errIndeterm,
+			"3:1: " + errIndeterm,
 		},
 		{
 			"opt with narg after range okay",
@@ -538,7 +1136,7 @@ func (suite *Suite) TestNargsErrorHandling() {
 				cfg cli_name=testcli
 				pos --nargs={0,1
 				`,
-			"unable to parse nargs {0,1",
+			"2:5: unable to parse nargs {0,1",
 		},
 		{
 			"invalid syntax",
@@ -546,7 +1144,7 @@ func (suite *Suite) TestNargsErrorHandling() {
 				cfg cli_name=testcli
 				pos --nargs=bob
 				`,
-			"unable to parse nargs bob",
+			"2:5: unable to parse nargs bob",
 		},
 		{
 			"negative numbers",
@@ -554,7 +1152,7 @@ func (suite *Suite) TestNargsErrorHandling() {
 				cfg cli_name=testcli
 				pos --nargs=-1
 				`,
-			"cannot have negative values for nargs -1",
+			"2:5: cannot have negative values for nargs -1",
 		},
 		{
 			"negative numbers",
@@ -562,7 +1160,7 @@ func (suite *Suite) TestNargsErrorHandling() {
 				cfg cli_name=testcli
 				pos --nargs={1,-3}
 				`,
-			"cannot have negative values for nargs {1,-3}",
+			"2:5: cannot have negative values for nargs {1,-3}",
 		},
 		{
 			"max zero",
@@ -570,7 +1168,7 @@ func (suite *Suite) TestNargsErrorHandling() {
 				cfg cli_name=testcli
 				pos --nargs={0,0}
 				`,
-			"cannot use 0 for narg max {0,0}",
+			"2:5: cannot use 0 for narg max {0,0}",
 		},
 		{
 			"min greater than max",
@@ -578,7 +1176,7 @@ func (suite *Suite) TestNargsErrorHandling() {
 				cfg cli_name=testcli
 				pos --nargs={2,1}
 				`,
-			"cannot have a min greater than max narg {2,1}",
+			"2:5: cannot have a min greater than max narg {2,1}",
 		},
 		{
 			"min greater than max",
@@ -586,7 +1184,7 @@ func (suite *Suite) TestNargsErrorHandling() {
 				cfg cli_name=testcli
 				pos --nargs={inf,1}
 				`,
-			"cannot have a min greater than max narg {inf,1}",
+			"2:5: cannot have a min greater than max narg {inf,1}",
 		},
 	}
 
@@ -617,12 +1215,19 @@ type resultMain struct {
 	stderr string
 }
 
-func executeEntry(stdin string) resultMain {
+func executeEntry(stdin string, args ...string) resultMain {
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	return mainWithArgs(Options{checkReload: false, args: args}, stdin)
+}
+
+func mainWithArgs(options Options, stdin string) resultMain {
 	var stdoutWriter bytes.Buffer
 	var stderrWriter bytes.Buffer
 	var stdinReader bytes.Buffer
 	stdinReader.WriteString(stdin)
-	exitCode := entry(&stdinReader, &stdoutWriter, &stderrWriter, Options{checkReload: false, args: []string{"-"}})
+	exitCode := entry(&stdinReader, &stdoutWriter, &stderrWriter, options)
 	return resultMain{
 		code:   exitCode,
 		stdout: stdoutWriter.String(),
@@ -0,0 +1,177 @@
+package generators
+
+import (
+	"fmt"
+	sitter "github.com/smacker/go-tree-sitter"
+	"os"
+	"shcomp2/pkg/lib"
+	"strings"
+)
+
+// Generate adds the operations autogen_lang extracts from the autogen source, other specs are unchanged
+func Generate(cli lib.Cli) (lib.Cli, error) {
+	switch cli.Config.AutogenLang {
+	case "py":
+		return GeneratePythonOperations(cli)
+	case "py-click":
+		return GenerateClickOperations(cli)
+	case "go":
+		return GenerateGoOperations(cli)
+	case "js":
+		return GenerateJavaScriptOperations(cli)
+	case "help":
+		return GenerateHelpOperations(cli)
+	}
+	return cli, nil
+}
+
+// generateOperations reads the autogen source and parses it into operations added after the spec operations
+func generateOperations(cli lib.Cli, parse func(src string) []string) (lib.Cli, error) {
+	var src string
+	if cli.Config.AutogenClosureFunc != "" {
+		src = callBashClosureFunc(cli.Config.AutogenClosureSource, cli.Config.AutogenClosureFunc)
+	} else if cli.Config.AutogenClosureCmd != "" {
+		src = runCmd(cli.Config.AutogenClosureCmd)
+	} else {
+		content, err := os.ReadFile(cli.Config.AutogenFile)
+		if err != nil {
+			return cli, fmt.Errorf("unable to read autogen file: %w", err)
+		}
+		src = string(content)
+	}
+	return addOperations(cli, parse(src))
+}
+
+// addOperations reparses the spec with the generated operations after the spec operations
+func addOperations(cli lib.Cli, generated []string) (lib.Cli, error) {
+	var operations = append(cli.Operations, generated...)
+
+	// strip int operations
+	var newOperations []string
+	for _, op := range operations {
+		if strings.HasPrefix(op, "int ") {
+			continue
+		}
+		newOperations = append(newOperations, op)
+	}
+	operations = newOperations
+
+	generatedCli, err := lib.ParseOperations(strings.Join(operations, "\n"))
+	if err != nil {
+		return cli, fmt.Errorf("unable to use the generated operations: %w", err)
+	}
+	return generatedCli, nil
+}
+
+// autogenCommand is a command or group found in the source, the base parser when it has no parent
+type autogenCommand struct {
+	identifier string
+	name       string
+	help       string
+	parent     *autogenCommand
+	params     []autogenParam
+	commands   []*autogenCommand
+}
+
+// autogenParam is an option when it has names, otherwise a positional
+type autogenParam struct {
+	names    []string
+	choices  []string
+	complete string
+	globs    []string
+	nargs    string
+	help     string
+}
+
+// commandOperations are the operations of a command and its subcommands, parents always come before children
+func commandOperations(command *autogenCommand, fqn string) []string {
+	var operations []string
+	for _, param := range command.params {
+		var operation []string
+		if len(param.names) > 0 {
+			operation = append(operation, "opt")
+		} else {
+			operation = append(operation, "pos")
+		}
+		if fqn != "" {
+			operation = append(operation, "-p="+lib.QuoteWord(fqn))
+		}
+		nameIndex := len(operation)
+		if len(param.names) > 0 {
+			operation = append(operation, lib.QuoteWord(strings.Join(param.names, "|")))
+		}
+		if len(param.choices) > 0 {
+			operation = append(operation, "--choices="+lib.QuoteChoices(param.choices))
+		}
+		if len(param.globs) > 0 {
+			operation = append(operation, "--complete="+lib.QuoteWord(param.complete+":"+strings.Join(param.globs, ",")))
+		} else if param.complete != "" {
+			operation = append(operation, "--complete="+param.complete)
+		}
+		if param.nargs != "" {
+			operation = append(operation, "--nargs="+lib.QuoteWord(param.nargs))
+		}
+		if param.help != "" {
+			operation = append(operation, "--help="+lib.QuoteWord(param.help))
+		}
+		if len(param.names) > 1 && param.nargs != "" {
+			// nargs can't have alternatives, every name is its own option like -t a --tag b allows
+			for _, name := range param.names {
+				operation[nameIndex] = lib.QuoteWord(name)
+				operations = append(operations, strings.Join(operation, " "))
+			}
+			continue
+		}
+		operations = append(operations, strings.Join(operation, " "))
+	}
+
+	for _, subcommand := range command.commands {
+		operation := []string{"psr"}
+		if fqn != "" {
+			operation = append(operation, "-p="+lib.QuoteWord(fqn))
+		}
+		operation = append(operation, lib.QuoteWord(subcommand.name))
+		if subcommand.help != "" {
+			operation = append(operation, "--help="+lib.QuoteWord(subcommand.help))
+		}
+		operations = append(operations, strings.Join(operation, " "))
+
+		subFQN := subcommand.name
+		if fqn != "" {
+			subFQN = fqn + "." + subcommand.name
+		}
+		operations = append(operations, commandOperations(subcommand, subFQN)...)
+	}
+	return operations
+}
+
+func queryNodes(lang *sitter.Language, root *sitter.Node, pattern string) []*sitter.Node {
+	q, err := sitter.NewQuery([]byte(pattern), lang)
+	check(err)
+	qc := sitter.NewQueryCursor()
+	qc.Exec(q, root)
+	var nodes []*sitter.Node
+	for {
+		m, ok := qc.NextMatch()
+		if !ok {
+			break
+		}
+		for _, c := range m.Captures {
+			nodes = append(nodes, c.Node)
+		}
+	}
+	return nodes
+}
+
+// splitAttribute splits click.option into click and option, a bare option has no object
+func splitAttribute(name string) (string, string) {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+func lastName(name string) string {
+	_, last := splitAttribute(name)
+	return last
+}
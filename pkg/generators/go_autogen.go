@@ -0,0 +1,501 @@
+package generators
+
+import (
+	"context"
+	"github.com/rs/zerolog/log"
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/golang"
+	"regexp"
+	"shcomp2/pkg/lib"
+	"strconv"
+	"strings"
+)
+
+// GenerateGoOperations adds the operations of a cli using the flag package or Cobra, autogen_lang=go
+func GenerateGoOperations(cli lib.Cli) (lib.Cli, error) {
+	return generateOperations(cli, parseGoSrc)
+}
+
+// goFlagMethod matches flag and pflag definitions like String, BoolVar, StringSliceVarP, Var and Func
+var goFlagMethod = regexp.MustCompile(`^(Bool|String|Int|Int8|Int16|Int32|Int64|Uint|Uint8|Uint16|Uint32|Uint64|Float32|Float64|Duration|Count|IP|IPMask|IPNet|BytesHex|BytesBase64|Text|Func|BoolFunc|StringSlice|StringArray|StringToString|StringToInt|StringToInt64|IntSlice|Int32Slice|Int64Slice|UintSlice|Float32Slice|Float64Slice|BoolSlice|DurationSlice|IPSlice|)(Var)?(P)?$`)
+
+type goGraph struct {
+	src []byte
+	// commands by variable, locals are scoped by their function like newRunCmd.cmd
+	commands map[string]*autogenCommand
+	// functions that build and return a command, like newRunCmd
+	constructors map[string]*autogenCommand
+	sequence     []*autogenCommand
+	persistent   map[*autogenCommand][]autogenParam
+	// flag sets by variable, flags.String adds to the command of flags := cmd.Flags()
+	flagSets map[string]goFlagSet
+	base     *autogenCommand
+}
+
+type goFlagSet struct {
+	command    *autogenCommand
+	persistent bool
+	// pflag and cobra flags are --name, the flag package uses -name
+	pflag bool
+}
+
+func parseGoSrc(srcStr string) []string {
+	src := []byte(srcStr)
+	parser := sitter.NewParser()
+	parser.SetLanguage(golang.GetLanguage())
+	tree, _ := parser.ParseCtx(context.Background(), nil, src)
+	root := tree.RootNode()
+
+	graph := goGraph{
+		src:          src,
+		commands:     map[string]*autogenCommand{},
+		constructors: map[string]*autogenCommand{},
+		persistent:   map[*autogenCommand][]autogenParam{},
+		flagSets:     map[string]goFlagSet{},
+	}
+	graph.findCommands(root)
+	graph.findFlagSets(root)
+	graph.findCalls(root)
+
+	base := graph.base
+	for _, command := range graph.sequence {
+		if command.parent == nil && command != graph.base {
+			base = command
+			break
+		}
+	}
+	if base == nil {
+		log.Warn().Msg("no cobra command or flag definitions found")
+		return nil
+	}
+	if base != graph.base && graph.base != nil {
+		// flag package flags next to cobra commands belong to the root command
+		base.params = append(graph.base.params, base.params...)
+	}
+	base.name = ""
+	graph.inheritPersistent(base, nil)
+	return commandOperations(base, "")
+}
+
+// findCommands finds every cobra.Command literal and the variable or function it's bound to
+func (graph *goGraph) findCommands(root *sitter.Node) {
+	for _, literal := range queryNodes(golang.GetLanguage(), root, `(composite_literal type: (qualified_type) @type)`) {
+		if literal.Content(graph.src) != "cobra.Command" {
+			continue
+		}
+		literal = literal.Parent()
+		command := &autogenCommand{}
+		body := literal.ChildByFieldName("body")
+		for i := 0; i < int(body.NamedChildCount()); i++ {
+			element := body.NamedChild(i)
+			if element.Type() != "keyed_element" || element.NamedChildCount() != 2 {
+				continue
+			}
+			value := element.NamedChild(1).NamedChild(0)
+			switch element.NamedChild(0).Content(graph.src) {
+			case "Use":
+				use, _ := graph.stringValue(value)
+				if fields := strings.Fields(use); len(fields) > 0 {
+					command.name = fields[0]
+				}
+			case "Short":
+				command.help, _ = graph.stringValue(value)
+			case "ValidArgs":
+				choices := graph.stringList(value)
+				if len(choices) > 0 {
+					command.params = append(command.params, autogenParam{choices: choices, nargs: "*"})
+				}
+			}
+		}
+		if args := graph.keyedValue(body, "Args"); args != nil && len(command.params) > 0 {
+			command.params[0].nargs = graph.argsNargs(args)
+		}
+
+		function := enclosingFunction(literal, graph.src)
+		identifier := graph.boundIdentifier(literal)
+		command.identifier = identifier
+		if identifier != "" {
+			graph.commands[scoped(function, identifier)] = command
+		}
+		if function != "" {
+			if _, ok := graph.constructors[function]; !ok {
+				graph.constructors[function] = command
+			}
+		}
+		graph.sequence = append(graph.sequence, command)
+	}
+}
+
+// findFlagSets finds `flags := cmd.Flags()` and `fs := flag.NewFlagSet("name", ...)`
+func (graph *goGraph) findFlagSets(root *sitter.Node) {
+	for _, call := range queryNodes(golang.GetLanguage(), root, `(call_expression function: (selector_expression)) @call`) {
+		identifier := graph.boundIdentifier(call)
+		if identifier == "" {
+			continue
+		}
+		function := enclosingFunction(call, graph.src)
+		receiver := call.ChildByFieldName("function").ChildByFieldName("operand")
+		switch call.ChildByFieldName("function").ChildByFieldName("field").Content(graph.src) {
+		case "Flags", "LocalFlags", "PersistentFlags":
+			if command := graph.resolve(receiver, function); command != nil {
+				persistent := strings.HasPrefix(call.ChildByFieldName("function").ChildByFieldName("field").Content(graph.src), "Persistent")
+				graph.flagSets[scoped(function, identifier)] = goFlagSet{command: command, persistent: persistent, pflag: true}
+			}
+		case "NewFlagSet":
+			if !graph.isFlagPackage(receiver.Content(graph.src)) {
+				continue
+			}
+			args := call.ChildByFieldName("arguments")
+			name := ""
+			if args.NamedChildCount() > 0 {
+				name, _ = graph.stringValue(args.NamedChild(0))
+			}
+			command := &autogenCommand{identifier: identifier, name: name}
+			graph.sequence = append(graph.sequence, command)
+			graph.flagSets[scoped(function, identifier)] = goFlagSet{command: command, pflag: graph.isPflag(receiver.Content(graph.src))}
+			graph.flagCommand().commands = append(graph.flagCommand().commands, command)
+			command.parent = graph.flagCommand()
+		}
+	}
+}
+
+// findCalls reads flag definitions, AddCommand and the cobra flag annotations in source order
+func (graph *goGraph) findCalls(root *sitter.Node) {
+	type mark struct {
+		command  *autogenCommand
+		flag     string
+		complete string
+		values   []string
+	}
+	var marks []mark
+
+	for _, call := range queryNodes(golang.GetLanguage(), root, `(call_expression function: (selector_expression)) @call`) {
+		function := enclosingFunction(call, graph.src)
+		selector := call.ChildByFieldName("function")
+		receiver := selector.ChildByFieldName("operand")
+		method := selector.ChildByFieldName("field").Content(graph.src)
+		args := namedChildren(call.ChildByFieldName("arguments"))
+
+		switch method {
+		case "AddCommand":
+			parent := graph.resolve(receiver, function)
+			if parent == nil {
+				continue
+			}
+			for _, arg := range args {
+				if child := graph.resolve(arg, function); child != nil && child.parent == nil && child != parent {
+					child.parent = parent
+					parent.commands = append(parent.commands, child)
+				}
+			}
+			continue
+		case "MarkFlagFilename", "MarkPersistentFlagFilename", "MarkFlagDirname", "MarkPersistentFlagDirname", "RegisterFlagCompletionFunc":
+			command := graph.resolve(receiver, function)
+			if command == nil || len(args) == 0 {
+				continue
+			}
+			flag, _ := graph.stringValue(args[0])
+			m := mark{command: command, flag: flag}
+			switch {
+			case strings.HasSuffix(method, "Filename"):
+				m.complete = lib.CompleteTypeFile
+				for _, arg := range args[1:] {
+					if extension, ok := graph.stringValue(arg); ok {
+						m.values = append(m.values, "*."+strings.TrimPrefix(extension, "."))
+					}
+				}
+			case strings.HasSuffix(method, "Dirname"):
+				m.complete = lib.CompleteTypeDir
+			default:
+				// only fixed completions are known without running the program
+				if len(args) < 2 || args[1].Type() != "call_expression" || !strings.HasSuffix(args[1].ChildByFieldName("function").Content(graph.src), "FixedCompletions") {
+					continue
+				}
+				m.values = graph.stringList(args[1].ChildByFieldName("arguments").NamedChild(0))
+			}
+			marks = append(marks, m)
+			continue
+		}
+
+		set, ok := graph.flagSet(receiver, function)
+		if !ok {
+			continue
+		}
+		if param, ok := graph.flagParam(method, args, set.pflag); ok {
+			if set.persistent {
+				graph.persistent[set.command] = append(graph.persistent[set.command], param)
+			} else {
+				set.command.params = append(set.command.params, param)
+			}
+		}
+	}
+
+	for _, m := range marks {
+		for _, params := range [][]autogenParam{m.command.params, graph.persistent[m.command]} {
+			for i := range params {
+				if len(params[i].names) == 0 || params[i].names[0] != "--"+m.flag {
+					continue
+				}
+				if m.complete == "" {
+					params[i].choices = m.values
+				} else {
+					params[i].complete = m.complete
+					params[i].globs = m.values
+				}
+			}
+		}
+	}
+}
+
+// flagSet is the command a flag definition adds to, flag.String adds to the base command
+func (graph *goGraph) flagSet(receiver *sitter.Node, function string) (goFlagSet, bool) {
+	switch receiver.Type() {
+	case "identifier":
+		if graph.isFlagPackage(receiver.Content(graph.src)) {
+			return goFlagSet{command: graph.flagCommand(), pflag: graph.isPflag(receiver.Content(graph.src))}, true
+		}
+		if set, ok := graph.flagSets[scoped(function, receiver.Content(graph.src))]; ok {
+			return set, true
+		}
+		set, ok := graph.flagSets[receiver.Content(graph.src)]
+		return set, ok
+	case "call_expression":
+		selector := receiver.ChildByFieldName("function")
+		if selector.Type() != "selector_expression" {
+			break
+		}
+		field := selector.ChildByFieldName("field").Content(graph.src)
+		if field != "Flags" && field != "LocalFlags" && field != "PersistentFlags" {
+			break
+		}
+		if command := graph.resolve(selector.ChildByFieldName("operand"), function); command != nil {
+			return goFlagSet{command: command, persistent: field == "PersistentFlags", pflag: true}, true
+		}
+	}
+	return goFlagSet{}, false
+}
+
+// flagCommand holds the flags of the flag package, it's the base unless there are cobra commands
+func (graph *goGraph) flagCommand() *autogenCommand {
+	if graph.base == nil {
+		graph.base = &autogenCommand{}
+	}
+	return graph.base
+}
+
+// flagParam reads String("name", "default", "usage"), StringVarP(&v, "name", "n", "default", "usage"),
+// Var(&v, "name", "usage") and Func("name", "usage", fn)
+func (graph *goGraph) flagParam(method string, args []*sitter.Node, pflag bool) (autogenParam, bool) {
+	matches := goFlagMethod.FindStringSubmatch(method)
+	if matches == nil || (matches[1] == "" && matches[2] == "") {
+		return autogenParam{}, false
+	}
+	kind, isVar, hasShorthand := matches[1], matches[2] != "", matches[3] != ""
+	if isVar || kind == "Text" {
+		if len(args) == 0 {
+			return autogenParam{}, false
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return autogenParam{}, false
+	}
+
+	param := autogenParam{}
+	name, ok := graph.stringValue(args[0])
+	if !ok || name == "" {
+		return autogenParam{}, false
+	}
+	args = args[1:]
+	if hasShorthand {
+		param.names = []string{"--" + name}
+		if len(args) > 0 {
+			if shorthand, _ := graph.stringValue(args[0]); shorthand != "" {
+				param.names = append(param.names, "-"+shorthand)
+			}
+			args = args[1:]
+		}
+	} else if pflag {
+		param.names = []string{"--" + name}
+	} else {
+		param.names = []string{"-" + name}
+	}
+
+	usage := len(args) - 1
+	if kind == "Func" || kind == "BoolFunc" {
+		usage = 0
+	}
+	if usage >= 0 && usage < len(args) {
+		param.help, _ = graph.stringValue(args[usage])
+	}
+	if kind == "Count" || strings.HasSuffix(kind, "Slice") || strings.HasSuffix(kind, "Array") || strings.HasPrefix(kind, "StringTo") {
+		param.nargs = "*"
+	}
+	return param, true
+}
+
+func (graph *goGraph) isFlagPackage(identifier string) bool {
+	return identifier == "flag" || identifier == "pflag"
+}
+
+// isPflag is true for pflag, also when it's imported as flag
+func (graph *goGraph) isPflag(identifier string) bool {
+	return identifier == "pflag" || strings.Contains(string(graph.src), `flag "github.com/spf13/pflag"`)
+}
+
+// argsNargs reads cobra.ExactArgs(2), cobra.MaximumNArgs(1) and friends
+func (graph *goGraph) argsNargs(args *sitter.Node) string {
+	if args.Type() != "call_expression" {
+		if strings.HasSuffix(args.Content(graph.src), "NoArgs") {
+			return "0"
+		}
+		return "*"
+	}
+	var counts []string
+	for _, arg := range namedChildren(args.ChildByFieldName("arguments")) {
+		counts = append(counts, arg.Content(graph.src))
+	}
+	if len(counts) == 0 {
+		return "*"
+	}
+	switch lastName(args.ChildByFieldName("function").Content(graph.src)) {
+	case "ExactArgs", "ExactValidArgs":
+		return counts[0]
+	case "MinimumNArgs":
+		return "{" + counts[0] + ",inf}"
+	case "MaximumNArgs":
+		return "{0," + counts[0] + "}"
+	case "RangeArgs":
+		if len(counts) == 2 {
+			return "{" + counts[0] + "," + counts[1] + "}"
+		}
+	}
+	return "*"
+}
+
+// inheritPersistent adds the persistent flags of a command and its parents to it and its subcommands
+func (graph *goGraph) inheritPersistent(command *autogenCommand, inherited []autogenParam) {
+	inherited = append(append([]autogenParam{}, inherited...), graph.persistent[command]...)
+	command.params = append(command.params, inherited...)
+	for _, subcommand := range command.commands {
+		graph.inheritPersistent(subcommand, inherited)
+	}
+}
+
+// resolve finds the command an expression refers to, a variable or a call to a constructor
+func (graph *goGraph) resolve(node *sitter.Node, function string) *autogenCommand {
+	switch node.Type() {
+	case "identifier":
+		if command, ok := graph.commands[scoped(function, node.Content(graph.src))]; ok {
+			return command
+		}
+		return graph.commands[node.Content(graph.src)]
+	case "call_expression":
+		return graph.constructors[lastName(node.ChildByFieldName("function").Content(graph.src))]
+	case "unary_expression", "parenthesized_expression":
+		if node.NamedChildCount() > 0 {
+			return graph.resolve(node.NamedChild(0), function)
+		}
+	}
+	return nil
+}
+
+// boundIdentifier is the variable an expression is assigned to, `x := expr`, `var x = expr` or `x = expr`
+func (graph *goGraph) boundIdentifier(node *sitter.Node) string {
+	if parent := node.Parent(); parent != nil && parent.Type() == "unary_expression" {
+		node = parent
+	}
+	list := node.Parent()
+	if list == nil || list.Type() != "expression_list" || list.NamedChildCount() != 1 {
+		return ""
+	}
+	declaration := list.Parent()
+	if declaration == nil {
+		return ""
+	}
+	var left *sitter.Node
+	switch declaration.Type() {
+	case "short_var_declaration", "assignment_statement":
+		left = declaration.ChildByFieldName("left")
+		if left != nil && left.NamedChildCount() == 1 {
+			left = left.NamedChild(0)
+		}
+	case "var_spec":
+		left = declaration.ChildByFieldName("name")
+	}
+	if left == nil || left.Type() != "identifier" {
+		return ""
+	}
+	return left.Content(graph.src)
+}
+
+func (graph *goGraph) keyedValue(body *sitter.Node, key string) *sitter.Node {
+	for i := 0; i < int(body.NamedChildCount()); i++ {
+		element := body.NamedChild(i)
+		if element.Type() == "keyed_element" && element.NamedChildCount() == 2 && element.NamedChild(0).Content(graph.src) == key {
+			return element.NamedChild(1).NamedChild(0)
+		}
+	}
+	return nil
+}
+
+func (graph *goGraph) stringValue(node *sitter.Node) (string, bool) {
+	if node == nil {
+		return "", false
+	}
+	switch node.Type() {
+	case "interpreted_string_literal":
+		value, err := strconv.Unquote(node.Content(graph.src))
+		return value, err == nil
+	case "raw_string_literal":
+		return strings.Trim(node.Content(graph.src), "`"), true
+	}
+	return "", false
+}
+
+// stringList reads []string{"a", "b"}
+func (graph *goGraph) stringList(node *sitter.Node) []string {
+	var values []string
+	if node == nil || node.Type() != "composite_literal" {
+		return values
+	}
+	body := node.ChildByFieldName("body")
+	for i := 0; i < int(body.NamedChildCount()); i++ {
+		element := body.NamedChild(i)
+		if element.Type() == "literal_element" {
+			element = element.NamedChild(0)
+		}
+		if value, ok := graph.stringValue(element); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// enclosingFunction is the name of the function or method a node is in, empty at package level
+func enclosingFunction(node *sitter.Node, src []byte) string {
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Type() == "function_declaration" || parent.Type() == "method_declaration" {
+			return parent.ChildByFieldName("name").Content(src)
+		}
+	}
+	return ""
+}
+
+func scoped(function string, identifier string) string {
+	if function == "" {
+		return identifier
+	}
+	return function + "." + identifier
+}
+
+func namedChildren(node *sitter.Node) []*sitter.Node {
+	var children []*sitter.Node
+	if node == nil {
+		return children
+	}
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		children = append(children, node.NamedChild(i))
+	}
+	return children
+}
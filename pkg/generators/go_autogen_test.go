@@ -0,0 +1,143 @@
+package generators
+
+import (
+	"shcomp2/pkg/lib"
+)
+
+func (suite *Suite) TestGoFlagPackage() {
+	operations := parseGoSrc(lib.Dedent(`
+		package main
+
+		import "flag"
+
+		var verbose bool
+
+		func main() {
+			name := flag.String("name", "world", "who to greet")
+			flag.BoolVar(&verbose, "v", false, "print more output")
+			flag.Var(&list, "tag", "tags to add")
+			flag.Func("level", "log level", func(s string) error { return nil })
+			flag.Parse()
+		}
+	`))
+	suite.Require().Equal([]string{
+		`opt "-name" --help="who to greet"`,
+		`opt "-v" --help="print more output"`,
+		`opt "-tag" --help="tags to add"`,
+		`opt "-level" --help="log level"`,
+	}, operations)
+}
+
+func (suite *Suite) TestGoFlagSets() {
+	shell := suite.AutogenParseLang("go", `
+		package main
+
+		import (
+			"flag"
+			"os"
+		)
+
+		func main() {
+			serve := flag.NewFlagSet("serve", flag.ExitOnError)
+			port := serve.Int("port", 8080, "port to listen on")
+			build := flag.NewFlagSet("build", flag.ExitOnError)
+			build.Bool("race", false, "")
+			flag.Bool("debug", false, "")
+			flag.Parse()
+		}
+	`)
+	suite.RequireComplete(shell, "testcli ", "serve build -debug")
+	suite.RequireComplete(shell, "testcli serve -", "-port")
+	suite.RequireComplete(shell, "testcli build -", "-race")
+}
+
+func (suite *Suite) TestGoCobra() {
+	shell := suite.AutogenParseLang("go", `
+		package cmd
+
+		import "github.com/spf13/cobra"
+
+		var rootCmd = &cobra.Command{
+			Use:   "testcli",
+			Short: "a test cli",
+		}
+
+		var deployCmd = &cobra.Command{
+			Use:       "deploy [env]",
+			Short:     "deploy the app",
+			ValidArgs: []string{"staging", "production"},
+			Args:      cobra.ExactArgs(1),
+		}
+
+		func newRunCmd() *cobra.Command {
+			cmd := &cobra.Command{
+				Use:   "run",
+				Short: "run a task",
+			}
+			cmd.Flags().StringP("config", "c", "", "config file")
+			cmd.MarkFlagFilename("config", "yaml", "json")
+			flags := cmd.Flags()
+			flags.StringSlice("tag", nil, "tags")
+			return cmd
+		}
+
+		func init() {
+			rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "print more output")
+			deployCmd.Flags().Bool("dry-run", false, "")
+			rootCmd.AddCommand(deployCmd, newRunCmd())
+		}
+	`)
+	suite.RequireComplete(shell, "testcli ", "deploy    -- deploy the app run       -- run a task --verbose -- print more output -v        -- print more output")
+	suite.RequireComplete(shell, "testcli deploy ", "staging production --dry-run --verbose  -- print more output -v         -- print more output")
+	suite.RequireComplete(shell, "testcli deploy staging ", "--dry-run --verbose -- print more output -v        -- print more output")
+	suite.RequireComplete(shell, "testcli run --tag a --tag b -", "--config  -- config file -c        -- config file --tag     -- tags --verbose -- print more output -v        -- print more output")
+}
+
+func (suite *Suite) TestGoCobraRepeatedShorthand() {
+	shell := suite.AutogenParseLang("go", `
+		package cmd
+
+		import "github.com/spf13/cobra"
+
+		func NewRootCmd() *cobra.Command {
+			root := &cobra.Command{Use: "app"}
+			root.Flags().StringSliceP("tag", "t", nil, "")
+			root.Flags().CountP("verbose", "v", "")
+			return root
+		}
+	`)
+	suite.RequireComplete(shell, "testcli --", "--tag --verbose")
+	suite.RequireComplete(shell, "testcli -t a --tag b --", "--tag --verbose")
+	suite.RequireComplete(shell, "testcli -v -v --", "--tag --verbose")
+}
+
+func (suite *Suite) TestGoCobraOperations() {
+	operations := parseGoSrc(lib.Dedent(`
+		package cmd
+
+		import "github.com/spf13/cobra"
+
+		func NewRootCmd() *cobra.Command {
+			root := &cobra.Command{Use: "app"}
+			root.Flags().String("out", "", "")
+			root.MarkFlagDirname("out")
+			root.Flags().StringP("format", "f", "", "output format")
+			root.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"json", "yaml"}, cobra.ShellCompDirectiveNoFileComp))
+			root.Flags().CountP("verbose", "v", "")
+			root.AddCommand(NewVersionCmd())
+			return root
+		}
+
+		func NewVersionCmd() *cobra.Command {
+			cmd := &cobra.Command{Use: "version", Short: "print the version", Args: cobra.NoArgs}
+			return cmd
+		}
+	`))
+	suite.Require().Equal([]string{
+		`opt "--out" --complete=dir`,
+		`opt "--format|-f" --choices="json yaml" --help="output format"`,
+		`opt "--verbose" --nargs="*"`,
+		`opt "-v" --nargs="*"`,
+		`psr "version" --help="print the version"`,
+	}, operations)
+}
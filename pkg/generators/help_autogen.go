@@ -0,0 +1,324 @@
+package generators
+
+import (
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os/exec"
+	"regexp"
+	"shcomp2/pkg/lib"
+	"strings"
+)
+
+// GenerateHelpOperations adds the operations of a tool's --help output, autogen_lang=help
+func GenerateHelpOperations(cli lib.Cli) (lib.Cli, error) {
+	if cli.Config.AutogenHelpCmd == "" {
+		// help text from autogen_file or a closure can't be asked about its subcommands
+		return generateOperations(cli, parseHelpSrc)
+	}
+	words := lib.SplitWords(cli.Config.AutogenHelpCmd)
+	if len(words) == 0 {
+		// specs are checked when parsed, a Cli built another way can still get here
+		log.Warn().Str("autogen_help_cmd", cli.Config.AutogenHelpCmd).Msg("autogen_help_cmd is empty, nothing to generate")
+		return cli, nil
+	}
+	text, err := helpOutput(words)
+	if err != nil && text == "" {
+		return cli, fmt.Errorf("unable to run autogen_help_cmd: %w", err)
+	}
+	command := parseHelpText(text)
+	helpSubcommands(command, words, nil, text, cli.Config.AutogenHelpDepth)
+	return addOperations(cli, commandOperations(command, ""))
+}
+
+// helpSection is a heading like "Options:", "positional arguments:" or "Available Commands:"
+var helpSection = regexp.MustCompile(`^\S.*:\s*$`)
+
+// helpColumns separates an option or command from its description
+var helpColumns = regexp.MustCompile(`\t|\s{2,}`)
+
+var helpOptionName = regexp.MustCompile(`^--?[A-Za-z0-9][\w.-]*`)
+var helpCommandName = regexp.MustCompile(`^[A-Za-z0-9][\w.:-]*$`)
+
+const (
+	helpSectionOptions     = "options"
+	helpSectionCommands    = "commands"
+	helpSectionPositionals = "positionals"
+)
+
+func parseHelpSrc(src string) []string {
+	return commandOperations(parseHelpText(src), "")
+}
+
+// helpSubcommands replaces the subcommands listed in the help text with what `tool sub --help` says about them
+func helpSubcommands(command *autogenCommand, words []string, path []string, text string, depth int) {
+	if depth <= 0 {
+		return
+	}
+	for _, subcommand := range command.commands {
+		subPath := append(append([]string{}, path...), subcommand.name)
+		args := helpArgs(words, subPath)
+		subText, err := helpOutput(args)
+		if err != nil && subText == "" {
+			log.Warn().Err(err).Strs("cmd", args).Msg("unable to read subcommand help")
+			continue
+		}
+		// tools that don't know the subcommand often print their own help again
+		if subText == text {
+			continue
+		}
+		parsed := parseHelpText(subText)
+		subcommand.params = parsed.params
+		subcommand.commands = parsed.commands
+		for _, child := range subcommand.commands {
+			child.parent = subcommand
+		}
+		helpSubcommands(subcommand, words, subPath, subText, depth-1)
+	}
+}
+
+// helpOutput is what a help command prints to stdout and stderr, many tools exit non-zero after printing their help
+func helpOutput(args []string) (string, error) {
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	return string(out), err
+}
+
+// helpArgs puts the subcommand path before the help flags, `tool --help` becomes `tool sub --help`
+func helpArgs(words []string, path []string) []string {
+	i := len(words)
+	for i > 1 && strings.HasPrefix(words[i-1], "-") {
+		i--
+	}
+	var args []string
+	args = append(args, words[:i]...)
+	args = append(args, path...)
+	return append(args, words[i:]...)
+}
+
+// parseHelpText reads GNU, argparse, click and cobra style help into options, positionals and subcommands
+func parseHelpText(text string) *autogenCommand {
+	command := &autogenCommand{}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	seen := map[string]bool{}
+	section := helpSectionOptions
+	entryIndent := -1
+	// an argparse subparsers entry like {build,test} lists its commands below it
+	var subparsers []string
+	subparsersHelp := map[string]string{}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		if indent == 0 {
+			section = ""
+			entryIndent = -1
+			if helpSection.MatchString(line) {
+				section = sectionKind(line)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "-") {
+			param, ok := parseHelpOption(trimmed)
+			if !ok || seen[param.names[0]] {
+				continue
+			}
+			if param.help == "" {
+				param.help = continuationHelp(lines, i, indent)
+			}
+			for _, name := range param.names {
+				seen[name] = true
+			}
+			command.params = append(command.params, param)
+			continue
+		}
+
+		if entryIndent == -1 {
+			entryIndent = indent
+		}
+		spec, help := splitHelpColumns(trimmed)
+		if indent > entryIndent {
+			// a command listed under an argparse {build,test} entry, other deeper lines continue a description
+			if name := strings.Fields(spec); len(name) > 0 && contains(subparsers, name[0]) {
+				subparsersHelp[name[0]] = help
+			}
+			continue
+		}
+
+		switch section {
+		case helpSectionCommands:
+			for _, name := range commandNames(spec, help) {
+				command.commands = append(command.commands, &autogenCommand{identifier: name, name: name, help: help, parent: command})
+			}
+		case helpSectionPositionals:
+			if help == "" {
+				help = continuationHelp(lines, i, indent)
+			}
+			if strings.HasPrefix(spec, "{") && strings.HasSuffix(spec, "}") {
+				choices := strings.Split(strings.Trim(spec, "{}"), ",")
+				if isSubparsers(lines, i, indent, choices) {
+					subparsers = append(subparsers, choices...)
+					continue
+				}
+				command.params = append(command.params, autogenParam{choices: choices, help: help})
+			} else if name := strings.Fields(spec); len(name) == 1 {
+				param := autogenParam{help: help}
+				param.complete = metavarComplete(name[0])
+				command.params = append(command.params, param)
+			}
+		}
+	}
+
+	for _, name := range subparsers {
+		command.commands = append(command.commands, &autogenCommand{identifier: name, name: name, help: subparsersHelp[name], parent: command})
+	}
+	if len(command.commands) > 0 {
+		// positionals and subcommands can't share a parser, the subcommands are what's worth completing
+		var options []autogenParam
+		for _, param := range command.params {
+			if len(param.names) > 0 {
+				options = append(options, param)
+			}
+		}
+		command.params = options
+	}
+	return command
+}
+
+func sectionKind(heading string) string {
+	title := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(heading), ":"))
+	switch {
+	case strings.Contains(title, "command"):
+		return helpSectionCommands
+	case strings.Contains(title, "positional"), title == "arguments":
+		return helpSectionPositionals
+	case strings.HasPrefix(title, "usage"):
+		return ""
+	}
+	return helpSectionOptions
+}
+
+// parseHelpOption reads `-o, --output=FILE  description`, `-o OUT, --out OUT` and `--level {debug,info}`
+func parseHelpOption(line string) (autogenParam, bool) {
+	param := autogenParam{}
+	spec, help := splitHelpColumns(line)
+	param.help = help
+	for _, entry := range splitOutsideBraces(spec) {
+		entry = strings.TrimSpace(entry)
+		name := helpOptionName.FindString(entry)
+		if name == "" {
+			continue
+		}
+		if !contains(param.names, name) {
+			param.names = append(param.names, name)
+		}
+		metavar := strings.TrimLeft(entry[len(name):], " =[")
+		if fields := strings.Fields(metavar); len(fields) > 0 {
+			metavar = strings.TrimRight(fields[0], "]")
+		}
+		if strings.HasPrefix(metavar, "{") && strings.HasSuffix(metavar, "}") {
+			param.choices = strings.Split(strings.Trim(metavar, "{}"), ",")
+		} else if complete := metavarComplete(metavar); complete != "" {
+			param.complete = complete
+		} else if metavar != "" {
+			valueParam(&param)
+		}
+	}
+	return param, len(param.names) > 0
+}
+
+// metavarComplete guesses files and directories from argument names like FILE, PATH or DIR
+func metavarComplete(metavar string) string {
+	metavar = strings.ToUpper(strings.Trim(metavar, "<>[]=."))
+	switch {
+	case strings.Contains(metavar, "DIR"):
+		return lib.CompleteTypeDir
+	case strings.Contains(metavar, "FILE"), strings.Contains(metavar, "PATH"):
+		return lib.CompleteTypeFile
+	}
+	return ""
+}
+
+// commandNames is the name of a listed command, or every name of a comma separated list without descriptions
+func commandNames(spec string, help string) []string {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if !helpCommandName.MatchString(name) {
+			break
+		}
+		names = append(names, name)
+		if help != "" {
+			// the others are aliases like `remove, rm`
+			break
+		}
+	}
+	return names
+}
+
+// isSubparsers is true when the lines under {a,b} describe its choices
+func isSubparsers(lines []string, i int, indent int, choices []string) bool {
+	for _, line := range lines[i+1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || len(line)-len(trimmed) <= indent {
+			return false
+		}
+		if fields := strings.Fields(trimmed); contains(choices, fields[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// continuationHelp is the description argparse puts on the next line when the option is long
+func continuationHelp(lines []string, i int, indent int) string {
+	if i+1 >= len(lines) {
+		return ""
+	}
+	next := strings.TrimRight(lines[i+1], " \t")
+	trimmed := strings.TrimLeft(next, " \t")
+	if trimmed == "" || strings.HasPrefix(trimmed, "-") || len(next)-len(trimmed) <= indent {
+		return ""
+	}
+	return trimmed
+}
+
+func splitHelpColumns(line string) (string, string) {
+	if loc := helpColumns.FindStringIndex(line); loc != nil {
+		return line[:loc[0]], strings.TrimSpace(line[loc[1]:])
+	}
+	return line, ""
+}
+
+// splitOutsideBraces splits on commas that aren't part of a {a,b} choice set
+func splitOutsideBraces(spec string) []string {
+	var parts []string
+	depth := 0
+	start := 0
+	for i, r := range spec {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, spec[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, spec[start:])
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package generators
+
+import (
+	"shcomp2/pkg/lib"
+	"strings"
+)
+
+func (suite *Suite) TestHelpArgparse() {
+	operations := parseHelpSrc(strings.Join([]string{
+		`usage: tool [-h] [-v] [--level {debug,info}] [-o OUT] {build,test} ...`,
+		``,
+		`A tool.`,
+		``,
+		`positional arguments:`,
+		`  {build,test}`,
+		`    build               build the app`,
+		`    test                run the tests`,
+		``,
+		`options:`,
+		`  -h, --help            show this help message and exit`,
+		`  -v, --verbose         print more output`,
+		`  --level {debug,info}  log level`,
+		`  -o OUT, --out OUT     output file`,
+		`  --config-file CONFIG_FILE`,
+		`                        config file`,
+	}, "\n"))
+	suite.Require().Equal([]string{
+		`opt "-h|--help" --help="show this help message and exit"`,
+		`opt "-v|--verbose" --help="print more output"`,
+		`opt "--level" --choices="debug info" --help="log level"`,
+		`opt "-o|--out" --complete=value --help="output file"`,
+		`opt "--config-file" --complete=file --help="config file"`,
+		`psr "build" --help="build the app"`,
+		`psr "test" --help="run the tests"`,
+	}, operations)
+}
+
+func (suite *Suite) TestHelpGnu() {
+	operations := parseHelpSrc(strings.Join([]string{
+		`Usage: ls [OPTION]... [FILE]...`,
+		`List information about the FILEs (the current directory by default).`,
+		``,
+		`Mandatory arguments to long options are mandatory for short options too.`,
+		`  -a, --all                  do not ignore entries starting with .`,
+		`      --color[=WHEN]         color the output WHEN`,
+		`  -I, --ignore=PATTERN       do not list implied entries matching shell PATTERN`,
+		`      --hide=PATTERN         do not list implied entries matching shell PATTERN`,
+		`                               (overridden by -a or -A)`,
+		`      --help     display this help and exit`,
+	}, "\n"))
+	suite.Require().Equal([]string{
+		`opt "-a|--all" --help="do not ignore entries starting with ."`,
+		`opt "--color" --complete=value --help="color the output WHEN"`,
+		`opt "-I|--ignore" --complete=value --help="do not list implied entries matching shell PATTERN"`,
+		`opt "--hide" --complete=value --help="do not list implied entries matching shell PATTERN"`,
+		`opt "--help" --help="display this help and exit"`,
+	}, operations)
+}
+
+func (suite *Suite) TestHelpPositionals() {
+	operations := parseHelpSrc(strings.Join([]string{
+		`usage: convert [-h] {png,jpg} FILE`,
+		``,
+		`positional arguments:`,
+		`  {png,jpg}   output format`,
+		`  FILE`,
+		`              image to convert`,
+		``,
+		`options:`,
+		`  -h, --help  show this help message and exit`,
+	}, "\n"))
+	suite.Require().Equal([]string{
+		`pos --choices="png jpg" --help="output format"`,
+		`pos --complete=file --help="image to convert"`,
+		`opt "-h|--help" --help="show this help message and exit"`,
+	}, operations)
+}
+
+func (suite *Suite) TestHelpCmdSubcommands() {
+	tool := suite.CreateFile("tool", `
+		#!/usr/bin/env bash
+		case "$*" in
+		"remote --help")
+			printf '%s\n' \
+				'Usage:' \
+				'  tool remote [command]' \
+				'' \
+				'Available Commands:' \
+				'  add         Add a remote' \
+				'  remove, rm  Remove a remote' \
+				'' \
+				'Flags:' \
+				'  -v, --verbose   show urls'
+			;;
+		"remote add --help")
+			printf '%s\n' \
+				'Flags:' \
+				'      --fetch   fetch after adding'
+			;;
+		*)
+			printf '%s\n' \
+				'Usage:' \
+				'  tool [command]' \
+				'' \
+				'Available Commands:' \
+				'  help        Help about any command' \
+				'  remote      Manage remotes' \
+				'' \
+				'Flags:' \
+				'  -C, --dir DIR   run as if started in DIR'
+			;;
+		esac
+	`, 0744)
+
+	shell := suite.AutogenParseCfg(`
+		cfg cli_name=testcli
+		cfg autogen_lang=help
+		cfg autogen_help_cmd="%s --help"
+		cfg outfile=-
+	`, tool)
+	suite.RequireComplete(shell, "testcli --d", "--dir")
+	suite.RequireComplete(shell, "testcli r", "remote")
+	suite.RequireComplete(shell, "testcli remote r", "remove")
+	suite.RequireComplete(shell, "testcli remote -", "-v        -- show urls --verbose -- show urls")
+	suite.RequireComplete(shell, "testcli remote add --f", "")
+	// help prints the main help again so it has no options of its own
+	suite.RequireComplete(shell, "testcli help -", "")
+
+	shell = suite.AutogenParseCfg(`
+		cfg cli_name=testcli
+		cfg autogen_lang=help
+		cfg autogen_help_cmd="%s --help"
+		cfg autogen_help_depth=2
+		cfg outfile=-
+	`, tool)
+	suite.RequireComplete(shell, "testcli remote add --f", "--fetch")
+}
+
+func (suite *Suite) TestHelpCmdStderr() {
+	tool := suite.CreateFile("tool", `
+		#!/usr/bin/env bash
+		printf '%s\n' \
+			'Options:' \
+			'  --name NAME   who to greet' \
+			'  --loud        shout' >&2
+		exit 2
+	`, 0744)
+
+	shell := suite.AutogenParseCfg(`
+		cfg cli_name=testcli
+		cfg autogen_lang=help
+		cfg autogen_help_cmd="%s --help"
+		cfg outfile=-
+	`, tool)
+	suite.RequireComplete(shell, "testcli --n", "--name")
+	suite.RequireComplete(shell, "testcli --name x -", "--loud")
+	suite.RequireComplete(shell, "testcli --name ", "")
+
+	cli, err := lib.ParseOperations("cfg cli_name=testcli\ncfg autogen_lang=help\ncfg autogen_help_cmd=/nonexistent/tool")
+	suite.Require().NoError(err)
+	_, err = GenerateHelpOperations(cli)
+	suite.Require().EqualError(err, "unable to run autogen_help_cmd: fork/exec /nonexistent/tool: no such file or directory")
+}
+
+func (suite *Suite) TestHelpCmdEmpty() {
+	_, err := lib.ParseOperations("cfg cli_name=testcli\ncfg autogen_lang=help\ncfg autogen_help_cmd=\"  \"")
+	suite.Require().EqualError(err, "3:5: autogen_help_cmd is empty, expected a command like tool --help")
+
+	cli, err := lib.ParseOperations("cfg cli_name=testcli\nopt --verbose")
+	suite.Require().NoError(err)
+	cli.Config.AutogenLang = "help"
+	cli.Config.AutogenHelpCmd = " "
+	suite.Require().NotPanics(func() {
+		generated, err := GenerateHelpOperations(cli)
+		suite.Require().NoError(err)
+		suite.Require().Equal(cli.Operations, generated.Operations)
+	})
+}
+
+func (suite *Suite) TestHelpArgs() {
+	suite.Require().Equal([]string{"tool", "remote", "add", "--help"}, helpArgs([]string{"tool", "--help"}, []string{"remote", "add"}))
+	suite.Require().Equal([]string{"tool", "help", "remote"}, helpArgs([]string{"tool", "help"}, []string{"remote"}))
+	suite.Require().Equal([]string{"python", "-m", "tool", "remote", "-h"}, helpArgs([]string{"python", "-m", "tool", "-h"}, []string{"remote"}))
+}
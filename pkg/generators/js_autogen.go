@@ -0,0 +1,805 @@
+package generators
+
+import (
+	"context"
+	"github.com/rs/zerolog/log"
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/javascript"
+	"github.com/smacker/go-tree-sitter/typescript/typescript"
+	"regexp"
+	"shcomp2/pkg/lib"
+	"strings"
+)
+
+// GenerateJavaScriptOperations adds the operations of a commander or yargs cli, autogen_lang=js
+func GenerateJavaScriptOperations(cli lib.Cli) (lib.Cli, error) {
+	return generateOperations(cli, parseJavaScriptSrc)
+}
+
+// jsFlagSeparator splits commander flags like "-f, --force" and "-c|--cheese <type>"
+var jsFlagSeparator = regexp.MustCompile(`[\s,|]+`)
+
+type jsGraph struct {
+	src []byte
+	// commands by variable, builder parameters shadow them while their body is read
+	commands map[string]*autogenCommand
+	// functions that build and return a command, like makeRunCommand
+	constructors map[string]*autogenCommand
+	// commander Option and Argument objects by variable
+	params map[string]*autogenParam
+	// strings, arrays and objects by variable so `.choices(envs)` can be read
+	constants map[string]*sitter.Node
+	info      map[*autogenCommand]*jsCommand
+	sequence  []*autogenCommand
+}
+
+type jsCommand struct {
+	yargs bool
+	// indexes of params by yargs key or argument name so later calls can add to them
+	options     map[string]int
+	positionals map[string]int
+}
+
+func parseJavaScriptSrc(srcStr string) []string {
+	src := []byte(srcStr)
+	root := parseJavaScriptTree(src)
+
+	graph := jsGraph{
+		src:          src,
+		commands:     map[string]*autogenCommand{},
+		constructors: map[string]*autogenCommand{},
+		params:       map[string]*autogenParam{},
+		constants:    map[string]*sitter.Node{},
+		info:         map[*autogenCommand]*jsCommand{},
+	}
+	// functions are hoisted, read them first so calls before their declaration find the command
+	var statements []*sitter.Node
+	for _, statement := range namedChildren(root) {
+		declaration := statement
+		if declaration.Type() == "export_statement" && declaration.ChildByFieldName("declaration") != nil {
+			declaration = declaration.ChildByFieldName("declaration")
+		}
+		if declaration.Type() == "function_declaration" {
+			graph.visit(declaration)
+		} else {
+			statements = append(statements, statement)
+		}
+	}
+	for _, statement := range statements {
+		graph.visit(statement)
+	}
+
+	var base *autogenCommand
+	for _, command := range graph.sequence {
+		if command.parent != nil {
+			continue
+		}
+		if base == nil {
+			base = command
+		}
+		// a require('yargs') or new Command() that's never used doesn't hide the real cli
+		if len(command.params) > 0 || len(command.commands) > 0 {
+			base = command
+			break
+		}
+	}
+	if base == nil {
+		log.Warn().Msg("no commander program or yargs instance found")
+		return nil
+	}
+	base.name = ""
+	return commandOperations(base, "")
+}
+
+// parseJavaScriptTree parses javascript and falls back to typescript when the source has type annotations
+func parseJavaScriptTree(src []byte) *sitter.Node {
+	parser := sitter.NewParser()
+	parser.SetLanguage(javascript.GetLanguage())
+	tree, _ := parser.ParseCtx(context.Background(), nil, src)
+	if !tree.RootNode().HasError() {
+		return tree.RootNode()
+	}
+	parser.SetLanguage(typescript.GetLanguage())
+	tsTree, _ := parser.ParseCtx(context.Background(), nil, src)
+	if tsTree.RootNode().HasError() {
+		return tree.RootNode()
+	}
+	return tsTree.RootNode()
+}
+
+// visit reads statements in source order, a chain that starts at a command is read as a whole
+func (graph *jsGraph) visit(node *sitter.Node) {
+	switch node.Type() {
+	case "variable_declarator":
+		if graph.bind(node.ChildByFieldName("name"), node.ChildByFieldName("value")) {
+			return
+		}
+	case "assignment_expression":
+		if graph.bind(node.ChildByFieldName("left"), node.ChildByFieldName("right")) {
+			return
+		}
+	case "call_expression":
+		if graph.command(node) != nil {
+			return
+		}
+	case "return_statement":
+		if node.NamedChildCount() > 0 {
+			if command := graph.command(node.NamedChild(0)); command != nil {
+				if function := enclosingJavaScriptFunction(node, graph.src); function != "" {
+					graph.constructors[function] = command
+				}
+				return
+			}
+		}
+	}
+	for _, child := range namedChildren(node) {
+		graph.visit(child)
+	}
+}
+
+// bind remembers what a variable holds, false when the value still has to be visited
+func (graph *jsGraph) bind(name *sitter.Node, value *sitter.Node) bool {
+	if name == nil || value == nil || name.Type() != "identifier" {
+		return false
+	}
+	identifier := name.Content(graph.src)
+	switch unwrap(value).Type() {
+	case "string", "template_string", "array", "object":
+		graph.constants[identifier] = unwrap(value)
+		return false
+	}
+	if command := graph.command(value); command != nil {
+		graph.commands[identifier] = command
+		return true
+	}
+	if param := graph.param(value); param != nil {
+		graph.params[identifier] = param
+		return true
+	}
+	return false
+}
+
+// command reads an expression that evaluates to a commander command or yargs instance, nil otherwise
+func (graph *jsGraph) command(node *sitter.Node) *autogenCommand {
+	node = unwrap(node)
+	switch node.Type() {
+	case "identifier":
+		identifier := node.Content(graph.src)
+		if command, ok := graph.commands[identifier]; ok {
+			return command
+		}
+		// the global program of commander and the yargs singleton
+		switch identifier {
+		case "program":
+			return graph.singleton(identifier, false)
+		case "yargs":
+			return graph.singleton(identifier, true)
+		}
+	case "member_expression":
+		if node.ChildByFieldName("property").Content(graph.src) == "program" && graph.isModule(node.ChildByFieldName("object"), "commander") {
+			return graph.singleton("program", false)
+		}
+	case "new_expression":
+		if lastName(node.ChildByFieldName("constructor").Content(graph.src)) == "Command" {
+			name, _ := graph.stringValue(firstArgument(node))
+			return graph.newCommand(name, false)
+		}
+	case "call_expression":
+		function := unwrap(node.ChildByFieldName("function"))
+		args := callArguments(node)
+		switch function.Type() {
+		case "member_expression":
+			receiver := graph.command(function.ChildByFieldName("object"))
+			if receiver == nil {
+				return nil
+			}
+			method := function.ChildByFieldName("property").Content(graph.src)
+			if graph.info[receiver].yargs {
+				return graph.yargsMethod(receiver, method, args)
+			}
+			return graph.commanderMethod(receiver, method, args)
+		case "identifier":
+			switch function.Content(graph.src) {
+			case "createCommand":
+				name, _ := graph.stringValue(firstArgument(node))
+				return graph.newCommand(name, false)
+			case "require":
+				if graph.isModule(node, "yargs") || graph.isModule(node, "yargs/yargs") {
+					return graph.singleton("yargs", true)
+				}
+				return nil
+			}
+			if command, ok := graph.constructors[function.Content(graph.src)]; ok {
+				return command
+			}
+		}
+		// yargs(hideBin(process.argv)) and require('yargs/yargs')(process.argv.slice(2))
+		if command := graph.command(function); command != nil && graph.info[command].yargs {
+			return command
+		}
+	}
+	return nil
+}
+
+// commanderMethod applies a method of a commander command and returns what it returns
+func (graph *jsGraph) commanderMethod(command *autogenCommand, method string, args []*sitter.Node) *autogenCommand {
+	switch method {
+	case "command":
+		spec, _ := graph.stringValue(argument(args, 0))
+		fields := strings.Fields(spec)
+		if len(fields) == 0 {
+			return command
+		}
+		subcommand := graph.newCommand(fields[0], false)
+		graph.addSubcommand(command, subcommand)
+		for _, field := range fields[1:] {
+			graph.addArgument(subcommand, field, "")
+		}
+		// a description makes it a stand-alone executable subcommand and returns the parent
+		if help, ok := graph.stringValue(argument(args, 1)); ok {
+			subcommand.help = firstLine(help)
+			return command
+		}
+		return subcommand
+	case "addCommand":
+		if subcommand := graph.command(argument(args, 0)); subcommand != nil {
+			graph.addSubcommand(command, subcommand)
+		}
+	case "name":
+		if name, ok := graph.stringValue(argument(args, 0)); ok {
+			command.name = name
+		}
+	case "description", "summary":
+		// the summary is the short help, a description only fills in when there is none
+		if help, ok := graph.stringValue(argument(args, 0)); ok && (method == "summary" || command.help == "") {
+			command.help = firstLine(help)
+		}
+	case "option", "requiredOption":
+		flags, _ := graph.stringValue(argument(args, 0))
+		help, _ := graph.stringValue(argument(args, 1))
+		if param := commanderOption(flags, help); len(param.names) > 0 {
+			command.params = append(command.params, param)
+		}
+	case "addOption":
+		if param := graph.param(argument(args, 0)); param != nil && len(param.names) > 0 {
+			command.params = append(command.params, *param)
+		}
+	case "argument":
+		spec, _ := graph.stringValue(argument(args, 0))
+		help, _ := graph.stringValue(argument(args, 1))
+		graph.addArgument(command, spec, help)
+	case "arguments":
+		spec, _ := graph.stringValue(argument(args, 0))
+		for _, field := range strings.Fields(spec) {
+			graph.addArgument(command, field, "")
+		}
+	case "addArgument":
+		if param := graph.param(argument(args, 0)); param != nil && len(param.names) == 0 {
+			command.params = append(command.params, *param)
+		}
+	}
+	return command
+}
+
+// param reads a commander `new Option(flags, description)` or `new Argument(name, description)` and its chain
+func (graph *jsGraph) param(node *sitter.Node) *autogenParam {
+	node = unwrap(node)
+	switch node.Type() {
+	case "identifier":
+		return graph.params[node.Content(graph.src)]
+	case "new_expression", "call_expression":
+		var kind string
+		var args []*sitter.Node
+		if node.Type() == "new_expression" {
+			kind = lastName(node.ChildByFieldName("constructor").Content(graph.src))
+			args = callArguments(node)
+		} else {
+			function := unwrap(node.ChildByFieldName("function"))
+			args = callArguments(node)
+			if function.Type() == "member_expression" {
+				param := graph.param(function.ChildByFieldName("object"))
+				if param == nil {
+					return nil
+				}
+				switch function.ChildByFieldName("property").Content(graph.src) {
+				case "choices":
+					param.choices = graph.stringList(argument(args, 0))
+				case "hideHelp":
+					param.help = ""
+				}
+				return param
+			}
+			kind = strings.TrimPrefix(function.Content(graph.src), "create")
+		}
+		spec, _ := graph.stringValue(argument(args, 0))
+		help, _ := graph.stringValue(argument(args, 1))
+		switch kind {
+		case "Option":
+			param := commanderOption(spec, help)
+			return &param
+		case "Argument":
+			_, param := argumentParam(spec)
+			param.help = help
+			return &param
+		}
+	}
+	return nil
+}
+
+// yargsMethod applies a method of a yargs instance, they all return the instance
+func (graph *jsGraph) yargsMethod(command *autogenCommand, method string, args []*sitter.Node) *autogenCommand {
+	switch method {
+	case "command", "commands":
+		graph.yargsCommand(command, args)
+	case "option", "options":
+		graph.keyed(args, func(key string, value *sitter.Node) {
+			graph.applyYargsOptions(graph.yargsOption(command, key), graph.objectValue(value), true)
+		})
+	case "positional":
+		key, _ := graph.stringValue(argument(args, 0))
+		if key != "" {
+			graph.applyYargsOptions(graph.yargsPositional(command, key), graph.objectValue(argument(args, 1)), false)
+		}
+	case "choices":
+		graph.keyed(args, func(key string, value *sitter.Node) {
+			graph.yargsParam(command, key).choices = graph.stringList(value)
+		})
+	case "alias":
+		graph.keyed(args, func(key string, value *sitter.Node) {
+			param := graph.yargsOption(command, key)
+			param.names = append(param.names, yargsNames(graph.stringList(value))...)
+		})
+	case "describe":
+		graph.keyed(args, func(key string, value *sitter.Node) {
+			if help, ok := graph.stringValue(value); ok {
+				graph.yargsParam(command, key).help = firstLine(help)
+			}
+		})
+	case "array", "count":
+		graph.keyed(args, func(key string, value *sitter.Node) {
+			graph.yargsOption(command, key).nargs = "*"
+		})
+	case "normalize":
+		graph.keyed(args, func(key string, value *sitter.Node) {
+			graph.yargsParam(command, key).complete = lib.CompleteTypeFile
+		})
+	}
+	return command
+}
+
+// yargsCommand reads `.command(cmd, desc, builder, handler)` and `.command({command, describe, builder})`
+func (graph *jsGraph) yargsCommand(command *autogenCommand, args []*sitter.Node) {
+	var spec, help, builder *sitter.Node
+	if module := graph.objectValue(argument(args, 0)); module != nil {
+		pairs := graph.objectPairs(module)
+		spec = pairs["command"]
+		help = firstNode(pairs["describe"], pairs["description"], pairs["desc"])
+		builder = pairs["builder"]
+	} else {
+		spec, help, builder = argument(args, 0), argument(args, 1), argument(args, 2)
+	}
+
+	var fields []string
+	if spec != nil && unwrap(spec).Type() == "array" {
+		// the first of ['serve', 's'] is the name, the others are aliases
+		if names := graph.stringList(spec); len(names) > 0 {
+			fields = strings.Fields(names[0])
+		}
+	} else {
+		name, _ := graph.stringValue(spec)
+		fields = strings.Fields(name)
+	}
+	if len(fields) == 0 {
+		return
+	}
+
+	// $0 is the default command, its positionals and options belong to the parent
+	target := command
+	if fields[0] != "$0" {
+		target = graph.newCommand(fields[0], true)
+		graph.addSubcommand(command, target)
+		if description, ok := graph.stringValue(help); ok {
+			target.help = firstLine(description)
+		}
+	}
+	for _, field := range fields[1:] {
+		graph.addArgument(target, field, "")
+	}
+
+	if builder == nil {
+		return
+	}
+	builder = unwrap(builder)
+	switch builder.Type() {
+	case "arrow_function", "function", "function_expression":
+		graph.visitBuilder(builder, target)
+	default:
+		if options := graph.objectValue(builder); options != nil {
+			graph.eachPair(options, func(key string, value *sitter.Node) {
+				graph.applyYargsOptions(graph.yargsOption(target, key), graph.objectValue(value), true)
+			})
+		}
+	}
+}
+
+// visitBuilder reads the body of a builder with its parameter bound to the command it builds
+func (graph *jsGraph) visitBuilder(builder *sitter.Node, command *autogenCommand) {
+	parameter := builder.ChildByFieldName("parameter")
+	if parameters := builder.ChildByFieldName("parameters"); parameter == nil && parameters != nil && parameters.NamedChildCount() > 0 {
+		parameter = parameters.NamedChild(0)
+		// typescript wraps parameters to hold their type
+		if pattern := parameter.ChildByFieldName("pattern"); pattern != nil {
+			parameter = pattern
+		}
+	}
+	body := builder.ChildByFieldName("body")
+	if body == nil {
+		return
+	}
+	if parameter == nil || parameter.Type() != "identifier" {
+		graph.visit(body)
+		return
+	}
+
+	identifier := parameter.Content(graph.src)
+	shadowed, ok := graph.commands[identifier]
+	graph.commands[identifier] = command
+	graph.visit(body)
+	if ok {
+		graph.commands[identifier] = shadowed
+	} else {
+		delete(graph.commands, identifier)
+	}
+}
+
+// applyYargsOptions reads an options object like {alias: 'v', describe: '...', choices: [...]}
+func (graph *jsGraph) applyYargsOptions(param *autogenParam, options *sitter.Node, isOption bool) {
+	if options == nil {
+		return
+	}
+	graph.eachPair(options, func(key string, value *sitter.Node) {
+		switch key {
+		case "alias":
+			if isOption {
+				if alias, ok := graph.stringValue(value); ok {
+					param.names = append(param.names, yargsNames([]string{alias})...)
+				} else {
+					param.names = append(param.names, yargsNames(graph.stringList(value))...)
+				}
+			}
+		case "describe", "description", "desc":
+			if help, ok := graph.stringValue(value); ok {
+				param.help = firstLine(help)
+			}
+		case "choices":
+			param.choices = graph.stringList(value)
+		case "type":
+			if kind, _ := graph.stringValue(value); isOption && (kind == "array" || kind == "count") {
+				param.nargs = "*"
+			}
+		case "array", "count":
+			if isOption && value.Type() == "true" {
+				param.nargs = "*"
+			}
+		case "normalize":
+			if value.Type() == "true" {
+				param.complete = lib.CompleteTypeFile
+			}
+		}
+	})
+}
+
+// keyed calls fn for each key of `.method(key, value)`, `.method({key: value})` or `.method([keys])`
+func (graph *jsGraph) keyed(args []*sitter.Node, fn func(key string, value *sitter.Node)) {
+	first := argument(args, 0)
+	if object := graph.objectValue(first); object != nil {
+		graph.eachPair(object, fn)
+		return
+	}
+	if first != nil && unwrap(first).Type() == "array" {
+		for _, key := range graph.stringList(first) {
+			fn(key, nil)
+		}
+		return
+	}
+	if key, ok := graph.stringValue(first); ok {
+		fn(key, argument(args, 1))
+	}
+}
+
+// yargsParam is the positional or option of a key, a key nothing declared yet is an option
+func (graph *jsGraph) yargsParam(command *autogenCommand, key string) *autogenParam {
+	if i, ok := graph.info[command].positionals[key]; ok {
+		return &command.params[i]
+	}
+	return graph.yargsOption(command, key)
+}
+
+func (graph *jsGraph) yargsOption(command *autogenCommand, key string) *autogenParam {
+	info := graph.info[command]
+	if i, ok := info.options[key]; ok {
+		return &command.params[i]
+	}
+	info.options[key] = len(command.params)
+	command.params = append(command.params, autogenParam{names: yargsNames([]string{key})})
+	return &command.params[len(command.params)-1]
+}
+
+func (graph *jsGraph) yargsPositional(command *autogenCommand, key string) *autogenParam {
+	info := graph.info[command]
+	if i, ok := info.positionals[key]; ok {
+		return &command.params[i]
+	}
+	info.positionals[key] = len(command.params)
+	command.params = append(command.params, autogenParam{})
+	return &command.params[len(command.params)-1]
+}
+
+// addArgument adds a positional from `<name>`, `[name]` or the variadic `<name...>` and `[name..]`
+func (graph *jsGraph) addArgument(command *autogenCommand, spec string, help string) {
+	if spec == "" {
+		return
+	}
+	key, param := argumentParam(spec)
+	param.help = help
+	info := graph.info[command]
+	if _, ok := info.positionals[key]; ok {
+		return
+	}
+	info.positionals[key] = len(command.params)
+	command.params = append(command.params, param)
+}
+
+func (graph *jsGraph) newCommand(name string, yargs bool) *autogenCommand {
+	command := &autogenCommand{identifier: name, name: name}
+	graph.info[command] = &jsCommand{yargs: yargs, options: map[string]int{}, positionals: map[string]int{}}
+	graph.sequence = append(graph.sequence, command)
+	return command
+}
+
+func (graph *jsGraph) singleton(identifier string, yargs bool) *autogenCommand {
+	command := graph.newCommand("", yargs)
+	graph.commands[identifier] = command
+	return command
+}
+
+func (graph *jsGraph) addSubcommand(parent *autogenCommand, subcommand *autogenCommand) {
+	if subcommand.parent != nil || subcommand == parent {
+		return
+	}
+	subcommand.parent = parent
+	parent.commands = append(parent.commands, subcommand)
+}
+
+// isModule is true for `require('module')` and a variable it's assigned to
+func (graph *jsGraph) isModule(node *sitter.Node, module string) bool {
+	node = unwrap(node)
+	if node.Type() == "identifier" {
+		return node.Content(graph.src) == module
+	}
+	if node.Type() != "call_expression" || node.ChildByFieldName("function").Content(graph.src) != "require" {
+		return false
+	}
+	name, _ := graph.stringValue(firstArgument(node))
+	return name == module
+}
+
+// commanderOption reads flags like "-p, --port <number>", a variadic value can be given many times
+func commanderOption(flags string, help string) autogenParam {
+	param := autogenParam{help: firstLine(help)}
+	for _, flag := range jsFlagSeparator.Split(strings.TrimSpace(flags), -1) {
+		if strings.HasPrefix(flag, "-") {
+			param.names = append(param.names, flag)
+		} else if strings.HasSuffix(strings.TrimRight(flag, ">]"), "...") {
+			param.nargs = "*"
+		}
+	}
+	return param
+}
+
+// argumentParam reads `<name>` or `[name...]` into its name and a positional
+func argumentParam(spec string) (string, autogenParam) {
+	param := autogenParam{}
+	required := strings.HasPrefix(spec, "<")
+	name := strings.Trim(spec, "<>[]")
+	if strings.HasSuffix(name, "..") {
+		name = strings.TrimRight(name, ".")
+		if required {
+			param.nargs = "+"
+		} else {
+			param.nargs = "*"
+		}
+	}
+	return name, param
+}
+
+// yargsNames turns keys into options, single letters are -v and words are --verbose
+func yargsNames(keys []string) []string {
+	var names []string
+	for _, key := range keys {
+		switch {
+		case strings.HasPrefix(key, "-"):
+			names = append(names, key)
+		case len(key) == 1:
+			names = append(names, "-"+key)
+		default:
+			names = append(names, "--"+key)
+		}
+	}
+	return names
+}
+
+func (graph *jsGraph) stringValue(node *sitter.Node) (string, bool) {
+	node = graph.constant(node)
+	if node == nil {
+		return "", false
+	}
+	content := node.Content(graph.src)
+	switch node.Type() {
+	case "string":
+		return unescapeJavaScript(content[1 : len(content)-1]), true
+	case "template_string":
+		for _, child := range namedChildren(node) {
+			if child.Type() == "template_substitution" {
+				return "", false
+			}
+		}
+		return unescapeJavaScript(content[1 : len(content)-1]), true
+	}
+	return "", false
+}
+
+// stringList reads ['a', 'b'], values that aren't strings are skipped
+func (graph *jsGraph) stringList(node *sitter.Node) []string {
+	var values []string
+	node = graph.constant(node)
+	if node == nil || node.Type() != "array" {
+		return values
+	}
+	for _, element := range namedChildren(node) {
+		if value, ok := graph.stringValue(element); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func (graph *jsGraph) objectValue(node *sitter.Node) *sitter.Node {
+	node = graph.constant(node)
+	if node == nil || node.Type() != "object" {
+		return nil
+	}
+	return node
+}
+
+func (graph *jsGraph) objectPairs(object *sitter.Node) map[string]*sitter.Node {
+	pairs := map[string]*sitter.Node{}
+	graph.eachPair(object, func(key string, value *sitter.Node) {
+		pairs[key] = value
+	})
+	return pairs
+}
+
+// eachPair calls fn for the pairs of an object in source order so the operations are stable
+func (graph *jsGraph) eachPair(object *sitter.Node, fn func(key string, value *sitter.Node)) {
+	for _, pair := range namedChildren(object) {
+		if pair.Type() != "pair" {
+			continue
+		}
+		if key, ok := graph.propertyKey(pair.ChildByFieldName("key")); ok {
+			fn(key, pair.ChildByFieldName("value"))
+		}
+	}
+}
+
+func (graph *jsGraph) propertyKey(key *sitter.Node) (string, bool) {
+	if key == nil {
+		return "", false
+	}
+	if key.Type() == "property_identifier" {
+		return key.Content(graph.src), true
+	}
+	return graph.stringValue(key)
+}
+
+// constant follows a variable to the literal it holds
+func (graph *jsGraph) constant(node *sitter.Node) *sitter.Node {
+	if node == nil {
+		return nil
+	}
+	node = unwrap(node)
+	if node.Type() == "identifier" {
+		return graph.constants[node.Content(graph.src)]
+	}
+	return node
+}
+
+// enclosingJavaScriptFunction is the name of the function a node is in, `function f()` or `const f = () =>`
+func enclosingJavaScriptFunction(node *sitter.Node, src []byte) string {
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		switch parent.Type() {
+		case "function_declaration", "method_definition":
+			return parent.ChildByFieldName("name").Content(src)
+		case "arrow_function", "function", "function_expression":
+			if declarator := parent.Parent(); declarator != nil && declarator.Type() == "variable_declarator" {
+				return declarator.ChildByFieldName("name").Content(src)
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// unwrap removes parentheses and typescript `as`, `satisfies` and `!`
+func unwrap(node *sitter.Node) *sitter.Node {
+	for node != nil {
+		switch node.Type() {
+		case "parenthesized_expression", "as_expression", "satisfies_expression", "non_null_expression", "await_expression":
+			if node.NamedChildCount() == 0 {
+				return node
+			}
+			node = node.NamedChild(0)
+		default:
+			return node
+		}
+	}
+	return node
+}
+
+func unescapeJavaScript(str string) string {
+	if !strings.Contains(str, `\`) {
+		return str
+	}
+	var builder strings.Builder
+	escaped := false
+	for _, r := range str {
+		if escaped {
+			switch r {
+			case 'n':
+				builder.WriteRune('\n')
+			case 't':
+				builder.WriteRune('\t')
+			default:
+				builder.WriteRune(r)
+			}
+			escaped = false
+		} else if r == '\\' {
+			escaped = true
+		} else {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+func callArguments(call *sitter.Node) []*sitter.Node {
+	args := call.ChildByFieldName("arguments")
+	if args == nil || args.Type() != "arguments" {
+		return nil
+	}
+	return namedChildren(args)
+}
+
+func argument(args []*sitter.Node, i int) *sitter.Node {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+func firstArgument(call *sitter.Node) *sitter.Node {
+	return argument(callArguments(call), 0)
+}
+
+func firstNode(nodes ...*sitter.Node) *sitter.Node {
+	for _, node := range nodes {
+		if node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
+func firstLine(str string) string {
+	return strings.TrimSpace(strings.SplitN(strings.TrimSpace(str), "\n", 2)[0])
+}
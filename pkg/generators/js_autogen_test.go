@@ -0,0 +1,162 @@
+package generators
+
+import (
+	"shcomp2/pkg/lib"
+)
+
+func (suite *Suite) TestCommander() {
+	shell := suite.AutogenParseLang("js", `
+		const { program, Option } = require('commander');
+
+		program
+			.name('testcli')
+			.option('-c, --config <file>')
+			.addOption(new Option('--level <level>').choices(['debug', 'info']));
+
+		program.command('deploy')
+			.description('deploy the app')
+			.argument('<env>')
+			.option('--dry-run');
+
+		program.command('copy <files...>').summary('copy files');
+		program.parse();
+	`)
+	suite.RequireComplete(shell, "testcli ", "deploy   -- deploy the app copy     -- copy files -c --config --level")
+	suite.RequireComplete(shell, "testcli --level ", "debug info")
+	suite.RequireComplete(shell, "testcli deploy -", "--dry-run")
+}
+
+func (suite *Suite) TestCommanderRepeatedAlias() {
+	shell := suite.AutogenParseLang("js", `
+		const { program } = require('commander');
+
+		program
+			.option('-t, --tag <tags...>', 'tags to add')
+			.option('-d, --debug');
+		program.parse();
+	`)
+	suite.RequireComplete(shell, "testcli --", "--tag   -- tags to add --debug")
+	suite.RequireComplete(shell, "testcli -t a --tag b --", "--tag   -- tags to add --debug")
+}
+
+func (suite *Suite) TestCommanderOperations() {
+	operations := parseJavaScriptSrc(lib.Dedent(`
+		const { Command, Option, Argument } = require('commander');
+		const program = new Command();
+
+		const envs = ['staging', 'production'];
+		program
+			.option('-v, --verbose', 'print more output')
+			.requiredOption('-p|--port <number>', 'port to use');
+
+		const deploy = program.command('deploy');
+		deploy.description('deploy the app\n\nLonger description.');
+		deploy.addArgument(new Argument('<env>', 'where to deploy').choices(envs));
+		deploy.option('--tag <tags...>', 'tags to add');
+
+		program.command('copy <src...> [dst]');
+		program.command('install [pkg]', 'install a package');
+		program.addCommand(makeRemote());
+		program.parse(process.argv);
+
+		function makeRemote() {
+			const remote = new Command('remote');
+			remote.command('add').arguments('<name> <url>');
+			return remote;
+		}
+	`))
+	suite.Require().Equal([]string{
+		`opt "-v|--verbose" --help="print more output"`,
+		`opt "-p|--port" --help="port to use"`,
+		`psr "deploy" --help="deploy the app"`,
+		`pos -p="deploy" --choices="staging production" --help="where to deploy"`,
+		`opt -p="deploy" "--tag" --nargs="*" --help="tags to add"`,
+		`psr "copy"`,
+		`pos -p="copy" --nargs="+"`,
+		`pos -p="copy"`,
+		`psr "install" --help="install a package"`,
+		`pos -p="install"`,
+		`psr "remote"`,
+		`psr -p="remote" "add"`,
+		`pos -p="remote.add"`,
+		`pos -p="remote.add"`,
+	}, operations)
+}
+
+func (suite *Suite) TestYargs() {
+	shell := suite.AutogenParseLang("js", `
+		const yargs = require('yargs/yargs');
+		const { hideBin } = require('yargs/helpers');
+
+		yargs(hideBin(process.argv))
+			.command('serve [port]', 'start the server', (yargs) => {
+				return yargs.positional('port', {choices: ['80', '8080']});
+			}, (argv) => {})
+			.command('build', 'build the app', {minify: {alias: 'm'}})
+			.option('verbose', {alias: 'v', type: 'boolean'})
+			.parse();
+	`)
+	suite.RequireComplete(shell, "testcli ", "serve     -- start the server build     -- build the app --verbose -v")
+	suite.RequireComplete(shell, "testcli serve ", "80 8080")
+	suite.RequireComplete(shell, "testcli build -", "--minify -m")
+}
+
+func (suite *Suite) TestYargsOperations() {
+	operations := parseJavaScriptSrc(lib.Dedent(`
+		import yargs from 'yargs';
+		import { hideBin } from 'yargs/helpers';
+
+		const remote = {
+			command: ['remote', 'r'],
+			describe: 'manage remotes',
+			builder: (y) => y.command('add <name> <urls..>', 'add a remote'),
+		};
+
+		yargs(hideBin(process.argv))
+			.command('$0 [files..]', 'lint files')
+			.command(remote)
+			.option('config', {alias: 'c', describe: 'config file', normalize: true})
+			.options({
+				format: {choices: ['json', 'yaml'], description: 'output format'},
+				ignore: {type: 'array'},
+			})
+			.count('v')
+			.describe('v', 'verbosity')
+			.choices('files', ['a.js', 'b.js'])
+			.parse();
+	`))
+	suite.Require().Equal([]string{
+		`pos --choices="a.js b.js" --nargs="*"`,
+		`opt "--config|-c" --complete=file --help="config file"`,
+		`opt "--format" --choices="json yaml" --help="output format"`,
+		`opt "--ignore" --nargs="*"`,
+		`opt "-v" --nargs="*" --help="verbosity"`,
+		`psr "remote" --help="manage remotes"`,
+		`psr -p="remote" "add" --help="add a remote"`,
+		`pos -p="remote.add"`,
+		`pos -p="remote.add" --nargs="+"`,
+	}, operations)
+}
+
+func (suite *Suite) TestTypeScriptCommander() {
+	operations := parseJavaScriptSrc(lib.Dedent(`
+		import { Command, Option } from 'commander';
+
+		const program: Command = new Command();
+		const format = new Option('-f, --format <format>', 'output format').choices(['json', 'yaml'] as const);
+		program.addOption(format);
+
+		const makeRun = (): Command => {
+			const run = new Command('run');
+			run.argument('[task]', 'task to run');
+			return run;
+		};
+		program.addCommand(makeRun());
+		await program.parseAsync(process.argv);
+	`))
+	suite.Require().Equal([]string{
+		`opt "-f|--format" --choices="json yaml" --help="output format"`,
+		`psr "run"`,
+		`pos -p="run" --help="task to run"`,
+	}, operations)
+}
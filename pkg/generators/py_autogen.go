@@ -11,45 +11,22 @@ import (
 	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"shcomp2/pkg/lib"
-	"strconv"
 	"strings"
 	"sync"
 )
 
-var lang *sitter.Language
 var check = lib.Check
 
-func GeneratePythonOperations(cli lib.Cli) lib.Cli {
-	var operations = cli.Operations
-
-	if cli.Config.AutogenClosureFunc != "" {
-		src := callBashClosureFunc(cli.Config.AutogenClosureSource, cli.Config.AutogenClosureFunc)
-		operations = append(operations, parseSrc(src)...)
-	} else if cli.Config.AutogenClosureCmd != "" {
-		src := runCmd(cli.Config.AutogenClosureCmd)
-		operations = append(operations, parseSrc(src)...)
-	} else {
-		content, err := os.ReadFile(cli.Config.AutogenFile)
-		if err != nil {
-			panic(err)
-		}
-		operations = append(operations, parseSrc(string(content))...)
-	}
-
-	// strip int operations
-	var newOperations []string
-	for _, op := range operations {
-		if strings.HasPrefix(op, "int ") {
-			continue
-		}
-		newOperations = append(newOperations, op)
+func GeneratePythonOperations(cli lib.Cli) (lib.Cli, error) {
+	var file string
+	if cli.Config.AutogenClosureFunc == "" && cli.Config.AutogenClosureCmd == "" {
+		file = cli.Config.AutogenFile
 	}
-	operations = newOperations
-
-	cli, err := lib.ParseOperations(strings.Join(operations, "\n"))
-	check(err)
-	return cli
+	return generateOperations(cli, func(src string) []string {
+		return parsePythonSrc(src, file)
+	})
 }
 
 func CheckReload(stdin io.Reader, stdout io.Writer, stderr io.Writer) bool {
@@ -58,12 +35,21 @@ func CheckReload(stdin io.Reader, stdout io.Writer, stderr io.Writer) bool {
 	cli, err := lib.ParseOperations(string(content))
 	check(err)
 	shouldReload := false
-	for _, triggerFile := range cli.Config.AutogenReloadTriggers {
-		fileInfo, _ := os.Stat(triggerFile.File)
-		if triggerFile.Timestamp != fileInfo.ModTime().UnixMilli() {
+	for _, trigger := range cli.Config.AutogenReloadTriggers {
+		changed, err := trigger.Changed()
+		if err != nil {
+			// a trigger that went missing can't say anything, the others still can
+			log.Warn().Err(err).Str("trigger", trigger.File).Msg("unable to check reload trigger")
+			continue
+		}
+		if changed {
 			shouldReload = true
-			if cli.Config.AutogenLang == "py" {
-				cli = GeneratePythonOperations(cli)
+			cli, err = Generate(cli)
+			if err != nil {
+				// the script keeps completing from the spec it was compiled from
+				log.Error().Err(err).Msg("unable to regenerate completions")
+				shouldReload = false
+				break
 			}
 			compiledShell, err := lib.CompileCli(cli)
 			if err != nil {
@@ -76,20 +62,43 @@ func CheckReload(stdin io.Reader, stdout io.Writer, stderr io.Writer) bool {
 			break
 		}
 	}
+	// the script only asks again once a trigger path is newer than the stamp
+	if err := lib.WriteReloadStamp(cli); err != nil {
+		log.Warn().Err(err).Str("stamp", cli.ReloadStamp()).Msg("unable to write reload stamp")
+	}
 	return shouldReload
 }
 
 func parseSrc(srcStr string) []string {
-	lang = python.GetLanguage()
-	src := []byte(srcStr)
-	parser := sitter.NewParser()
-	parser.SetLanguage(lang)
-	tree, _ := parser.ParseCtx(context.Background(), nil, src)
-	root := tree.RootNode()
+	return parsePythonSrc(srcStr, "")
+}
 
-	parserVarName := getParserVarName(root, src)
+// parsePythonSrc reads an argparse cli, imports are followed when file is where the source came from
+func parsePythonSrc(srcStr string, file string) []string {
+	callGraph := newPyArgumentParserGraph(file)
+	module := callGraph.addModule(file, []byte(srcStr))
+
+	// the parser can be built in an imported module, then the entry file only adds to it
+	entry := module
+	parserVarName := getParserVarName(module.root, module.src)
+	if parserVarName == "" {
+		for _, importFile := range module.importFiles {
+			if imported := callGraph.module(importFile); imported != nil {
+				if name := getParserVarName(imported.root, imported.src); name != "" {
+					entry = imported
+					parserVarName = name
+					break
+				}
+			}
+		}
+	}
 
-	return getArgumentOperations(root, pyIdentifier(parserVarName), src)
+	callGraph.setBaseParser(pyIdentifier(parserVarName))
+	callGraph.walk(entry, entry.root, nil)
+	if entry != module {
+		callGraph.walk(module, module.root, nil)
+	}
+	return callGraph.operations()
 }
 
 type pyIdentifier string
@@ -100,33 +109,86 @@ type pyArguments struct {
 }
 
 type pyAddArgumentCall struct {
-	args pyArguments
+	args  pyArguments
+	group pyIdentifier
+	// location is the file and line of the call for warnings
+	location string
 }
 
 type pyParser struct {
 	parserIdentifier    pyIdentifier
 	parserName          string
+	parserHelp          string
 	parserParent        *pyParser
 	subParsersIdentifer pyIdentifier
 	subParserList       []*pyParser
 	addArgumentCalls    []pyAddArgumentCall
+	exclusiveGroups     []pyIdentifier
+}
+
+// parserFQN is the dot separated parser name used by -p=
+func (parser *pyParser) parserFQN() string {
+	parsersString := parser.parserName
+	currentParserIter := parser
+	for {
+		parentParser := currentParserIter.parserParent
+		if parentParser == nil || parentParser.parserName == "" {
+			break
+		}
+		parsersString = parentParser.parserName + "." + parsersString
+		currentParserIter = parentParser
+	}
+	return parsersString
 }
 
 type pyArgumentParserGraph struct {
 	parserSequence    []*pyParser
 	parsers           map[pyIdentifier]*pyParser
 	subparsersParents map[pyIdentifier]*pyParser
+	groupParsers      map[pyIdentifier]*pyParser
+	// modules by file so each import is read once
+	modules map[string]*pyModule
+	// functions being followed, a function that passes its parser on to itself is read once
+	following map[string]bool
+	entryDir  string
 }
 
-func getArgumentOperations(root *sitter.Node, pyBaseParser pyIdentifier, src []byte) []string {
-	patternArgumentParser := `(
-		(call function: (attribute object: (identifier))) @parser-method-call
-	)`
+// pyModule is a parsed python file, its imports resolve relative to its directory
+type pyModule struct {
+	file      string
+	src       []byte
+	root      *sitter.Node
+	functions map[string]*sitter.Node
+	// constants are the assignments at the top of the module by name in source order
+	constants   map[string][]*sitter.Node
+	enums       map[string]*sitter.Node
+	imports     map[string]pyImport
+	importFiles []string
+	// files of `from module import *`
+	wildcards []string
+}
+
+// pyImport is an imported module or a function imported from it
+type pyImport struct {
+	file     string
+	function string
+}
 
-	var callGraph = pyArgumentParserGraph{
+func newPyArgumentParserGraph(file string) *pyArgumentParserGraph {
+	callGraph := &pyArgumentParserGraph{
 		parsers:           map[pyIdentifier]*pyParser{},
 		subparsersParents: map[pyIdentifier]*pyParser{},
+		groupParsers:      map[pyIdentifier]*pyParser{},
+		modules:           map[string]*pyModule{},
+		following:         map[string]bool{},
 	}
+	if file != "" {
+		callGraph.entryDir = filepath.Dir(file)
+	}
+	return callGraph
+}
+
+func (callGraph *pyArgumentParserGraph) setBaseParser(pyBaseParser pyIdentifier) {
 	baseParser := &pyParser{
 		parserIdentifier:    pyBaseParser,
 		parserName:          "",
@@ -136,181 +198,556 @@ func getArgumentOperations(root *sitter.Node, pyBaseParser pyIdentifier, src []b
 	}
 	callGraph.parsers[pyBaseParser] = baseParser
 	callGraph.parserSequence = append(callGraph.parserSequence, baseParser)
+}
 
-	q, err := sitter.NewQuery([]byte(patternArgumentParser), lang)
-	check(err)
-	qc := sitter.NewQueryCursor()
-	qc.Exec(q, root)
+// walk reads the parser calls under node in source order, aliases are the parameters of a followed function
+func (callGraph *pyArgumentParserGraph) walk(module *pyModule, node *sitter.Node, aliases map[pyIdentifier]pyIdentifier) {
+	src := module.src
+	for _, callNode := range queryNodes(python.GetLanguage(), node, `(call) @call`) {
+		functionNode := callNode.ChildByFieldName("function")
+		if functionNode.Type() == "attribute" && functionNode.ChildByFieldName("object").Type() == "identifier" {
+			switch functionNode.ChildByFieldName("attribute").Content(src) {
+			case "add_parser", "add_argument", "add_subparsers", "add_mutually_exclusive_group":
+				objectName := functionNode.ChildByFieldName("object").Content(src)
+				if !unboundParameter(callNode, node, objectName, aliases, src) {
+					callGraph.parserMethodCall(module, callNode, resolveAlias(aliases, objectName))
+				}
+				continue
+			}
+		}
+		callGraph.follow(module, node, callNode, aliases)
+	}
+}
 
-	for {
-		m, ok := qc.NextMatch()
-		if !ok {
-			break
+func (callGraph *pyArgumentParserGraph) parserMethodCall(module *pyModule, callNode *sitter.Node, callObjectIdentifier pyIdentifier) {
+	var node *sitter.Node
+	var assignmentIdentifier pyIdentifier = ""
+
+	src := module.src
+	functionNode := callNode.ChildByFieldName("function")
+	callFuncName := functionNode.ChildByFieldName("attribute").Content(src)
+	callArguments := callGraph.getPyArguments(module, callNode)
+
+	if node = callNode.Parent().ChildByFieldName("left"); node != nil {
+		assignmentIdentifier = pyIdentifier(node.Content(src))
+	}
+
+	if parentParser, ok := callGraph.subparsersParents[callObjectIdentifier]; ok {
+		switch callFuncName {
+		case "add_parser":
+			var parserName string
+			if len(callArguments.args) == 0 {
+				log.Warn().Msgf("%s: skipping add_parser, its name is unknown", pyLocation(module, callNode))
+				return
+			}
+			if str, ok := callArguments.args[0].(string); ok {
+				parserName = str
+			} else {
+				log.Warn().Msgf("%s: skipping add_parser, its name isn't a string", pyLocation(module, callNode))
+				return
+			}
+
+			var parserHelp string
+			if help, ok := callArguments.kwargs["help"].(string); ok && help != pySuppress {
+				parserHelp = help
+			}
+
+			// add new parser
+			parserIdentifier := assignmentIdentifier
+			newParser := pyParser{
+				parserIdentifier: parserIdentifier,
+				parserName:       parserName,
+				parserHelp:       parserHelp,
+				parserParent:     parentParser,
+				subParserList:    []*pyParser{},
+				addArgumentCalls: []pyAddArgumentCall{},
+			}
+			callGraph.parsers[assignmentIdentifier] = &newParser
+			parentParser.subParserList = append(parentParser.subParserList, &newParser)
+			callGraph.parserSequence = append(callGraph.parserSequence, &newParser)
+			callGraph.subparsersParents[callObjectIdentifier] = parentParser
+			log.Printf("new parser: %s", parserName)
 		}
+	}
 
-		for _, c := range m.Captures {
-			var node *sitter.Node
-			var assignmentIdentifier pyIdentifier = ""
-
-			callNode := c.Node
-			functionNode := callNode.ChildByFieldName("function")
-			callObjectIdentifier := pyIdentifier(functionNode.ChildByFieldName("object").Content(src))
-			callFuncName := functionNode.ChildByFieldName("attribute").Content(src)
-
-			switch callFuncName {
-			case "add_parser":
-			case "add_argument":
-			case "add_subparsers":
-			default:
-				continue
+	if parser, ok := callGraph.groupParsers[callObjectIdentifier]; ok && callFuncName == "add_argument" {
+		parser.addArgumentCalls = append(parser.addArgumentCalls, pyAddArgumentCall{
+			args:     callArguments,
+			group:    callObjectIdentifier,
+			location: pyLocation(module, callNode),
+		})
+	}
+
+	if parser, ok := callGraph.parsers[callObjectIdentifier]; ok {
+		switch callFuncName {
+		case "add_mutually_exclusive_group":
+			if assignmentIdentifier != "" {
+				callGraph.groupParsers[assignmentIdentifier] = parser
+				parser.exclusiveGroups = append(parser.exclusiveGroups, assignmentIdentifier)
 			}
+		case "add_subparsers":
+			if assignmentIdentifier != "" {
+				callGraph.subparsersParents[assignmentIdentifier] = parser
+				parser.subParsersIdentifer = assignmentIdentifier
+			}
+		case "add_argument":
+			parser.addArgumentCalls = append(parser.addArgumentCalls, pyAddArgumentCall{
+				args:     callArguments,
+				location: pyLocation(module, callNode),
+			})
+		}
+		callGraph.parsers[callObjectIdentifier] = parser
+	}
+}
 
-			callArguments := getPyArguments(callNode, src)
+// follow reads the body of a function called with a parser, subparsers or group like register(subparsers)
+func (callGraph *pyArgumentParserGraph) follow(module *pyModule, walked *sitter.Node, callNode *sitter.Node, aliases map[pyIdentifier]pyIdentifier) {
+	src := module.src
+	argumentsNode := callNode.ChildByFieldName("arguments")
+	if argumentsNode == nil || argumentsNode.Type() != "argument_list" {
+		return
+	}
 
-			if node = callNode.Parent().ChildByFieldName("left"); node != nil {
-				assignmentIdentifier = pyIdentifier(node.Content(src))
+	var positional []pyIdentifier
+	keywords := map[string]pyIdentifier{}
+	found := false
+	for _, argNode := range namedChildren(argumentsNode) {
+		valueNode, keyword := argNode, ""
+		if argNode.Type() == "keyword_argument" {
+			keyword = argNode.ChildByFieldName("name").Content(src)
+			valueNode = argNode.ChildByFieldName("value")
+		}
+		var bound pyIdentifier
+		if valueNode.Type() == "identifier" && !unboundParameter(callNode, walked, valueNode.Content(src), aliases, src) {
+			if identifier := resolveAlias(aliases, valueNode.Content(src)); callGraph.isParserObject(identifier) {
+				bound = identifier
+				found = true
 			}
+		}
+		if keyword == "" {
+			positional = append(positional, bound)
+		} else if bound != "" {
+			keywords[keyword] = bound
+		}
+	}
+	if !found {
+		return
+	}
 
-			if parentParser, ok := callGraph.subparsersParents[callObjectIdentifier]; ok {
-				switch callFuncName {
-				case "add_parser":
-					var parserName string
-					if len(callArguments.args) == 0 {
-						panic("parser name not provided in args")
-					}
-					if str, ok := callArguments.args[0].(string); ok {
-						parserName = str
-					} else {
-						panic("parser name is not a string")
-					}
+	functionName := callNode.ChildByFieldName("function").Content(src)
+	definitionModule, definition := callGraph.function(module, functionName, 0)
+	if definition == nil {
+		log.Debug().Msgf("unable to follow %s, its definition wasn't found", functionName)
+		return
+	}
+	key := definitionModule.file + ":" + definition.ChildByFieldName("name").Content(definitionModule.src)
+	if callGraph.following[key] {
+		return
+	}
 
-					// add new parser
-					parserIdentifier := assignmentIdentifier
-					newParser := pyParser{
-						parserIdentifier: parserIdentifier,
-						parserName:       parserName,
-						parserParent:     parentParser,
-						subParserList:    []*pyParser{},
-						addArgumentCalls: []pyAddArgumentCall{},
-					}
-					callGraph.parsers[assignmentIdentifier] = &newParser
-					parentParser.subParserList = append(parentParser.subParserList, &newParser)
-					callGraph.parserSequence = append(callGraph.parserSequence, &newParser)
-					callGraph.subparsersParents[callObjectIdentifier] = parentParser
-					log.Printf("new parser: %s", parserName)
-				}
+	parameters := pyParameters(definition, definitionModule.src)
+	bindings := map[pyIdentifier]pyIdentifier{}
+	for i, bound := range positional {
+		if bound != "" && i < len(parameters) {
+			bindings[pyIdentifier(parameters[i])] = bound
+		}
+	}
+	for keyword, bound := range keywords {
+		if contains(parameters, keyword) {
+			bindings[pyIdentifier(keyword)] = bound
+		}
+	}
+
+	callGraph.following[key] = true
+	callGraph.walk(definitionModule, definition, bindings)
+	delete(callGraph.following, key)
+}
+
+func (callGraph *pyArgumentParserGraph) isParserObject(identifier pyIdentifier) bool {
+	_, isParser := callGraph.parsers[identifier]
+	_, isSubparsers := callGraph.subparsersParents[identifier]
+	_, isGroup := callGraph.groupParsers[identifier]
+	return isParser || isSubparsers || isGroup
+}
+
+// function finds the definition of a function called as name or module.name, depth guards re-exports
+func (callGraph *pyArgumentParserGraph) function(module *pyModule, name string, depth int) (*pyModule, *sitter.Node) {
+	if depth > 8 {
+		return nil, nil
+	}
+	if object, functionName := splitAttribute(name); object != "" {
+		// module.register(subparsers) with `import module` or `from . import module`
+		imported, ok := module.imports[object]
+		if !ok || imported.function != "" {
+			return nil, nil
+		}
+		if importedModule := callGraph.module(imported.file); importedModule != nil {
+			return callGraph.function(importedModule, functionName, depth+1)
+		}
+		return nil, nil
+	}
+
+	if definition, ok := module.functions[name]; ok {
+		return module, definition
+	}
+	if imported, ok := module.imports[name]; ok && imported.function != "" {
+		if importedModule := callGraph.module(imported.file); importedModule != nil {
+			return callGraph.function(importedModule, imported.function, depth+1)
+		}
+	}
+	for _, file := range module.wildcards {
+		if importedModule := callGraph.module(file); importedModule != nil {
+			if definitionModule, definition := callGraph.function(importedModule, name, depth+1); definition != nil {
+				return definitionModule, definition
 			}
+		}
+	}
+	return nil, nil
+}
 
-			if parser, ok := callGraph.parsers[callObjectIdentifier]; ok {
-				switch callFuncName {
-				case "add_subparsers":
-					if assignmentIdentifier != "" {
-						callGraph.subparsersParents[assignmentIdentifier] = parser
-						parser.subParsersIdentifer = assignmentIdentifier
-					}
-				case "add_argument":
-					parser.addArgumentCalls = append(parser.addArgumentCalls, pyAddArgumentCall{
-						args: callArguments,
-					})
+// module reads and parses an imported file once
+func (callGraph *pyArgumentParserGraph) module(file string) *pyModule {
+	if module, ok := callGraph.modules[file]; ok {
+		return module
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		log.Warn().Err(err).Msgf("unable to read imported module %s", file)
+		callGraph.modules[file] = nil
+		return nil
+	}
+	return callGraph.addModule(file, content)
+}
+
+func (callGraph *pyArgumentParserGraph) addModule(file string, src []byte) *pyModule {
+	parser := sitter.NewParser()
+	parser.SetLanguage(python.GetLanguage())
+	tree, _ := parser.ParseCtx(context.Background(), nil, src)
+	module := &pyModule{
+		file:      file,
+		src:       src,
+		root:      tree.RootNode(),
+		functions: map[string]*sitter.Node{},
+		constants: map[string][]*sitter.Node{},
+		enums:     map[string]*sitter.Node{},
+		imports:   map[string]pyImport{},
+	}
+	if file != "" {
+		callGraph.modules[file] = module
+	}
+
+	for _, statement := range namedChildren(module.root) {
+		if statement.Type() == "decorated_definition" {
+			statement = statement.ChildByFieldName("definition")
+		}
+		switch statement.Type() {
+		case "function_definition":
+			module.functions[statement.ChildByFieldName("name").Content(src)] = statement
+		case "class_definition":
+			if superclasses := statement.ChildByFieldName("superclasses"); superclasses != nil && strings.Contains(superclasses.Content(src), "Enum") {
+				module.enums[statement.ChildByFieldName("name").Content(src)] = statement
+			}
+		case "expression_statement":
+			if assignment := statement.NamedChild(0); assignment.Type() == "assignment" {
+				if left := assignment.ChildByFieldName("left"); left.Type() == "identifier" {
+					module.constants[left.Content(src)] = append(module.constants[left.Content(src)], assignment)
 				}
-				callGraph.parsers[callObjectIdentifier] = parser
 			}
 		}
 	}
+	if file == "" {
+		// source from a closure has no directory to resolve imports against
+		return module
+	}
+	for _, statement := range queryNodes(python.GetLanguage(), module.root, `[(import_statement) (import_from_statement)] @import`) {
+		callGraph.addImport(module, statement)
+	}
+	return module
+}
+
+// addImport records what `import a.b as c`, `from .a import b` and `from . import a` bind
+func (callGraph *pyArgumentParserGraph) addImport(module *pyModule, statement *sitter.Node) {
+	src := module.src
+	dir := filepath.Dir(module.file)
+	addFile := func(file string) {
+		if !contains(module.importFiles, file) {
+			module.importFiles = append(module.importFiles, file)
+		}
+	}
+
+	if statement.Type() == "import_statement" {
+		for _, nameNode := range namedChildren(statement) {
+			name, alias := importName(nameNode, src)
+			if file := callGraph.resolveModule(dir, 0, name); file != "" {
+				module.imports[alias] = pyImport{file: file}
+				addFile(file)
+			}
+		}
+		return
+	}
 
+	moduleNode := statement.ChildByFieldName("module_name")
+	level, dotted := 0, moduleNode.Content(src)
+	if moduleNode.Type() == "relative_import" {
+		level = len(moduleNode.NamedChild(0).Content(src))
+		dotted = ""
+		if moduleNode.NamedChildCount() > 1 {
+			dotted = moduleNode.NamedChild(1).Content(src)
+		}
+	}
+	for _, nameNode := range namedChildren(statement)[1:] {
+		if nameNode.Type() == "wildcard_import" {
+			if file := callGraph.resolveModule(dir, level, dotted); file != "" {
+				module.wildcards = append(module.wildcards, file)
+				addFile(file)
+			}
+			continue
+		}
+		name, alias := importName(nameNode, src)
+		// the name is a submodule or something defined in the module
+		submodule := name
+		if dotted != "" {
+			submodule = dotted + "." + name
+		}
+		if file := callGraph.resolveModule(dir, level, submodule); file != "" {
+			module.imports[alias] = pyImport{file: file}
+			addFile(file)
+		} else if file := callGraph.resolveModule(dir, level, dotted); file != "" {
+			module.imports[alias] = pyImport{file: file, function: name}
+			addFile(file)
+		}
+	}
+}
+
+// resolveModule finds the file of a module, relative imports start at dir and package imports at dir,
+// the entry file's directory or the directory the package is in
+func (callGraph *pyArgumentParserGraph) resolveModule(dir string, level int, dotted string) string {
+	var roots []string
+	if level > 0 {
+		root := dir
+		for i := 1; i < level; i++ {
+			root = filepath.Dir(root)
+		}
+		roots = append(roots, root)
+	} else {
+		roots = append(roots, dir, callGraph.entryDir, packageRoot(dir))
+	}
+
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(strings.ReplaceAll(dotted, ".", "/")))
+		if info, err := os.Stat(path + ".py"); err == nil && !info.IsDir() && dotted != "" {
+			return path + ".py"
+		}
+		if _, err := os.Stat(filepath.Join(path, "__init__.py")); err == nil {
+			return filepath.Join(path, "__init__.py")
+		}
+	}
+	return ""
+}
+
+// packageRoot is the directory the top package of dir is in
+func packageRoot(dir string) string {
+	root := dir
+	for {
+		if _, err := os.Stat(filepath.Join(root, "__init__.py")); err != nil {
+			return root
+		}
+		parent := filepath.Dir(root)
+		if parent == root {
+			return root
+		}
+		root = parent
+	}
+}
+
+func importName(node *sitter.Node, src []byte) (string, string) {
+	if node.Type() == "aliased_import" {
+		return node.ChildByFieldName("name").Content(src), node.ChildByFieldName("alias").Content(src)
+	}
+	return node.Content(src), node.Content(src)
+}
+
+// pyParameters are the names of the parameters of a function definition in order
+func pyParameters(definition *sitter.Node, src []byte) []string {
+	var parameters []string
+	for _, parameter := range namedChildren(definition.ChildByFieldName("parameters")) {
+		switch parameter.Type() {
+		case "identifier":
+			parameters = append(parameters, parameter.Content(src))
+		case "default_parameter", "typed_default_parameter":
+			parameters = append(parameters, parameter.ChildByFieldName("name").Content(src))
+		case "typed_parameter":
+			parameters = append(parameters, parameter.NamedChild(0).Content(src))
+		}
+	}
+	return parameters
+}
+
+// unboundParameter is true for a parameter of a function the call is in that wasn't called with a parser,
+// those calls are read when the function is followed
+func unboundParameter(callNode *sitter.Node, walked *sitter.Node, name string, aliases map[pyIdentifier]pyIdentifier, src []byte) bool {
+	if _, ok := aliases[pyIdentifier(name)]; ok {
+		return false
+	}
+	for parent := callNode.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Type() == "function_definition" && contains(pyParameters(parent, src), name) {
+			return true
+		}
+		if parent.Equal(walked) {
+			break
+		}
+	}
+	return false
+}
+
+func resolveAlias(aliases map[pyIdentifier]pyIdentifier, name string) pyIdentifier {
+	if identifier, ok := aliases[pyIdentifier(name)]; ok {
+		return identifier
+	}
+	return pyIdentifier(name)
+}
+
+// operations are the operations of every parser in the order they were found
+func (callGraph *pyArgumentParserGraph) operations() []string {
 	var operations []string
 	for _, parser := range callGraph.parserSequence {
 		var operation []string
 		if parser.parserParent != nil {
 			operation = append(operation, "psr")
 			if parser.parserParent.parserName != "" {
-				operation = append(operation, fmt.Sprintf(`-p="%s"`, parser.parserParent.parserName))
+				operation = append(operation, "-p="+lib.QuoteWord(parser.parserParent.parserName))
+			}
+			operation = append(operation, lib.QuoteWord(parser.parserName))
+			if parser.parserHelp != "" {
+				operation = append(operation, "--help="+lib.QuoteWord(parser.parserHelp))
 			}
-			operation = append(operation, fmt.Sprintf(`"%s"`, parser.parserName))
 			operations = append(operations, strings.Join(operation, " "))
 		}
-		for _, addArgumentCall := range parser.addArgumentCalls {
-			if addArgumentCall.args.Empty() {
-				panic("zero arguments in add_argument call")
+		for _, group := range parser.exclusiveGroups {
+			var operation []string
+			operation = append(operation, "grp")
+			if parser.parserName != "" {
+				operation = append(operation, "-p="+lib.QuoteWord(parser.parserFQN()))
 			}
-
+			operation = append(operation, lib.QuoteWord(string(group)), "--exclusive")
+			operations = append(operations, strings.Join(operation, " "))
+		}
+		for _, addArgumentCall := range parser.addArgumentCalls {
 			var operation []string
 			var argumentName string
+			var nameIndex int
 			args := addArgumentCall.args.args
 			kwargs := addArgumentCall.args.kwargs
+			location := addArgumentCall.location
 
+			if len(args) == 0 {
+				log.Warn().Msgf("%s: skipping add_argument, its name is unknown", location)
+				continue
+			}
 			if str, ok := args[0].(string); ok {
 				argumentName = str
 			} else {
-				panic("add_argument first arg is not a string")
+				log.Warn().Msgf("%s: skipping add_argument, its name isn't a string", location)
+				continue
+			}
+
+			if kwargs["help"] == pySuppress || kwargs["default"] == pySuppress {
+				// hidden from --help and the completions
+				continue
+			}
+
+			isOption := strings.HasPrefix(argumentName, "-")
+			takesValue, repeatable := pyAction(kwargs["action"])
+			if nargs, ok := kwargs["nargs"].(int); ok && nargs == 0 {
+				takesValue = false
 			}
 
-			if strings.HasPrefix(argumentName, "-") {
+			if isOption {
 				operation = append(operation, "opt")
 			} else {
 				operation = append(operation, "pos")
 			}
 
 			if parser.parserName != "" {
-				parsersString := parser.parserName
-				currentParserIter := parser
-				for {
-					parentParser := currentParserIter.parserParent
-					if parentParser == nil || parentParser.parserName == "" {
-						break
+				operation = append(operation, "-p="+lib.QuoteWord(parser.parserFQN()))
+			}
+
+			if isOption {
+				nameIndex = len(operation)
+				operation = append(operation, lib.QuoteWord(argumentName))
+				if addArgumentCall.group != "" {
+					operation = append(operation, "--group="+lib.QuoteWord(string(addArgumentCall.group)))
+				}
+			}
+
+			if takesValue || !isOption {
+				hasChoices := false
+				if choices, ok := kwargs["choices"]; ok {
+					if choiceValues, err := pyChoices(choices); err == nil {
+						operation = append(operation, "--choices="+lib.QuoteChoices(choiceValues))
+						hasChoices = true
+					} else {
+						log.Warn().Msgf("%s: skipping choices of %s, %s", location, argumentName, err)
 					}
-					parsersString = parentParser.parserName + "." + parsersString
-					currentParserIter = parentParser
 				}
-				operation = append(operation, fmt.Sprintf(`-p="%s"`, parsersString))
-			}
-
-			if strings.HasPrefix(argumentName, "-") {
-				operation = append(operation, fmt.Sprintf(`"%s"`, argumentName))
-			}
-
-			if choices, ok := kwargs["choices"]; ok {
-				choicesStr := ""
-				if choicesList, ok := choices.([]interface{}); ok {
-					for i, choice := range choicesList {
-						if i != 0 {
-							choicesStr += " "
-						}
-						switch v := choice.(type) {
-						case string:
-							choicesStr += v
-						default:
-							panic(fmt.Sprintf("cannot handle choice that isn't a string : %T", v))
-						}
+				complete := ""
+				switch valueType := kwargs["type"].(type) {
+				case pyEnum:
+					// the values convert to the members of type=Color
+					if choiceValues, err := pyChoices(valueType); err == nil && !hasChoices {
+						operation = append(operation, "--choices="+lib.QuoteChoices(choiceValues))
+						hasChoices = true
+					}
+				case pyReference:
+					switch lastName(string(valueType)) {
+					case "FileType", "Path", "PurePath":
+						complete = lib.CompleteTypeFile
 					}
-					operation = append(operation, fmt.Sprintf(`--choices="%s"`, choicesStr))
-				} else {
-					panic("cannot handle choices that isnt' a list")
+				}
+				if complete == "" {
+					complete = metavarComplete(pyMetavar(kwargs["metavar"]))
+				}
+				if complete == "" && isOption && !hasChoices {
+					complete = lib.CompleteTypeValue
+				}
+				if complete != "" && !hasChoices {
+					operation = append(operation, "--complete="+complete)
 				}
 			}
-			if nargs, ok := kwargs["nargs"]; ok {
-				var nargsValue string
-				if nargsStr, ok := nargs.(string); ok {
-					switch nargsStr {
-					case "*":
-						nargsValue = "*"
-					case "+":
-						nargsValue = "+"
-					case "?":
-						nargsValue = "?"
+
+			if repeatable && isOption {
+				operation = append(operation, `--nargs="*"`)
+			} else if nargs, ok := kwargs["nargs"]; ok && takesValue {
+				switch nargsValue := nargs.(type) {
+				case string:
+					switch nargsValue {
+					case "*", "+", "?":
+						operation = append(operation, fmt.Sprintf(`--nargs="%s"`, nargsValue))
 					default:
-						panic("invalid narg string " + nargsStr)
+						log.Warn().Msgf("%s: skipping nargs of %s, %q isn't supported", location, argumentName, nargsValue)
 					}
-
-					operation = append(operation, fmt.Sprintf(`--nargs="%s"`, nargsValue))
-				} else if nargsInt, ok := nargs.(int); ok {
-					operation = append(operation, fmt.Sprintf(`--nargs="%d"`, nargsInt))
-				} else {
-					panic("cannot handle choices that isnt' a list")
+				case int:
+					operation = append(operation, fmt.Sprintf(`--nargs="%d"`, nargsValue))
+				default:
+					log.Warn().Msgf("%s: skipping nargs of %s, it is a %s", location, argumentName, pyTypeName(nargs))
 				}
 			}
 
+			if help := pyDescription(kwargs); help != "" {
+				operation = append(operation, "--help="+lib.QuoteWord(help))
+			}
+
 			operations = append(operations, strings.Join(operation, " "))
+			if reference, ok := kwargs["action"].(pyReference); ok && lastName(string(reference)) == "BooleanOptionalAction" {
+				// --verbose also adds --no-verbose
+				if name, found := strings.CutPrefix(argumentName, "--"); found {
+					operation[nameIndex] = lib.QuoteWord("--no-" + name)
+					operations = append(operations, strings.Join(operation, " "))
+				}
+			}
 		}
 
 	}
@@ -318,9 +755,10 @@ func getArgumentOperations(root *sitter.Node, pyBaseParser pyIdentifier, src []b
 	return operations
 }
 
-func getPyArguments(callNode *sitter.Node, src []byte) pyArguments {
-	var parseArgNode func(argNode *sitter.Node) interface{}
+// getPyArguments evaluates the arguments of a call, arguments that can't be resolved are skipped with a warning
+func (callGraph *pyArgumentParserGraph) getPyArguments(module *pyModule, callNode *sitter.Node) pyArguments {
 	var argumentsNode *sitter.Node
+	src := module.src
 
 	pyArgs := pyArguments{
 		args:   []interface{}{},
@@ -331,46 +769,54 @@ func getPyArguments(callNode *sitter.Node, src []byte) pyArguments {
 		return pyArgs
 	}
 
-	panicNode := func(n *sitter.Node, msg string) {
-		lines := strings.Split(string(src), "\n")
-		nodeLine := fmt.Sprintf("line %d: %s", n.StartPoint().Row, lines[n.StartPoint().Row])
-		newMsg := msg + "\n" + nodeLine
-		panic(newMsg)
-	}
-
-	parseArgNode = func(argNode *sitter.Node) interface{} {
-		var value interface{}
+	evaluator := callGraph.evaluator(module)
+	for _, argNode := range namedChildren(argumentsNode) {
 		switch argNode.Type() {
-		case "string":
-			value = unquote(argNode.Content(src))
-		case "list":
-			list := make([]interface{}, argNode.NamedChildCount())
-			for i := 0; i < int(argNode.NamedChildCount()); i++ {
-				list[i] = parseArgNode(argNode.NamedChild(i))
-			}
-			value = list
-		case "true":
-			value = true
-		case "false":
-			value = false
-		case "none":
-			value = nil
-		case "integer":
-			value, _ = strconv.Atoi(argNode.Content(src))
-		default:
-			panicNode(argNode, fmt.Sprintf("unhandled Node.Type() '%s'", argNode.Type()))
-		}
-		return value
-	}
-
-	for i := 0; i < int(argumentsNode.NamedChildCount()); i++ {
-		argNode := argumentsNode.NamedChild(i)
-		if argNode.Type() == "keyword_argument" {
+		case "keyword_argument":
 			pyKey := argNode.ChildByFieldName("name").Content(src)
-			pyValue := parseArgNode(argNode.ChildByFieldName("value"))
+			valueNode := argNode.ChildByFieldName("value")
+			pyValue, err := evaluator.eval(valueNode)
+			if reference, ok := pyReferenceName(valueNode, src); err != nil && ok && (pyKey == "type" || pyKey == "action") {
+				// type=pathlib.Path and action=argparse.BooleanOptionalAction are read by their names
+				pyArgs.kwargs[pyKey] = reference
+				continue
+			}
+			if err != nil {
+				log.Warn().Msgf("%s: skipping %s=, %s", pyLocation(module, argNode), pyKey, err)
+				continue
+			}
 			pyArgs.kwargs[pyKey] = pyValue
-		} else {
-			pyValue := parseArgNode(argNode)
+		case "dictionary_splat":
+			pyValue, err := evaluator.eval(argNode.NamedChild(0))
+			dict, ok := pyValue.(pyDict)
+			if err == nil && !ok {
+				err = fmt.Errorf("%s isn't a dict", pyTypeName(pyValue))
+			}
+			if err != nil {
+				log.Warn().Msgf("%s: skipping %s, %s", pyLocation(module, argNode), argNode.Content(src), err)
+				continue
+			}
+			for i, key := range dict.keys {
+				if pyKey, ok := key.(string); ok {
+					pyArgs.kwargs[pyKey] = dict.values[i]
+				}
+			}
+		case "list_splat":
+			pyValue, err := evaluator.eval(argNode.NamedChild(0))
+			if err == nil {
+				var values []interface{}
+				if values, err = pyIterable(pyValue); err == nil {
+					pyArgs.args = append(pyArgs.args, values...)
+					continue
+				}
+			}
+			log.Warn().Msgf("%s: skipping %s, %s", pyLocation(module, argNode), argNode.Content(src), err)
+		default:
+			pyValue, err := evaluator.eval(argNode)
+			if err != nil {
+				// the position of the arguments after it still matters
+				log.Warn().Msgf("%s: unable to evaluate %s, %s", pyLocation(module, argNode), argNode.Content(src), err)
+			}
 			pyArgs.args = append(pyArgs.args, pyValue)
 		}
 	}
@@ -378,18 +824,99 @@ func getPyArguments(callNode *sitter.Node, src []byte) pyArguments {
 	return pyArgs
 }
 
+// pyAction is whether an option with the add_argument action takes a value and whether it can be given more than once
+func pyAction(action interface{}) (bool, bool) {
+	name, _ := action.(string)
+	if reference, ok := action.(pyReference); ok {
+		name = lastName(string(reference))
+	}
+	switch name {
+	case "store_true", "store_false", "store_const", "help", "version", "BooleanOptionalAction":
+		return false, false
+	case "count", "append_const":
+		return false, true
+	case "append", "extend":
+		return true, true
+	}
+	return true, false
+}
+
+// pyMetavar is the metavar of an argument, a tuple for nargs=2 is joined like argparse shows it
+func pyMetavar(metavar interface{}) string {
+	var words []string
+	switch v := metavar.(type) {
+	case string:
+		return v
+	case []interface{}:
+		for _, item := range v {
+			if word, ok := item.(string); ok {
+				words = append(words, word)
+			}
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// pyDescription is the help of an argument, the metavar or dest describe it when it has none
+func pyDescription(kwargs map[string]interface{}) string {
+	if help, ok := kwargs["help"].(string); ok && help != "" {
+		return help
+	}
+	if metavar := pyMetavar(kwargs["metavar"]); metavar != "" {
+		return metavar
+	}
+	dest, _ := kwargs["dest"].(string)
+	return dest
+}
+
+// pyChoices are the values of choices as strings
+func pyChoices(choices interface{}) ([]string, error) {
+	items, err := pyIterable(choices)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(items))
+	for i, item := range items {
+		if values[i], err = pyChoice(item); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// pyReferenceName is the name of a class or function like argparse.FileType in `argparse.FileType("w")`
+func pyReferenceName(node *sitter.Node, src []byte) (pyReference, bool) {
+	if node.Type() == "call" {
+		node = node.ChildByFieldName("function")
+	}
+	switch node.Type() {
+	case "identifier", "attribute":
+		return pyReference(node.Content(src)), true
+	}
+	return "", false
+}
+
+// pyLocation is the file and line of a node for warnings
+func pyLocation(module *pyModule, node *sitter.Node) string {
+	file := module.file
+	if file == "" {
+		file = "<source>"
+	}
+	return fmt.Sprintf("%s:%d", file, node.StartPoint().Row+1)
+}
+
 func getParserVarName(root *sitter.Node, src []byte) string {
 	name := ""
 	patternArgumentParser := `(
 		assignment
 			left: (identifier)
 			right: (call
-				function: (identifier) @func-name
-				(#match? @func-name "ArgumentParser")
+				function: (_) @func-name
+				(#match? @func-name "ArgumentParser$")
 			)
 	)`
 
-	q, err := sitter.NewQuery([]byte(patternArgumentParser), lang)
+	q, err := sitter.NewQuery([]byte(patternArgumentParser), python.GetLanguage())
 	check(err)
 	qc := sitter.NewQueryCursor()
 	qc.Exec(q, root)
@@ -409,16 +936,6 @@ func getParserVarName(root *sitter.Node, src []byte) string {
 	return name
 }
 
-func unquote(str string) string {
-	var found bool
-	if str, found = strings.CutPrefix(str, "'"); found {
-		str, _ = strings.CutSuffix(str, "'")
-	} else if str, found = strings.CutPrefix(str, "\""); found {
-		str, _ = strings.CutSuffix(str, "\"")
-	}
-	return str
-}
-
 func (args pyArguments) Empty() bool {
 	return len(args.args)+len(args.kwargs) == 0
 }
@@ -445,8 +962,8 @@ func (b *bashProcess) runClosure(closureFile string, closureName string) string
 	return <-b.chanOut
 }
 
-func runCmd(cmd string) string {
-	out, err := exec.Command(cmd).Output()
+func runCmd(cmd string, args ...string) string {
+	out, err := cmdOutput(cmd, args...)
 	if err != nil {
 		if errors.Is(err, fs.ErrPermission) {
 			panic("command is not executable!")
@@ -454,7 +971,13 @@ func runCmd(cmd string) string {
 			panic(err)
 		}
 	}
-	return string(out)
+	return out
+}
+
+// cmdOutput is the stdout of a command, runCmd for callers that can go on without it
+func cmdOutput(cmd string, args ...string) (string, error) {
+	out, err := exec.Command(cmd, args...).Output()
+	return string(out), err
 }
 
 func newBashProcess() *bashProcess {
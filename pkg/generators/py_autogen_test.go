@@ -19,15 +19,20 @@ type Suite struct {
 }
 
 func (suite *Suite) AutogenParse(src string) string {
+	return suite.AutogenParseLang("py", src)
+}
+
+func (suite *Suite) AutogenParseLang(autogenLang string, src string) string {
 	filename := suite.CreateFile("file.py", src)
 	cli, err := lib.ParseOperations(fmt.Sprintf(`
 		cfg cli_name=testcli
-		cfg autogen_lang=py
+		cfg autogen_lang=%s
 		cfg autogen_file=%s
 		cfg outfile=-
-	`, filename))
+	`, autogenLang, filename))
+	check(err)
+	cli, err = Generate(cli)
 	check(err)
-	cli = GeneratePythonOperations(cli)
 	shell, err := lib.CompileCli(cli)
 	if err != nil {
 		panic(err)
@@ -40,7 +45,8 @@ func (suite *Suite) AutogenParseCfg(cfg string, values ...any) string {
 	cfg = fmt.Sprintf(cfg, values...)
 	cli, err := lib.ParseOperations(cfg)
 	check(err)
-	cli = GeneratePythonOperations(cli)
+	cli, err = Generate(cli)
+	check(err)
 	shell, err := lib.CompileCli(cli)
 	if err != nil {
 		panic(err)
@@ -258,8 +264,296 @@ func (suite *Suite) TestNargsOptions() {
 	)
 
 	suite.RequireComplete(shell, "testcli ", "-a -b -c -d")
-	suite.RequireComplete(shell, "testcli -a ", "-b -c -d")
-	suite.RequireComplete(shell, "testcli -a -b ", "-c -d")
-	suite.RequireComplete(shell, "testcli -a -b -c ", "-c -d")
-	suite.RequireComplete(shell, "testcli -a -b -c -d ", "-c -d")
+	suite.RequireComplete(shell, "testcli -a ", "")
+	suite.RequireComplete(shell, "testcli -a x ", "-b -c -d")
+	suite.RequireComplete(shell, "testcli -a x -b y ", "-c -d")
+	suite.RequireComplete(shell, "testcli -a x -b y -c z ", "-c -d")
+	suite.RequireComplete(shell, "testcli -a x -b y -c z -d w ", "-c -d")
+}
+
+func (suite *Suite) TestHelpDescriptions() {
+	shell := suite.AutogenParse(`
+		from argparse import ArgumentParser
+		parser = ArgumentParser()
+		parser.add_argument("--verbose", help="print more output")
+		parser.add_argument("--quiet")
+		subparsers = parser.add_subparsers()
+		parser_run = subparsers.add_parser("run", help="run a \"task\"")
+		parser_run.add_argument("task", choices=["build", "test"], help="task to run")
+		parser_list = subparsers.add_parser("list")
+	`)
+	suite.RequireComplete(shell, "testcli -", "--verbose -- print more output --quiet")
+	suite.RequireComplete(shell, "testcli ", `run       -- run a "task" list --verbose -- print more output --quiet`)
+	suite.RequireComplete(shell, "testcli r", "run")
+}
+
+func (suite *Suite) TestMutuallyExclusiveGroup() {
+	shell := suite.AutogenParse(`
+		from argparse import ArgumentParser
+		parser = ArgumentParser()
+		flavor = parser.add_mutually_exclusive_group()
+		flavor.add_argument("--vanilla", action="store_true")
+		flavor.add_argument("--chocolate", action="store_true")
+		parser.add_argument("--sprinkles", action="store_true")
+		subparsers = parser.add_subparsers()
+		parser_order = subparsers.add_parser("order")
+		size = parser_order.add_mutually_exclusive_group(required=True)
+		size.add_argument("--small", action="store_true")
+		size.add_argument("--large", action="store_true")
+	`)
+	suite.RequireComplete(shell, "testcli ", "order --vanilla --chocolate --sprinkles")
+	suite.RequireComplete(shell, "testcli --vanilla ", "order --sprinkles")
+	suite.RequireComplete(shell, "testcli order ", "--small --large")
+	suite.RequireComplete(shell, "testcli order --large ", "")
+}
+
+func (suite *Suite) TestFollowFunctions() {
+	operations := parseSrc(lib.Dedent(`
+		import argparse
+
+		def add_output(p, required=False):
+			p.add_argument("--out", help="output file")
+
+		def register(subparsers):
+			build = subparsers.add_parser("build")
+			add_output(build)
+
+		def unused(parser):
+			parser.add_argument("--unused")
+
+		def main():
+			parser = argparse.ArgumentParser()
+			parser.add_argument("--verbose", action="store_true")
+			add_output(p=parser)
+			register(parser.add_subparsers())
+			subparsers = parser.add_subparsers()
+			register(subparsers)
+			parser.parse_args()
+	`))
+	suite.Require().Equal([]string{
+		`opt "--verbose"`,
+		`opt "--out" --complete=value --help="output file"`,
+		`psr "build"`,
+		`opt -p="build" "--out" --complete=value --help="output file"`,
+	}, operations)
+}
+
+func (suite *Suite) TestFollowImports() {
+	suite.CreateFile("tool/__init__.py", "")
+	suite.CreateFile("tool/common.py", `
+		def add_common(parser):
+			parser.add_argument("--verbose")
+	`)
+	suite.CreateFile("tool/commands/__init__.py", `
+		from .build import register
+	`)
+	suite.CreateFile("tool/commands/build.py", `
+		from tool.common import add_common
+
+		def register(subparsers):
+			build = subparsers.add_parser("build", help="build the app")
+			build.add_argument("--target", choices=["debug", "release"])
+			add_common(build)
+	`)
+	cliFile := suite.CreateFile("tool/cli.py", `
+		import argparse
+		from .commands import register
+		from . import common
+
+		parser = argparse.ArgumentParser()
+		common.add_common(parser)
+		subparsers = parser.add_subparsers()
+		register(subparsers)
+	`)
+
+	shell := suite.AutogenParseCfg(`
+		cfg cli_name=testcli
+		cfg autogen_lang=py
+		cfg autogen_file=%s
+		cfg outfile=-
+	`, cliFile)
+	suite.RequireComplete(shell, "testcli --v", "--verbose")
+	suite.RequireComplete(shell, "testcli b", "build")
+	suite.RequireComplete(shell, "testcli build --target ", "debug release")
+	suite.RequireComplete(shell, "testcli build --v", "--verbose")
+}
+
+func (suite *Suite) TestFollowImportedParser() {
+	suite.CreateFile("app/parser.py", `
+		from argparse import ArgumentParser
+
+		parser = ArgumentParser()
+		parser.add_argument("--config")
+		subparsers = parser.add_subparsers()
+	`)
+	mainFile := suite.CreateFile("app/main.py", `
+		from parser import parser, subparsers
+
+		run = subparsers.add_parser("run")
+		run.add_argument("--dry-run")
+	`)
+
+	shell := suite.AutogenParseCfg(`
+		cfg cli_name=testcli
+		cfg autogen_lang=py
+		cfg autogen_file=%s
+		cfg outfile=-
+	`, mainFile)
+	suite.RequireComplete(shell, "testcli --c", "--config")
+	suite.RequireComplete(shell, "testcli run --d", "--dry-run")
+}
+
+func (suite *Suite) TestEscapedValues() {
+	src := `
+		import argparse
+
+		parser = argparse.ArgumentParser()
+		parser.add_argument("--x", choices=["say\"hi\"", "a\\b"])
+		subparsers = parser.add_subparsers()
+		quoted = subparsers.add_parser('say"hi"')
+		quoted.add_argument("--y")
+	`
+	suite.Require().Equal([]string{
+		`opt "--x" --choices="'say\"hi\"' 'a\\b'"`,
+		`psr "say\"hi\""`,
+		`opt -p="say\"hi\"" "--y" --complete=value`,
+	}, parseSrc(lib.Dedent(src)))
+
+	shell := suite.AutogenParse(src)
+	suite.RequireComplete(shell, `testcli --x s`, `say"hi"`)
+	suite.RequireComplete(shell, `testcli --x a`, `a\b`)
+}
+
+func (suite *Suite) TestEvaluateConstants() {
+	operations := parseSrc(lib.Dedent(`
+		import argparse
+		from enum import Enum, auto
+
+		class Color(Enum):
+			RED = "red"
+			GREEN = "green"
+			CRIMSON = "red"
+
+		class Level(Enum):
+			LOW = auto()
+			HIGH = auto()
+
+		ENVIRONMENTS = ("dev", "staging")
+		ENVIRONMENTS = ENVIRONMENTS + ("prod",)
+		REGIONS = {"us-west": 1, "eu-central": 2, "ap-south": 3}
+		SIZES = {"small", "large", "small"}
+		PREFIX = "out"
+		COUNT = 2
+
+		def main():
+			formats = [f"{PREFIX}-{n}" for n in range(1, 3) if n != COUNT + 1]
+			parser = argparse.ArgumentParser()
+			parser.add_argument("--env", choices=ENVIRONMENTS, help=f"deploy to {ENVIRONMENTS[-1]!s}")
+			parser.add_argument("--region", choices=sorted(REGIONS))
+			parser.add_argument("--zone", choices=list(REGIONS.keys())[:1])
+			parser.add_argument("--color", choices=list(Color), type=Color)
+			parser.add_argument("--level", choices=[level.name.lower() for level in Level])
+			parser.add_argument("--size", choices=SIZES)
+			parser.add_argument("--format", choices=formats)
+			parser.add_argument("--port", choices=range(8000, 8003), nargs=COUNT)
+			parser.add_argument("--user", choices=get_users(), help=r"the \d user", nargs=argparse.ONE_OR_MORE)
+			parser.add_argument(*["--quiet", "-q"], action="store_true", help='don\'t print \x22anything\42')
+	`))
+	suite.Require().Equal([]string{
+		`opt "--env" --choices="dev staging prod" --help="deploy to prod"`,
+		`opt "--region" --choices="ap-south eu-central us-west"`,
+		`opt "--zone" --complete=value`,
+		`opt "--color" --choices="red green"`,
+		`opt "--level" --choices="low high"`,
+		`opt "--size" --choices="small large"`,
+		`opt "--format" --choices="out-1 out-2"`,
+		`opt "--port" --choices="8000 8001 8002" --nargs="2"`,
+		`opt "--user" --complete=value --nargs="+" --help="the \\d user"`,
+		`opt "--quiet" --help="don't print \"anything\""`,
+	}, operations)
+}
+
+func (suite *Suite) TestEvaluateImportedConstants() {
+	suite.CreateFile("app/constants.py", `
+		from enum import IntEnum
+
+		class Verbosity(IntEnum):
+			QUIET = 0
+			LOUD = 1
+
+		TARGETS = ["debug", "release"]
+	`)
+	mainFile := suite.CreateFile("app/main.py", `
+		import argparse
+		import constants
+		from constants import Verbosity
+
+		parser = argparse.ArgumentParser()
+		parser.add_argument("--target", choices=constants.TARGETS)
+		parser.add_argument("--verbosity", choices=[v.value for v in Verbosity], nargs=UNDEFINED)
+	`)
+
+	shell := suite.AutogenParseCfg(`
+		cfg cli_name=testcli
+		cfg autogen_lang=py
+		cfg autogen_file=%s
+		cfg outfile=-
+	`, mainFile)
+	suite.RequireComplete(shell, "testcli --target ", "debug release")
+	suite.RequireComplete(shell, "testcli --verbosity ", "0 1")
+}
+
+func (suite *Suite) TestArgparseActions() {
+	operations := parseSrc(lib.Dedent(`
+		import argparse
+		import pathlib
+		from pathlib import Path
+
+		parser = argparse.ArgumentParser()
+		parser.add_argument("--some-way")
+		parser.add_argument("--flag", action="store_true")
+		parser.add_argument("--no-cache", action="store_false")
+		parser.add_argument("-v", action="count")
+		parser.add_argument("--version", action="version", version="1.0")
+		parser.add_argument("--include", action="append", metavar="PATTERN")
+		parser.add_argument("--config", type=argparse.FileType("r"))
+		parser.add_argument("--root", type=pathlib.Path)
+		parser.add_argument("--log", metavar="FILE", help="where to log")
+		parser.add_argument("--out-dir", metavar="DIR")
+		parser.add_argument("--color", action=argparse.BooleanOptionalAction)
+		parser.add_argument("--token", dest="api_token")
+		parser.add_argument("--debug-internals", help=argparse.SUPPRESS)
+		parser.add_argument("--legacy", default=argparse.SUPPRESS)
+		parser.add_argument("source", type=Path)
+	`))
+	suite.Require().Equal([]string{
+		`opt "--some-way" --complete=value`,
+		`opt "--flag"`,
+		`opt "--no-cache"`,
+		`opt "-v" --nargs="*"`,
+		`opt "--version"`,
+		`opt "--include" --complete=value --nargs="*" --help="PATTERN"`,
+		`opt "--config" --complete=file`,
+		`opt "--root" --complete=file`,
+		`opt "--log" --complete=file --help="where to log"`,
+		`opt "--out-dir" --complete=dir --help="DIR"`,
+		`opt "--color"`,
+		`opt "--no-color"`,
+		`opt "--token" --complete=value --help="api_token"`,
+		`pos --complete=file`,
+	}, operations)
+}
+
+func (suite *Suite) TestArgparseFlagsAndValues() {
+	shell := suite.AutogenParse(`
+		from argparse import ArgumentParser
+		parser = ArgumentParser()
+		parser.add_argument("--some-way")
+		parser.add_argument("--flag", action="store_true")
+		parser.add_argument("--tag", action="append")
+	`)
+	suite.RequireComplete(shell, "testcli ", "--some-way --flag --tag")
+	suite.RequireComplete(shell, "testcli --some-way ", "")
+	suite.RequireComplete(shell, "testcli --flag ", "--some-way --tag")
+	suite.RequireComplete(shell, "testcli --tag a ", "--some-way --flag --tag")
 }
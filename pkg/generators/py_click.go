@@ -0,0 +1,494 @@
+package generators
+
+import (
+	"context"
+	"github.com/rs/zerolog/log"
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/python"
+	"shcomp2/pkg/lib"
+	"strconv"
+	"strings"
+)
+
+// GenerateClickOperations adds the operations of a Click or Typer cli, autogen_lang=py-click
+func GenerateClickOperations(cli lib.Cli) (lib.Cli, error) {
+	return generateOperations(cli, parseClickSrc)
+}
+
+type clickGraph struct {
+	src      []byte
+	commands map[string]*autogenCommand
+	sequence []*autogenCommand
+	apps     map[string]*autogenCommand
+	enums    map[string][]string
+}
+
+func parseClickSrc(srcStr string) []string {
+	src := []byte(srcStr)
+	parser := sitter.NewParser()
+	parser.SetLanguage(python.GetLanguage())
+	tree, _ := parser.ParseCtx(context.Background(), nil, src)
+	root := tree.RootNode()
+
+	graph := clickGraph{
+		src:      src,
+		commands: map[string]*autogenCommand{},
+		apps:     map[string]*autogenCommand{},
+		enums:    map[string][]string{},
+	}
+	graph.findTyperApps(root)
+	graph.findEnums(root)
+	graph.findCommands(root)
+	graph.findAddCalls(root)
+
+	base := graph.base()
+	if base == nil {
+		log.Warn().Msg("no click command, click group or typer app found")
+		return nil
+	}
+	return commandOperations(base, "")
+}
+
+// findTyperApps finds `app = typer.Typer()`, each app is a group
+func (graph *clickGraph) findTyperApps(root *sitter.Node) {
+	for _, node := range queryNodes(python.GetLanguage(), root, `(assignment left: (identifier) right: (call function: (_) @func))`) {
+		if lastName(node.Content(graph.src)) != "Typer" {
+			continue
+		}
+		call := node.Parent()
+		identifier := call.Parent().ChildByFieldName("left").Content(graph.src)
+		_, kwargs := graph.callArguments(call)
+		app := &autogenCommand{identifier: identifier}
+		app.help, _ = graph.stringValue(kwargs["help"])
+		graph.apps[identifier] = app
+		graph.sequence = append(graph.sequence, app)
+	}
+}
+
+// findEnums finds the values of enum classes so Typer parameters typed with them complete as choices
+func (graph *clickGraph) findEnums(root *sitter.Node) {
+	for _, class := range queryNodes(python.GetLanguage(), root, `(class_definition) @class`) {
+		superclasses := class.ChildByFieldName("superclasses")
+		if superclasses == nil || !strings.Contains(superclasses.Content(graph.src), "Enum") {
+			continue
+		}
+		var values []string
+		body := class.ChildByFieldName("body")
+		for i := 0; i < int(body.NamedChildCount()); i++ {
+			statement := body.NamedChild(i)
+			if statement.Type() != "expression_statement" || statement.NamedChild(0).Type() != "assignment" {
+				continue
+			}
+			if value, ok := graph.stringValue(statement.NamedChild(0).ChildByFieldName("right")); ok {
+				values = append(values, value)
+			}
+		}
+		graph.enums[class.ChildByFieldName("name").Content(graph.src)] = values
+	}
+}
+
+// findCommands finds the decorated functions, decorators are read top to bottom which is the order Click shows params in
+func (graph *clickGraph) findCommands(root *sitter.Node) {
+	for _, definition := range queryNodes(python.GetLanguage(), root, `(decorated_definition definition: (function_definition) @func)`) {
+		functionName := definition.ChildByFieldName("name").Content(graph.src)
+		decorated := definition.Parent()
+
+		var command *autogenCommand
+		var params []autogenParam
+		for i := 0; i < int(decorated.NamedChildCount()); i++ {
+			decorator := decorated.NamedChild(i)
+			if decorator.Type() != "decorator" {
+				continue
+			}
+			expression := decorator.NamedChild(0)
+			function := expression
+			var args []*sitter.Node
+			var kwargs map[string]*sitter.Node
+			if expression.Type() == "call" {
+				function = expression.ChildByFieldName("function")
+				args, kwargs = graph.callArguments(expression)
+			}
+			object, kind := splitAttribute(function.Content(graph.src))
+
+			if app, ok := graph.apps[object]; ok {
+				switch kind {
+				case "command":
+					command = graph.newCommand(functionName, definition, args, kwargs)
+					command.parent = app
+					params = append(params, graph.typerParams(definition)...)
+				case "callback":
+					if help, ok := graph.stringValue(kwargs["help"]); ok {
+						app.help = help
+					} else if app.help == "" {
+						app.help = graph.docstring(definition)
+					}
+					app.params = append(app.params, graph.typerParams(definition)...)
+				}
+				continue
+			}
+
+			switch kind {
+			case "command", "group":
+				if object != "" && object != "click" {
+					parent, ok := graph.commands[object]
+					if !ok {
+						log.Warn().Msgf("unknown click group %s for command %s", object, functionName)
+						continue
+					}
+					command = graph.newCommand(functionName, definition, args, kwargs)
+					command.parent = parent
+				} else {
+					command = graph.newCommand(functionName, definition, args, kwargs)
+				}
+			case "option", "argument":
+				if object == "" || object == "click" {
+					params = append(params, graph.clickParam(kind, args, kwargs))
+				}
+			case "version_option":
+				params = append(params, autogenParam{names: []string{"--version"}, help: "Show the version and exit."})
+			}
+		}
+
+		if command != nil {
+			command.params = append(command.params, params...)
+			graph.commands[functionName] = command
+			graph.sequence = append(graph.sequence, command)
+		}
+	}
+
+	for _, command := range graph.sequence {
+		if command.parent != nil {
+			command.parent.commands = append(command.parent.commands, command)
+		}
+	}
+}
+
+// findAddCalls attaches `group.add_command(cmd)` and `app.add_typer(sub, name="sub")`
+func (graph *clickGraph) findAddCalls(root *sitter.Node) {
+	for _, call := range queryNodes(python.GetLanguage(), root, `(call function: (attribute object: (identifier) attribute: (identifier))) @call`) {
+		object, method := splitAttribute(call.ChildByFieldName("function").Content(graph.src))
+		args, kwargs := graph.callArguments(call)
+		if len(args) == 0 {
+			continue
+		}
+
+		var parent, child *autogenCommand
+		switch method {
+		case "add_command":
+			parent, child = graph.commands[object], graph.commands[args[0].Content(graph.src)]
+			if name, ok := graph.stringValue(kwargs["name"]); ok && child != nil {
+				child.name = name
+			} else if len(args) > 1 && child != nil {
+				child.name, _ = graph.stringValue(args[1])
+			}
+		case "add_typer":
+			parent, child = graph.apps[object], graph.apps[args[0].Content(graph.src)]
+			if child != nil {
+				if name, ok := graph.stringValue(kwargs["name"]); ok {
+					child.name = name
+				}
+				if help, ok := graph.stringValue(kwargs["help"]); ok {
+					child.help = help
+				}
+			}
+		default:
+			continue
+		}
+		if parent == nil || child == nil || child.parent != nil {
+			continue
+		}
+		if child.name == "" {
+			log.Warn().Msgf("%s.%s(%s) has no name", object, method, child.identifier)
+			continue
+		}
+		child.parent = parent
+		parent.commands = append(parent.commands, child)
+	}
+}
+
+// base is the first command or app that isn't added to another one
+func (graph *clickGraph) base() *autogenCommand {
+	for _, command := range graph.sequence {
+		if command.parent != nil {
+			continue
+		}
+		// typer runs the only command of an app without a callback directly
+		if _, ok := graph.apps[command.identifier]; ok && len(command.params) == 0 && len(command.commands) == 1 {
+			only := command.commands[0]
+			if _, ok := graph.apps[only.identifier]; !ok {
+				only.parent = nil
+				only.name = ""
+				return only
+			}
+		}
+		return command
+	}
+	return nil
+}
+
+func (graph *clickGraph) newCommand(functionName string, definition *sitter.Node, args []*sitter.Node, kwargs map[string]*sitter.Node) *autogenCommand {
+	command := &autogenCommand{identifier: functionName}
+	if name, ok := graph.stringValue(kwargs["name"]); ok {
+		command.name = name
+	} else if len(args) > 0 {
+		command.name, _ = graph.stringValue(args[0])
+	}
+	if command.name == "" {
+		command.name = strings.ReplaceAll(strings.ToLower(functionName), "_", "-")
+	}
+	if help, ok := graph.stringValue(kwargs["help"]); ok {
+		command.help = help
+	} else {
+		command.help = graph.docstring(definition)
+	}
+	return command
+}
+
+// clickParam reads @click.option("--name", "-n", ...) and @click.argument("name", ...)
+func (graph *clickGraph) clickParam(kind string, args []*sitter.Node, kwargs map[string]*sitter.Node) autogenParam {
+	param := autogenParam{}
+	isFlag := graph.boolValue(kwargs["is_flag"]) || graph.boolValue(kwargs["count"])
+	if kind == "option" {
+		for _, arg := range args {
+			decl, _ := graph.stringValue(arg)
+			// "--shout/--no-shout" declares a flag and its negative
+			isFlag = isFlag || strings.Contains(decl, "/")
+			for _, name := range strings.Split(decl, "/") {
+				if name = strings.TrimSpace(name); strings.HasPrefix(name, "-") {
+					param.names = append(param.names, name)
+				}
+			}
+		}
+		if help, ok := graph.stringValue(kwargs["help"]); ok {
+			param.help = help
+		}
+		if graph.boolValue(kwargs["multiple"]) || graph.boolValue(kwargs["count"]) {
+			param.nargs = "*"
+		} else if nargs, ok := graph.intValue(kwargs["nargs"]); ok && nargs > 1 {
+			param.nargs = strconv.Itoa(nargs)
+		}
+	} else {
+		if nargs, ok := graph.intValue(kwargs["nargs"]); ok {
+			if nargs < 0 && graph.boolValue(kwargs["required"]) {
+				param.nargs = "+"
+			} else if nargs < 0 {
+				param.nargs = "*"
+			} else if nargs > 1 {
+				param.nargs = strconv.Itoa(nargs)
+			}
+		}
+	}
+	graph.paramType(&param, kwargs["type"])
+	if kind == "option" && !isFlag {
+		valueParam(&param)
+	}
+	return param
+}
+
+// valueParam marks an option that takes a value, flags are options without a complete type
+func valueParam(param *autogenParam) {
+	if param.complete == "" && len(param.choices) == 0 {
+		param.complete = lib.CompleteTypeValue
+	}
+}
+
+// paramType reads click.Choice, click.Path and click.File
+func (graph *clickGraph) paramType(param *autogenParam, typeNode *sitter.Node) {
+	if typeNode == nil || typeNode.Type() != "call" {
+		return
+	}
+	args, kwargs := graph.callArguments(typeNode)
+	switch lastName(typeNode.ChildByFieldName("function").Content(graph.src)) {
+	case "Choice":
+		if len(args) > 0 {
+			param.choices = graph.stringList(args[0])
+		}
+	case "Path":
+		param.complete = graph.pathComplete(kwargs)
+	case "File":
+		param.complete = lib.CompleteTypeFile
+	}
+}
+
+func (graph *clickGraph) pathComplete(kwargs map[string]*sitter.Node) string {
+	if fileOkay, ok := kwargs["file_okay"]; ok && !graph.boolValue(fileOkay) {
+		return lib.CompleteTypeDir
+	}
+	return lib.CompleteTypeFile
+}
+
+// typerParams reads the parameters of a Typer command, typer.Option and typer.Argument can be
+// the default or inside Annotated
+func (graph *clickGraph) typerParams(definition *sitter.Node) []autogenParam {
+	var params []autogenParam
+	parameters := definition.ChildByFieldName("parameters")
+	for i := 0; i < int(parameters.NamedChildCount()); i++ {
+		parameter := parameters.NamedChild(i)
+		var nameNode, typeNode, defaultNode *sitter.Node
+		switch parameter.Type() {
+		case "identifier":
+			nameNode = parameter
+		case "typed_parameter":
+			nameNode, typeNode = parameter.NamedChild(0), parameter.ChildByFieldName("type")
+		case "default_parameter", "typed_default_parameter":
+			nameNode, typeNode, defaultNode = parameter.ChildByFieldName("name"), parameter.ChildByFieldName("type"), parameter.ChildByFieldName("value")
+		default:
+			continue
+		}
+		if nameNode == nil || nameNode.Type() != "identifier" {
+			continue
+		}
+		name := nameNode.Content(graph.src)
+		typeName := ""
+		if typeNode != nil {
+			typeName = typeNode.Content(graph.src)
+		}
+
+		// the typer.Option or typer.Argument call, from the default or from Annotated[type, ...]
+		var info *sitter.Node
+		if defaultNode != nil && defaultNode.Type() == "call" {
+			info = defaultNode
+		}
+		if typeNode != nil && strings.HasPrefix(typeName, "Annotated[") {
+			for _, call := range queryNodes(python.GetLanguage(), typeNode, `(call) @call`) {
+				info = call
+				break
+			}
+			if subscript := typeNode.NamedChild(0); subscript != nil && subscript.Type() == "subscript" {
+				typeName = subscript.ChildByFieldName("subscript").Content(graph.src)
+			}
+		}
+		kind := ""
+		var args []*sitter.Node
+		var kwargs map[string]*sitter.Node
+		if info != nil {
+			kind = lastName(info.ChildByFieldName("function").Content(graph.src))
+			args, kwargs = graph.callArguments(info)
+		}
+		if kind != "Option" && kind != "Argument" {
+			if name == "ctx" || strings.HasSuffix(typeName, "Context") {
+				continue
+			}
+			kind = "Option"
+			if defaultNode == nil {
+				kind = "Argument"
+			}
+		}
+
+		param := autogenParam{}
+		isList := strings.HasPrefix(strings.ToLower(typeName), "list[") || strings.HasPrefix(typeName, "List[")
+		if kind == "Option" {
+			for _, arg := range args {
+				if decl, ok := graph.stringValue(arg); ok && strings.HasPrefix(decl, "-") {
+					for _, optName := range strings.Split(decl, "/") {
+						param.names = append(param.names, strings.TrimSpace(optName))
+					}
+				}
+			}
+			if len(param.names) == 0 {
+				optName := "--" + strings.ReplaceAll(name, "_", "-")
+				param.names = []string{optName}
+				if typeName == "bool" {
+					param.names = append(param.names, "--no-"+strings.ReplaceAll(name, "_", "-"))
+				}
+			}
+			if isList {
+				param.nargs = "*"
+			}
+		} else if isList {
+			param.nargs = "*"
+		}
+		if help, ok := graph.stringValue(kwargs["help"]); ok {
+			param.help = help
+		}
+
+		elementType := typeName
+		if isList {
+			elementType = strings.TrimSuffix(elementType[5:], "]")
+		}
+		if values, ok := graph.enums[elementType]; ok {
+			param.choices = values
+		} else if lastName(elementType) == "Path" {
+			param.complete = graph.pathComplete(kwargs)
+		}
+		if kind == "Option" && typeName != "bool" {
+			valueParam(&param)
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+func (graph *clickGraph) callArguments(call *sitter.Node) ([]*sitter.Node, map[string]*sitter.Node) {
+	var args []*sitter.Node
+	kwargs := map[string]*sitter.Node{}
+	arguments := call.ChildByFieldName("arguments")
+	if arguments == nil {
+		return args, kwargs
+	}
+	for i := 0; i < int(arguments.NamedChildCount()); i++ {
+		arg := arguments.NamedChild(i)
+		if arg.Type() == "keyword_argument" {
+			kwargs[arg.ChildByFieldName("name").Content(graph.src)] = arg.ChildByFieldName("value")
+		} else {
+			args = append(args, arg)
+		}
+	}
+	return args, kwargs
+}
+
+// docstring is the first line of a function docstring, Click uses it as the short help
+func (graph *clickGraph) docstring(definition *sitter.Node) string {
+	body := definition.ChildByFieldName("body")
+	if body == nil || body.NamedChildCount() == 0 {
+		return ""
+	}
+	statement := body.NamedChild(0)
+	if statement.Type() != "expression_statement" {
+		return ""
+	}
+	docstring, ok := graph.stringValue(statement.NamedChild(0))
+	if !ok {
+		return ""
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(docstring), "\n")
+	return strings.TrimSpace(line)
+}
+
+func (graph *clickGraph) stringValue(node *sitter.Node) (string, bool) {
+	if node == nil || node.Type() != "string" {
+		return "", false
+	}
+	str := strings.TrimLeft(node.Content(graph.src), "rRuUbB")
+	for _, quote := range []string{`"""`, `'''`, `"`, `'`} {
+		if strings.HasPrefix(str, quote) && strings.HasSuffix(str, quote) && len(str) >= 2*len(quote) {
+			return str[len(quote) : len(str)-len(quote)], true
+		}
+	}
+	return "", false
+}
+
+func (graph *clickGraph) stringList(node *sitter.Node) []string {
+	var values []string
+	if node.Type() != "list" && node.Type() != "tuple" {
+		return values
+	}
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		if value, ok := graph.stringValue(node.NamedChild(i)); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func (graph *clickGraph) intValue(node *sitter.Node) (int, bool) {
+	if node == nil {
+		return 0, false
+	}
+	value, err := strconv.Atoi(strings.ReplaceAll(node.Content(graph.src), " ", ""))
+	return value, err == nil
+}
+
+func (graph *clickGraph) boolValue(node *sitter.Node) bool {
+	return node != nil && node.Type() == "true"
+}
@@ -0,0 +1,194 @@
+package generators
+
+import (
+	"shcomp2/pkg/lib"
+	"strings"
+)
+
+func (suite *Suite) TestClickGroup() {
+	shell := suite.AutogenParseLang("py-click", `
+		import click
+
+		@click.group()
+		@click.option("--verbose", "-v", is_flag=True, help="print more output")
+		def cli(verbose):
+			pass
+
+		@cli.command()
+		@click.argument("task", type=click.Choice(["build", "test"]))
+		@click.option("--config", type=click.Path(exists=True))
+		def run(task, config):
+			"""Run a task.
+
+			Longer description.
+			"""
+
+		@cli.group()
+		def deploy():
+			pass
+
+		@deploy.command("remote")
+		@click.argument("hosts", nargs=-1)
+		def deploy_remote(hosts):
+			pass
+	`)
+	suite.RequireComplete(shell, "testcli -", "--verbose -- print more output -v        -- print more output")
+	suite.RequireComplete(shell, "testcli r", "run")
+	suite.RequireComplete(shell, "testcli run ", "build test --config")
+	suite.RequireComplete(shell, "testcli deploy ", "remote")
+}
+
+func (suite *Suite) TestClickOperations() {
+	operations := parseClickSrc(lib.Dedent(`
+		import click
+
+		@click.command()
+		@click.option("--shout/--no-shout", default=False)
+		@click.option("--tag", "-t", multiple=True)
+		@click.option("--level", type=click.Choice(["debug", "info"]), help="log level")
+		@click.option("--out", type=click.Path(file_okay=False))
+		@click.option("--input", type=click.File("r"))
+		@click.option("--point", nargs=2)
+		@click.argument("src", nargs=-1, required=True)
+		@click.argument("dst")
+		def copy(shout, tag, level, out, input, point, src, dst):
+			pass
+	`))
+	suite.Require().Equal([]string{
+		`opt "--shout|--no-shout"`,
+		`opt "--tag" --complete=value --nargs="*"`,
+		`opt "-t" --complete=value --nargs="*"`,
+		`opt "--level" --choices="debug info" --help="log level"`,
+		`opt "--out" --complete=dir`,
+		`opt "--input" --complete=file`,
+		`opt "--point" --complete=value --nargs="2"`,
+		`pos --nargs="+"`,
+		`pos`,
+	}, operations)
+}
+
+func (suite *Suite) TestClickRepeatedAliases() {
+	shell := suite.AutogenParseLang("py-click", `
+		import click
+
+		@click.command()
+		@click.option("-t", "--tag", multiple=True)
+		@click.option("-v", "--verbose", count=True)
+		def cli(tag, verbose):
+			pass
+	`)
+	suite.RequireComplete(shell, "testcli --", "--tag --verbose")
+	suite.RequireComplete(shell, "testcli -t a --", "--tag --verbose")
+	suite.RequireComplete(shell, "testcli -v -v --", "--tag --verbose")
+}
+
+func (suite *Suite) TestAddOperationsError() {
+	cli, err := lib.ParseOperations("cfg cli_name=testcli")
+	suite.Require().NoError(err)
+	_, err = addOperations(cli, []string{`opt "--tag|-t" --nargs="*"`})
+	suite.Require().EqualError(err, "unable to use the generated operations: 2:5: nargs and alternatives is not supported")
+}
+
+func (suite *Suite) TestClickSameOperationsAsArgparse() {
+	click := parseClickSrc(lib.Dedent(`
+		import click
+
+		@click.group()
+		@click.option("--some-way")
+		def cli(some_way):
+			pass
+
+		@cli.command("sub-cmd-name", help="does things")
+		@click.argument("arg1", type=click.Choice(["c1", "c2", "c3"]))
+		def sub_cmd(arg1):
+			pass
+	`))
+	argparse := parseSrc(lib.Dedent(`
+		from argparse import ArgumentParser
+		parser = ArgumentParser()
+		parser.add_argument("--some-way")
+		subparsers = parser.add_subparsers()
+		parser_cmd = subparsers.add_parser("sub-cmd-name", help="does things")
+		parser_cmd.add_argument("arg1", choices=["c1", "c2", "c3"])
+	`))
+
+	clickCli, err := lib.ParseOperations("cfg cli_name=testcli\n" + strings.Join(click, "\n"))
+	suite.Require().NoError(err)
+	argparseCli, err := lib.ParseOperations("cfg cli_name=testcli\n" + strings.Join(argparse, "\n"))
+	suite.Require().NoError(err)
+	suite.Require().Equal(argparseCli.Parsers, clickCli.Parsers)
+}
+
+func (suite *Suite) TestClickAddCommand() {
+	shell := suite.AutogenParseLang("py-click", `
+		import click
+
+		@click.command()
+		def init():
+			"""Create a project."""
+
+		@click.command()
+		def build():
+			pass
+
+		@click.group()
+		def cli():
+			pass
+
+		cli.add_command(init)
+		cli.add_command(build, name="make")
+	`)
+	suite.RequireComplete(shell, "testcli ", "init -- Create a project. make")
+}
+
+func (suite *Suite) TestTyperApp() {
+	shell := suite.AutogenParseLang("py-click", `
+		from enum import Enum
+		from pathlib import Path
+		from typing import List
+		import typer
+		from typing_extensions import Annotated
+
+		class Color(str, Enum):
+			red = "red"
+			green = "green"
+
+		app = typer.Typer()
+		users = typer.Typer(help="manage users")
+		app.add_typer(users, name="users")
+
+		@app.callback()
+		def main(verbose: bool = False):
+			pass
+
+		@app.command()
+		def paint(color: Color, config: Path = typer.Option(None, "--config", "-c", dir_okay=False, help="config file")):
+			pass
+
+		@users.command("add")
+		def add_user(name: str, groups: Annotated[List[str], typer.Option("--group")] = []):
+			"""Add a user."""
+	`)
+	suite.RequireComplete(shell, "testcli -", "--verbose --no-verbose")
+	suite.RequireComplete(shell, "testcli ", "paint users        -- manage users --verbose --no-verbose")
+	suite.RequireComplete(shell, "testcli paint ", "red green --config -- config file -c       -- config file")
+	suite.RequireComplete(shell, "testcli users ", "add")
+	suite.RequireComplete(shell, "testcli users add bob --group x ", "--group")
+}
+
+func (suite *Suite) TestTyperSingleCommand() {
+	operations := parseClickSrc(lib.Dedent(`
+		import typer
+
+		app = typer.Typer()
+
+		@app.command()
+		def main(name: str, count: int = 1, force: bool = typer.Option(False, "--force/--no-force", "-f")):
+			pass
+	`))
+	suite.Require().Equal([]string{
+		`pos`,
+		`opt "--count" --complete=value`,
+		`opt "--force|--no-force|-f"`,
+	}, operations)
+}
@@ -0,0 +1,1124 @@
+package generators
+
+import (
+	"errors"
+	"fmt"
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/python"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pyEnum is an Enum subclass, iterating it gives its members
+type pyEnum struct {
+	name    string
+	members []pyEnumMember
+}
+
+type pyEnumMember struct {
+	enum  string
+	name  string
+	value interface{}
+}
+
+// pyDict keeps its keys in insertion order, iterating it gives the keys
+type pyDict struct {
+	keys   []interface{}
+	values []interface{}
+}
+
+// pyReference is the name of something that isn't a constant, like the class in type=pathlib.Path
+type pyReference string
+
+// pySuppress is argparse.SUPPRESS, arguments with it as help or default are hidden
+const pySuppress = "==SUPPRESS=="
+
+// argparseConstants are the module constants of argparse that add_argument is called with
+var argparseConstants = map[string]interface{}{
+	"SUPPRESS":     pySuppress,
+	"OPTIONAL":     "?",
+	"ZERO_OR_MORE": "*",
+	"ONE_OR_MORE":  "+",
+	"REMAINDER":    "...",
+}
+
+// pyEvaluatorMaxDepth stops constants that are defined through themselves
+const pyEvaluatorMaxDepth = 64
+
+// pyEvaluator resolves the expressions add_argument is called with. Names are looked up in the enclosing
+// functions, the module and what it imports, only literals and what can be computed from them resolve
+type pyEvaluator struct {
+	callGraph *pyArgumentParserGraph
+	module    *pyModule
+	// scope has the variables of the comprehensions being evaluated
+	scope map[string]interface{}
+	depth int
+}
+
+func (callGraph *pyArgumentParserGraph) evaluator(module *pyModule) *pyEvaluator {
+	return &pyEvaluator{callGraph: callGraph, module: module, scope: map[string]interface{}{}}
+}
+
+// in evaluates the constants of another module
+func (e *pyEvaluator) in(module *pyModule) *pyEvaluator {
+	return &pyEvaluator{callGraph: e.callGraph, module: module, scope: map[string]interface{}{}, depth: e.depth}
+}
+
+func (e *pyEvaluator) eval(node *sitter.Node) (interface{}, error) {
+	if node == nil {
+		return nil, errors.New("missing expression")
+	}
+	if e.depth > pyEvaluatorMaxDepth {
+		return nil, fmt.Errorf("`%s` nests too deep", node.Content(e.module.src))
+	}
+	e.depth++
+	defer func() { e.depth-- }()
+
+	src := e.module.src
+	switch node.Type() {
+	case "string":
+		return e.str(node)
+	case "concatenated_string":
+		var b strings.Builder
+		for _, part := range namedChildren(node) {
+			str, err := e.str(part)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(str)
+		}
+		return b.String(), nil
+	case "integer":
+		value, err := strconv.ParseInt(node.Content(src), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s", node.Content(src))
+		}
+		return int(value), nil
+	case "float":
+		value, err := strconv.ParseFloat(strings.ReplaceAll(node.Content(src), "_", ""), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %s", node.Content(src))
+		}
+		return value, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "none":
+		return nil, nil
+	case "list", "tuple":
+		return e.elements(node)
+	case "set":
+		values, err := e.elements(node)
+		if err != nil {
+			return nil, err
+		}
+		return unique(values), nil
+	case "dictionary":
+		return e.dictionary(node)
+	case "parenthesized_expression":
+		return e.eval(node.NamedChild(0))
+	case "assignment":
+		// A = B = value
+		return e.eval(node.ChildByFieldName("right"))
+	case "identifier":
+		return e.name(node)
+	case "attribute":
+		return e.attribute(node)
+	case "subscript":
+		return e.subscript(node)
+	case "call":
+		return e.call(node)
+	case "list_comprehension", "set_comprehension", "generator_expression", "dictionary_comprehension":
+		return e.comprehension(node)
+	case "unary_operator":
+		return e.unary(node)
+	case "binary_operator":
+		return e.binary(node)
+	case "comparison_operator":
+		return e.comparison(node)
+	case "boolean_operator":
+		left, err := e.eval(node.ChildByFieldName("left"))
+		if err != nil {
+			return nil, err
+		}
+		if (node.ChildByFieldName("operator").Type() == "and") == truthy(left) {
+			return e.eval(node.ChildByFieldName("right"))
+		}
+		return left, nil
+	case "not_operator":
+		value, err := e.eval(node.ChildByFieldName("argument"))
+		if err != nil {
+			return nil, err
+		}
+		return !truthy(value), nil
+	case "conditional_expression":
+		condition, err := e.eval(node.NamedChild(1))
+		if err != nil {
+			return nil, err
+		}
+		if truthy(condition) {
+			return e.eval(node.NamedChild(0))
+		}
+		return e.eval(node.NamedChild(2))
+	}
+	return nil, fmt.Errorf("can't evaluate %s `%s`", node.Type(), node.Content(src))
+}
+
+// str is the text of a string literal with its escapes decoded unless it's raw. f-strings resolve their
+// replacement fields
+func (e *pyEvaluator) str(node *sitter.Node) (string, error) {
+	src := e.module.src
+	content := node.Content(src)
+	prefixLen := len(content) - len(strings.TrimLeft(content, "rRuUbBfF"))
+	quoted := content[prefixLen:]
+	quote := ""
+	for _, q := range []string{`"""`, `'''`, `"`, `'`} {
+		if strings.HasPrefix(quoted, q) && strings.HasSuffix(quoted, q) && len(quoted) >= 2*len(q) {
+			quote = q
+			break
+		}
+	}
+	if quote == "" {
+		return "", fmt.Errorf("can't read string %s", content)
+	}
+	literal := pyUnescape
+	if strings.ContainsAny(content[:prefixLen], "rR") {
+		literal = func(s string) string { return s }
+	}
+	if !strings.ContainsAny(content[:prefixLen], "fF") {
+		return literal(quoted[len(quote) : len(quoted)-len(quote)]), nil
+	}
+
+	braces := strings.NewReplacer("{{", "{", "}}", "}")
+	var b strings.Builder
+	offset := node.StartByte() + uint32(prefixLen+len(quote))
+	for _, child := range namedChildren(node) {
+		if child.Type() != "interpolation" {
+			continue
+		}
+		b.WriteString(literal(braces.Replace(string(src[offset:child.StartByte()]))))
+		for _, part := range namedChildren(child)[1:] {
+			if part.Type() != "type_conversion" || part.Content(src) != "!s" {
+				return "", fmt.Errorf("can't format `%s`", child.Content(src))
+			}
+		}
+		value, err := e.eval(child.NamedChild(0))
+		if err != nil {
+			return "", err
+		}
+		str, err := pyStr(value)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(str)
+		offset = child.EndByte()
+	}
+	b.WriteString(literal(braces.Replace(string(src[offset : node.EndByte()-uint32(len(quote))]))))
+	return b.String(), nil
+}
+
+// pyEscapes are the single character escapes of python string literals
+var pyEscapes = map[byte]string{
+	'\\': "\\", '\'': "'", '"': `"`, 'a': "\a", 'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t", 'v': "\v", '\n': "",
+}
+
+// pyUnescape decodes the escapes of a string literal, unknown escapes stay as written like python does
+func pyUnescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		next := s[i+1]
+		if escaped, ok := pyEscapes[next]; ok {
+			b.WriteString(escaped)
+			i++
+			continue
+		}
+		digits, base := 0, 16
+		switch next {
+		case 'x':
+			digits = 2
+		case 'u':
+			digits = 4
+		case 'U':
+			digits = 8
+		default:
+			if next >= '0' && next <= '7' {
+				base = 8
+				for digits < 3 && i+1+digits < len(s) && s[i+1+digits] >= '0' && s[i+1+digits] <= '7' {
+					digits++
+				}
+			}
+		}
+		start := i + 2
+		if base == 8 {
+			start = i + 1
+		}
+		if digits == 0 || start+digits > len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		code, err := strconv.ParseUint(s[start:start+digits], base, 32)
+		if err != nil {
+			b.WriteByte(s[i])
+			continue
+		}
+		b.WriteRune(rune(code))
+		i = start + digits - 1
+	}
+	return b.String()
+}
+
+// elements are the values of a list, tuple or set, *other is expanded
+func (e *pyEvaluator) elements(node *sitter.Node) ([]interface{}, error) {
+	values := []interface{}{}
+	for _, child := range namedChildren(node) {
+		if child.Type() == "list_splat" {
+			value, err := e.eval(child.NamedChild(0))
+			if err != nil {
+				return nil, err
+			}
+			items, err := pyIterable(value)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, items...)
+			continue
+		}
+		value, err := e.eval(child)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (e *pyEvaluator) dictionary(node *sitter.Node) (interface{}, error) {
+	dict := pyDict{}
+	for _, child := range namedChildren(node) {
+		switch child.Type() {
+		case "pair":
+			key, err := e.eval(child.ChildByFieldName("key"))
+			if err != nil {
+				return nil, err
+			}
+			value, err := e.eval(child.ChildByFieldName("value"))
+			if err != nil {
+				return nil, err
+			}
+			dict.set(key, value)
+		case "dictionary_splat":
+			value, err := e.eval(child.NamedChild(0))
+			if err != nil {
+				return nil, err
+			}
+			other, ok := value.(pyDict)
+			if !ok {
+				return nil, fmt.Errorf("`%s` isn't a dict", child.Content(e.module.src))
+			}
+			for i, key := range other.keys {
+				dict.set(key, other.values[i])
+			}
+		default:
+			return nil, fmt.Errorf("can't evaluate %s `%s`", child.Type(), child.Content(e.module.src))
+		}
+	}
+	return dict, nil
+}
+
+// name resolves a variable of a comprehension, an assignment in an enclosing function before node,
+// a module constant, an Enum class or a name imported from another file
+func (e *pyEvaluator) name(node *sitter.Node) (interface{}, error) {
+	src := e.module.src
+	name := node.Content(src)
+	if value, ok := e.scope[name]; ok {
+		return value, nil
+	}
+	inFunction := false
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Type() != "function_definition" {
+			continue
+		}
+		inFunction = true
+		if contains(pyParameters(parent, src), name) {
+			return nil, fmt.Errorf("%s is a parameter of %s", name, parent.ChildByFieldName("name").Content(src))
+		}
+		if assignment := lastAssignment(queryNodes(python.GetLanguage(), parent.ChildByFieldName("body"), `(assignment) @assignment`), name, node, src); assignment != nil {
+			return e.eval(assignment.ChildByFieldName("right"))
+		}
+	}
+	if inFunction {
+		// functions run after the module is loaded, they see the last value of a constant
+		return e.global(name, nil)
+	}
+	return e.global(name, node)
+}
+
+// global is a name defined at the top of the module, the last assignment before node when node is set
+func (e *pyEvaluator) global(name string, node *sitter.Node) (interface{}, error) {
+	src := e.module.src
+	if assignments := e.module.constants[name]; len(assignments) > 0 {
+		assignment := assignments[len(assignments)-1]
+		if node != nil {
+			if before := lastAssignment(assignments, name, node, src); before != nil {
+				assignment = before
+			}
+		}
+		return e.eval(assignment.ChildByFieldName("right"))
+	}
+	if class, ok := e.module.enums[name]; ok {
+		return e.enum(class)
+	}
+	if imported, ok := e.module.imports[name]; ok && imported.function != "" {
+		if module := e.callGraph.module(imported.file); module != nil {
+			return e.in(module).global(imported.function, nil)
+		}
+	}
+	for _, file := range e.module.wildcards {
+		if module := e.callGraph.module(file); module != nil {
+			if value, err := e.in(module).global(name, nil); err == nil {
+				return value, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s isn't a constant", name)
+}
+
+// lastAssignment is the last `name = value` that ends before node
+func lastAssignment(assignments []*sitter.Node, name string, node *sitter.Node, src []byte) *sitter.Node {
+	var last *sitter.Node
+	for _, assignment := range assignments {
+		left := assignment.ChildByFieldName("left")
+		if left.Type() == "identifier" && left.Content(src) == name && assignment.ChildByFieldName("right") != nil &&
+			assignment.EndByte() <= node.StartByte() {
+			last = assignment
+		}
+	}
+	return last
+}
+
+// enum is the members of an Enum class in definition order, auto() counts from 1 or is the lowercase name of a StrEnum
+func (e *pyEvaluator) enum(class *sitter.Node) (interface{}, error) {
+	src := e.module.src
+	enum := pyEnum{name: class.ChildByFieldName("name").Content(src)}
+	strEnum := strings.Contains(class.ChildByFieldName("superclasses").Content(src), "StrEnum")
+	next := 1
+	var values []interface{}
+	for _, statement := range namedChildren(class.ChildByFieldName("body")) {
+		if statement.Type() != "expression_statement" || statement.NamedChild(0).Type() != "assignment" {
+			continue
+		}
+		assignment := statement.NamedChild(0)
+		left, right := assignment.ChildByFieldName("left"), assignment.ChildByFieldName("right")
+		name := left.Content(src)
+		if left.Type() != "identifier" || right == nil || strings.HasPrefix(name, "_") {
+			continue
+		}
+
+		var value interface{}
+		if right.Type() == "call" && lastName(right.ChildByFieldName("function").Content(src)) == "auto" {
+			if strEnum {
+				value = strings.ToLower(name)
+			} else {
+				value = next
+			}
+		} else {
+			var err error
+			if value, err = e.eval(right); err != nil {
+				return nil, err
+			}
+		}
+		if number, ok := value.(int); ok {
+			next = number + 1
+		}
+		// a member with the value of an earlier one is an alias and isn't iterated
+		if indexOf(values, value) != -1 {
+			continue
+		}
+		values = append(values, value)
+		enum.members = append(enum.members, pyEnumMember{enum: enum.name, name: name, value: value})
+	}
+	return enum, nil
+}
+
+func (e *pyEvaluator) attribute(node *sitter.Node) (interface{}, error) {
+	src := e.module.src
+	object := node.ChildByFieldName("object")
+	attribute := node.ChildByFieldName("attribute").Content(src)
+	if object.Type() == "identifier" {
+		objectName := object.Content(src)
+		if _, ok := e.scope[objectName]; !ok {
+			if objectName == "argparse" {
+				if value, ok := argparseConstants[attribute]; ok {
+					return value, nil
+				}
+			}
+			// constants.ENVIRONMENTS with `import constants`
+			if imported, ok := e.module.imports[objectName]; ok && imported.function == "" {
+				if module := e.callGraph.module(imported.file); module != nil {
+					return e.in(module).global(attribute, nil)
+				}
+			}
+		}
+	}
+
+	value, err := e.eval(object)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case pyEnum:
+		if attribute == "__members__" {
+			members := pyDict{}
+			for _, member := range v.members {
+				members.set(member.name, member)
+			}
+			return members, nil
+		}
+		for _, member := range v.members {
+			if member.name == attribute {
+				return member, nil
+			}
+		}
+	case pyEnumMember:
+		switch attribute {
+		case "name":
+			return v.name, nil
+		case "value":
+			return v.value, nil
+		}
+	}
+	return nil, fmt.Errorf("can't evaluate `%s`", node.Content(src))
+}
+
+func (e *pyEvaluator) subscript(node *sitter.Node) (interface{}, error) {
+	value, err := e.eval(node.ChildByFieldName("value"))
+	if err != nil {
+		return nil, err
+	}
+	key, err := e.eval(node.ChildByFieldName("subscript"))
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		if i, ok := key.(int); ok {
+			if i < 0 {
+				i += len(v)
+			}
+			if i >= 0 && i < len(v) {
+				return v[i], nil
+			}
+		}
+	case pyDict:
+		if i := indexOf(v.keys, key); i != -1 {
+			return v.values[i], nil
+		}
+	case pyEnum:
+		for _, member := range v.members {
+			if member.name == key {
+				return member, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("can't evaluate `%s`", node.Content(e.module.src))
+}
+
+// call evaluates the builtins that make collections like list(Color), sorted(REGIONS) or range(1, 4)
+// and methods like ENVIRONMENTS.keys() or "a b".split()
+func (e *pyEvaluator) call(node *sitter.Node) (interface{}, error) {
+	src := e.module.src
+	unsupported := fmt.Errorf("can't evaluate call `%s`", node.Content(src))
+	var args []interface{}
+	kwargs := map[string]interface{}{}
+	argumentsNode := node.ChildByFieldName("arguments")
+	if argumentsNode.Type() == "generator_expression" {
+		value, err := e.eval(argumentsNode)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	} else {
+		for _, argNode := range namedChildren(argumentsNode) {
+			switch argNode.Type() {
+			case "keyword_argument":
+				value, err := e.eval(argNode.ChildByFieldName("value"))
+				if err != nil {
+					return nil, err
+				}
+				kwargs[argNode.ChildByFieldName("name").Content(src)] = value
+			case "list_splat", "dictionary_splat":
+				return nil, unsupported
+			default:
+				value, err := e.eval(argNode)
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, value)
+			}
+		}
+	}
+
+	function := node.ChildByFieldName("function")
+	if function.Type() == "attribute" {
+		object, err := e.eval(function.ChildByFieldName("object"))
+		if err != nil {
+			return nil, err
+		}
+		value, ok := pyMethod(object, function.ChildByFieldName("attribute").Content(src), args)
+		if !ok {
+			return nil, unsupported
+		}
+		return value, nil
+	}
+	if function.Type() != "identifier" {
+		return nil, unsupported
+	}
+
+	name := function.Content(src)
+	if len(kwargs) > 0 && name != "sorted" {
+		return nil, unsupported
+	}
+	switch name {
+	case "list", "tuple", "set", "frozenset", "sorted", "reversed":
+		var items []interface{}
+		if len(args) > 0 {
+			var err error
+			if items, err = pyIterable(args[0]); err != nil {
+				return nil, err
+			}
+		}
+		items = append([]interface{}{}, items...)
+		switch name {
+		case "set", "frozenset":
+			items = unique(items)
+		case "sorted":
+			if _, ok := kwargs["key"]; ok {
+				return nil, unsupported
+			}
+			if err := pySort(items); err != nil {
+				return nil, err
+			}
+			if truthy(kwargs["reverse"]) {
+				reverse(items)
+			}
+		case "reversed":
+			reverse(items)
+		}
+		return items, nil
+	case "str":
+		if len(args) == 1 {
+			return pyStr(args[0])
+		}
+	case "int":
+		if len(args) == 1 {
+			switch v := args[0].(type) {
+			case int:
+				return v, nil
+			case float64:
+				return int(v), nil
+			case string:
+				if number, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+					return number, nil
+				}
+			}
+		}
+	case "len":
+		if len(args) == 1 {
+			items, err := pyIterable(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return len(items), nil
+		}
+	case "range":
+		bounds := []int{0, 0, 1}
+		if len(args) == 0 || len(args) > 3 {
+			return nil, unsupported
+		}
+		for i, arg := range args {
+			number, ok := arg.(int)
+			if !ok {
+				return nil, unsupported
+			}
+			if len(args) == 1 {
+				i = 1
+			}
+			bounds[i] = number
+		}
+		if bounds[2] == 0 {
+			return nil, unsupported
+		}
+		values := []interface{}{}
+		for i := bounds[0]; (bounds[2] > 0 && i < bounds[1]) || (bounds[2] < 0 && i > bounds[1]); i += bounds[2] {
+			values = append(values, i)
+		}
+		return values, nil
+	}
+	return nil, unsupported
+}
+
+// pyMethod calls the methods of dicts and strings that make choices
+func pyMethod(object interface{}, method string, args []interface{}) (interface{}, bool) {
+	switch v := object.(type) {
+	case pyDict:
+		switch method {
+		case "keys":
+			return append([]interface{}{}, v.keys...), true
+		case "values":
+			return append([]interface{}{}, v.values...), true
+		case "items":
+			items := []interface{}{}
+			for i, key := range v.keys {
+				items = append(items, []interface{}{key, v.values[i]})
+			}
+			return items, true
+		}
+	case string:
+		switch {
+		case method == "split" && len(args) == 0:
+			return stringValues(strings.Fields(v)), true
+		case method == "split" && len(args) == 1:
+			if sep, ok := args[0].(string); ok && sep != "" {
+				return stringValues(strings.Split(v, sep)), true
+			}
+		case method == "join" && len(args) == 1:
+			items, err := pyIterable(args[0])
+			if err != nil {
+				return nil, false
+			}
+			parts := make([]string, len(items))
+			for i, item := range items {
+				str, ok := item.(string)
+				if !ok {
+					return nil, false
+				}
+				parts[i] = str
+			}
+			return strings.Join(parts, v), true
+		case method == "lower" && len(args) == 0:
+			return strings.ToLower(v), true
+		case method == "upper" && len(args) == 0:
+			return strings.ToUpper(v), true
+		case method == "strip" && len(args) == 0:
+			return strings.TrimSpace(v), true
+		}
+	}
+	return nil, false
+}
+
+// comprehension evaluates the body for every item of the for clauses that passes the if clauses
+func (e *pyEvaluator) comprehension(node *sitter.Node) (interface{}, error) {
+	body := node.ChildByFieldName("body")
+	var clauses []*sitter.Node
+	for _, child := range namedChildren(node) {
+		if !child.Equal(body) {
+			clauses = append(clauses, child)
+		}
+	}
+
+	outer := e.scope
+	e.scope = map[string]interface{}{}
+	for name, value := range outer {
+		e.scope[name] = value
+	}
+	defer func() { e.scope = outer }()
+
+	values := []interface{}{}
+	dict := pyDict{}
+	err := e.clauses(clauses, func() error {
+		if node.Type() == "dictionary_comprehension" {
+			key, err := e.eval(body.ChildByFieldName("key"))
+			if err != nil {
+				return err
+			}
+			value, err := e.eval(body.ChildByFieldName("value"))
+			if err != nil {
+				return err
+			}
+			dict.set(key, value)
+			return nil
+		}
+		value, err := e.eval(body)
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch node.Type() {
+	case "dictionary_comprehension":
+		return dict, nil
+	case "set_comprehension":
+		return unique(values), nil
+	}
+	return values, nil
+}
+
+func (e *pyEvaluator) clauses(clauses []*sitter.Node, yield func() error) error {
+	if len(clauses) == 0 {
+		return yield()
+	}
+	clause := clauses[0]
+	switch clause.Type() {
+	case "for_in_clause":
+		iterable, err := e.eval(clause.ChildByFieldName("right"))
+		if err != nil {
+			return err
+		}
+		items, err := pyIterable(iterable)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := e.bind(clause.ChildByFieldName("left"), item); err != nil {
+				return err
+			}
+			if err := e.clauses(clauses[1:], yield); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "if_clause":
+		condition, err := e.eval(clause.NamedChild(0))
+		if err != nil {
+			return err
+		}
+		if truthy(condition) {
+			return e.clauses(clauses[1:], yield)
+		}
+		return nil
+	}
+	return fmt.Errorf("can't evaluate %s `%s`", clause.Type(), clause.Content(e.module.src))
+}
+
+// bind assigns the loop variable of a for clause, `for key, value in` unpacks
+func (e *pyEvaluator) bind(target *sitter.Node, value interface{}) error {
+	src := e.module.src
+	switch target.Type() {
+	case "identifier":
+		e.scope[target.Content(src)] = value
+		return nil
+	case "pattern_list", "tuple_pattern", "list_pattern":
+		items, err := pyIterable(value)
+		targets := namedChildren(target)
+		if err != nil || len(items) != len(targets) {
+			return fmt.Errorf("can't unpack into `%s`", target.Content(src))
+		}
+		for i, item := range items {
+			if err := e.bind(targets[i], item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("can't assign to `%s`", target.Content(src))
+}
+
+func (e *pyEvaluator) unary(node *sitter.Node) (interface{}, error) {
+	value, err := e.eval(node.ChildByFieldName("argument"))
+	if err != nil {
+		return nil, err
+	}
+	switch operator := node.ChildByFieldName("operator").Type(); {
+	case operator == "+":
+		return value, nil
+	case operator == "-":
+		switch v := value.(type) {
+		case int:
+			return -v, nil
+		case float64:
+			return -v, nil
+		}
+	}
+	return nil, fmt.Errorf("can't evaluate `%s`", node.Content(e.module.src))
+}
+
+// binary evaluates + on numbers, strings and lists, and - and * on numbers
+func (e *pyEvaluator) binary(node *sitter.Node) (interface{}, error) {
+	left, err := e.eval(node.ChildByFieldName("left"))
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.eval(node.ChildByFieldName("right"))
+	if err != nil {
+		return nil, err
+	}
+	operator := node.ChildByFieldName("operator").Type()
+	switch l := left.(type) {
+	case int:
+		if r, ok := right.(int); ok {
+			switch operator {
+			case "+":
+				return l + r, nil
+			case "-":
+				return l - r, nil
+			case "*":
+				return l * r, nil
+			}
+		}
+	case string:
+		if r, ok := right.(string); ok && operator == "+" {
+			return l + r, nil
+		}
+	case []interface{}:
+		if r, ok := right.([]interface{}); ok && operator == "+" {
+			return append(append([]interface{}{}, l...), r...), nil
+		}
+	}
+	return nil, fmt.Errorf("can't evaluate `%s`", node.Content(e.module.src))
+}
+
+// comparison evaluates a single comparison like `c != Color.RED` or `x not in SKIP`
+func (e *pyEvaluator) comparison(node *sitter.Node) (interface{}, error) {
+	src := e.module.src
+	operands := namedChildren(node)
+	if len(operands) != 2 {
+		return nil, fmt.Errorf("can't evaluate `%s`", node.Content(src))
+	}
+	operator := strings.Join(strings.Fields(string(src[operands[0].EndByte():operands[1].StartByte()])), " ")
+	left, err := e.eval(operands[0])
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.eval(operands[1])
+	if err != nil {
+		return nil, err
+	}
+
+	switch operator {
+	case "==", "is":
+		return reflect.DeepEqual(left, right), nil
+	case "!=", "is not":
+		return !reflect.DeepEqual(left, right), nil
+	case "in", "not in":
+		var found bool
+		if str, ok := right.(string); ok {
+			substr, ok := left.(string)
+			if !ok {
+				return nil, fmt.Errorf("can't evaluate `%s`", node.Content(src))
+			}
+			found = strings.Contains(str, substr)
+		} else {
+			items, err := pyIterable(right)
+			if err != nil {
+				return nil, err
+			}
+			found = indexOf(items, left) != -1
+		}
+		return found == (operator == "in"), nil
+	case "<", "<=", ">", ">=":
+		order, err := pyCompare(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch operator {
+		case "<":
+			return order < 0, nil
+		case "<=":
+			return order <= 0, nil
+		case ">":
+			return order > 0, nil
+		}
+		return order >= 0, nil
+	}
+	return nil, fmt.Errorf("can't evaluate `%s`", node.Content(src))
+}
+
+func (dict *pyDict) set(key interface{}, value interface{}) {
+	if i := indexOf(dict.keys, key); i != -1 {
+		dict.values[i] = value
+		return
+	}
+	dict.keys = append(dict.keys, key)
+	dict.values = append(dict.values, value)
+}
+
+// pyIterable is what `for item in value` goes through
+func pyIterable(value interface{}) ([]interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, nil
+	case pyDict:
+		return v.keys, nil
+	case pyEnum:
+		members := make([]interface{}, len(v.members))
+		for i, member := range v.members {
+			members[i] = member
+		}
+		return members, nil
+	case string:
+		chars := []interface{}{}
+		for _, r := range v {
+			chars = append(chars, string(r))
+		}
+		return chars, nil
+	}
+	return nil, fmt.Errorf("%s isn't iterable", pyTypeName(value))
+}
+
+// pyStr is str(value)
+func pyStr(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		str := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.ContainsAny(str, ".e") {
+			str += ".0"
+		}
+		return str, nil
+	case bool:
+		if v {
+			return "True", nil
+		}
+		return "False", nil
+	case nil:
+		return "None", nil
+	case pyEnumMember:
+		return v.enum + "." + v.name, nil
+	}
+	return "", fmt.Errorf("can't convert %s to a string", pyTypeName(value))
+}
+
+// pyChoice is the word typed for a choice, enum members are converted from their value by `type=Color`
+func pyChoice(value interface{}) (string, error) {
+	if member, ok := value.(pyEnumMember); ok {
+		return pyStr(member.value)
+	}
+	return pyStr(value)
+}
+
+func pyTypeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "str"
+	case int:
+		return "int"
+	case float64:
+		return "float"
+	case bool:
+		return "bool"
+	case nil:
+		return "None"
+	case []interface{}:
+		return "list"
+	case pyDict:
+		return "dict"
+	case pyEnum:
+		return "Enum"
+	case pyEnumMember:
+		return "Enum member"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case pyDict:
+		return len(v.keys) > 0
+	}
+	return true
+}
+
+// pyCompare orders two numbers or two strings
+func pyCompare(left interface{}, right interface{}) (int, error) {
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			return strings.Compare(l, r), nil
+		}
+	}
+	l, lok := pyNumber(left)
+	r, rok := pyNumber(right)
+	if !lok || !rok {
+		return 0, fmt.Errorf("can't compare %s and %s", pyTypeName(left), pyTypeName(right))
+	}
+	switch {
+	case l < r:
+		return -1, nil
+	case l > r:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func pyNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func pySort(items []interface{}) error {
+	var err error
+	sort.SliceStable(items, func(i, j int) bool {
+		order, compareErr := pyCompare(items[i], items[j])
+		if compareErr != nil {
+			err = compareErr
+		}
+		return order < 0
+	})
+	return err
+}
+
+func indexOf(values []interface{}, value interface{}) int {
+	for i, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return i
+		}
+	}
+	return -1
+}
+
+func unique(values []interface{}) []interface{} {
+	result := []interface{}{}
+	for _, value := range values {
+		if indexOf(result, value) == -1 {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func reverse(values []interface{}) {
+	for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+		values[i], values[j] = values[j], values[i]
+	}
+}
+
+func stringValues(strs []string) []interface{} {
+	values := make([]interface{}, len(strs))
+	for i, str := range strs {
+		values[i] = str
+	}
+	return values
+}
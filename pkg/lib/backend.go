@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//go:embed complete-template.go.sh
+var completeTemplateBash string
+
+// backend compiles the parsed Cli into a completion script for a single shell
+type backend interface {
+	compile(data templateData) (string, error)
+}
+
+// templateBackend compiles with a text/template embedded from pkg/lib
+type templateBackend struct {
+	templateFile string
+	template     string
+}
+
+var backends = map[string]backend{
+	ShellBash: templateBackend{templateFile: "complete-template.go.sh", template: completeTemplateBash},
+	ShellZsh:  templateBackend{templateFile: "complete-template.go.zsh", template: completeTemplateZsh},
+	ShellFish: templateBackend{templateFile: "complete-template.go.fish", template: completeTemplateFish},
+}
+
+// Shells are the names accepted by `cfg shell=`
+func Shells() []string {
+	shells := make([]string, 0, len(backends))
+	for shell := range backends {
+		shells = append(shells, shell)
+	}
+	sort.Strings(shells)
+	return shells
+}
+
+func (b templateBackend) compile(data templateData) (string, error) {
+	// new template feature '\}}' chomps next newline rather than trim all whitespace '-}}'
+	pattern := regexp.MustCompile(`(^|\n)([\t\r ]+)(\{\{.*)\\(}}[\t\r ]*)\n(.*)($|\n)`)
+	templateNew := pattern.ReplaceAllFunc([]byte(b.template), func(matched []byte) []byte {
+		match := pattern.FindStringSubmatch(string(matched))
+		matchStart := match[1]
+		matchStartWhitespace := match[2]
+		matchAction := match[3] + match[4]
+		matchNextLine := match[5] + match[6]
+		nextLine, _ := strings.CutPrefix(matchNextLine, matchStartWhitespace)
+		replaceStr := matchStart + matchStartWhitespace + matchAction + nextLine
+		return []byte(replaceStr)
+	})
+
+	// dedent `{{ something | indent num }}`
+	templateNew = regexp.MustCompile(`(?m:^\s+(.*\| indent \d+ }}))`).ReplaceAll(templateNew, []byte("$1"))
+
+	t := template.New("shcomp2-compile")
+	var funcMap = template.FuncMap{
+		"StringsJoin":      strings.Join,
+		"BashQuote":        BashQuote,
+		"ZshQuote":         ZshQuote,
+		"FishQuote":        FishQuote,
+		"BashArray":        BashArray,
+		"BashAssocQuote":   BashAssocQuote,
+		"BashAssocNoQuote": BashAssocNoQuote,
+		"BashAssoc":        BashAssoc,
+		"loop": func(from any, to any) <-chan int {
+			ch := make(chan int)
+			var fromint int
+			var toint int
+			switch v := from.(type) {
+			case int:
+				fromint = v
+			case float64:
+				fromint = int(v)
+			}
+			switch v := to.(type) {
+			case int:
+				toint = v
+			case float64:
+				toint = int(v)
+			}
+			go func() {
+				for i := fromint; i <= toint; i++ {
+					ch <- i
+				}
+				close(ch)
+			}()
+			return ch
+		},
+	}
+	funcMap["include"] = func(name string, data ...any) (string, error) {
+		buf := bytes.NewBuffer(nil)
+		if err := t.ExecuteTemplate(buf, name, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	funcMap["indent"] = func(indent int, data ...any) string {
+		switch v := data[0].(type) {
+		case string:
+			var indentStr = strings.Repeat(" ", indent)
+			var indented strings.Builder
+			var indentNext = false
+			indented.WriteString(indentStr)
+			for _, r := range v {
+				if r == '\n' {
+					indentNext = true
+				} else if indentNext {
+					indented.WriteString(indentStr)
+					indentNext = false
+				}
+
+				indented.WriteRune(r)
+			}
+			return indented.String()
+		default:
+			panic("unknown data type")
+		}
+	}
+	templateParsed, err := t.Funcs(funcMap).Parse(string(templateNew))
+	Check(err)
+
+	var buffer bytes.Buffer
+	err = templateParsed.Execute(&buffer, data)
+	if err != nil {
+		re := regexp.MustCompile(`shcomp2-compile:(\d+):(\d+)`)
+		matches := re.FindStringSubmatch(err.Error())
+		col, _ := strconv.Atoi(matches[2])
+		return "", fmt.Errorf(
+			"error in template ./pkg/lib/%s:%s:%d: \n%s",
+			b.templateFile,
+			matches[1],
+			col+1,
+			err,
+		)
+	}
+
+	compiledShell := buffer.String()
+
+	// collapse multiple newlines into one
+	compiledShell = regexp.MustCompile(`(?m)^\s+\n`).ReplaceAllString(compiledShell, "\n")
+
+	return compiledShell, nil
+}
@@ -0,0 +1,383 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	errIndeterminantPositional = errors.New("cannot have a positional come after a indeterminant narg positional")
+	errNargsAlternatives       = errors.New("nargs and alternatives is not supported")
+	errGlobFilters             = fmt.Errorf("glob filters are only supported for %s completion", CompleteTypeFile)
+)
+
+// NewCli starts an empty model with the default config. SetConfig and the Add methods build it with the same
+// validation as the DSL and record each step as the operation that does the same, so a script compiled from it
+// can reload. Relative paths in the config resolve against specDir unless it's empty
+func NewCli(specDir string) Cli {
+	parsers := CliParsers{
+		parserMap: map[CliParserName]CliParser{},
+		parserSeq: []CliParserName{},
+	}
+	parsers.parser(DefaultParser)
+	return Cli{
+		Config:  CliConfig{Outfile: "-", Shell: ShellBash, AutogenHelpDepth: 1},
+		Parsers: &parsers,
+		specDir: specDir,
+	}
+}
+
+// SetConfig is `cfg name=value`
+func (cli *Cli) SetConfig(name string, value string) error {
+	value = cli.resolveConfigPath(name, value)
+	intOperations, err := cli.setConfig(name, value, ReloadTrigger{})
+	if err != nil {
+		return err
+	}
+	cli.Operations = append(cli.Operations, "cfg "+name+"="+QuoteWord(value))
+	cli.Operations = append(cli.Operations, intOperations...)
+	return nil
+}
+
+// AddParser is `psr -p=parent name`, an empty parent or DefaultParser adds a subcommand of the cli
+func (cli *Cli) AddParser(parent CliParserName, name string, help string) error {
+	if parent == "" {
+		parent = DefaultParser
+	}
+	if name == "" {
+		return errors.New("missing parser name")
+	}
+	words := []string{"psr"}
+	if parent != DefaultParser {
+		words = append(words, "-p="+QuoteWord(string(parent)))
+	}
+	words = append(words, QuoteWord(name))
+	if help != "" {
+		words = append(words, "--help="+QuoteWord(help))
+	}
+	cli.addParser(parent, name, help)
+	cli.Operations = append(cli.Operations, strings.Join(words, " "))
+	return nil
+}
+
+// AddGroup is `grp -p=parser name`, an empty parser is DefaultParser like for the Add methods below
+func (cli *Cli) AddGroup(parser CliParserName, group CliGroup) error {
+	if parser == "" {
+		parser = DefaultParser
+	}
+	if group.Name == "" {
+		return errors.New("missing group name")
+	}
+	if err := cli.Parsers.checkNewGroup(parser, group.Name); err != nil {
+		return err
+	}
+	words := []string{"grp"}
+	if parser != DefaultParser {
+		words = append(words, "-p="+QuoteWord(string(parser)))
+	}
+	words = append(words, QuoteWord(group.Name))
+	if group.Exclusive {
+		words = append(words, "--exclusive")
+	}
+	cli.Parsers.addGroup(parser, CliGroup{Name: group.Name, Exclusive: group.Exclusive})
+	cli.Operations = append(cli.Operations, strings.Join(words, " "))
+	return nil
+}
+
+// AddOptional is `opt`, an option is added for each alternative too
+func (cli *Cli) AddOptional(opt CliOptional) error {
+	if opt.Parser == "" {
+		opt.Parser = DefaultParser
+	}
+	if opt.Name == "" {
+		return errors.New("missing option name")
+	}
+	if err := checkValue(opt.CompleteType, opt.Choices, opt.ClosureName, opt.Globs); err != nil {
+		return err
+	}
+	if err := checkValueStyle(opt.ValueStyle); err != nil {
+		return err
+	}
+	if opt.Group != "" {
+		if err := cli.Parsers.checkGroup(opt.Parser, opt.Group); err != nil {
+			return err
+		}
+	}
+	if len(opt.Alternatives) > 0 && opt.NArgs.IsSet {
+		return errNargsAlternatives
+	}
+
+	words := []string{"opt"}
+	if opt.Parser != DefaultParser {
+		words = append(words, "-p="+QuoteWord(string(opt.Parser)))
+	}
+	words = append(words, QuoteWord(strings.Join(append([]string{opt.Name}, opt.Alternatives...), "|")))
+	words = append(words, valueWords(opt.CompleteType, opt.Choices, opt.ChoiceDescriptions, opt.ClosureName, opt.Globs, opt.NArgs)...)
+	if opt.ValueStyle != "" {
+		words = append(words, "--value-style="+QuoteWord(opt.ValueStyle))
+	}
+	if opt.Group != "" {
+		words = append(words, "--group="+QuoteWord(opt.Group))
+	}
+	if opt.Help != "" {
+		words = append(words, "--help="+QuoteWord(opt.Help))
+	}
+	cli.addOptional(opt)
+	cli.Operations = append(cli.Operations, strings.Join(words, " "))
+	return nil
+}
+
+// AddPositional is `pos`, the positional after the others of its parser
+func (cli *Cli) AddPositional(pos CliPositional) error {
+	if pos.Parser == "" {
+		pos.Parser = DefaultParser
+	}
+	if err := checkValue(pos.CompleteType, pos.Choices, pos.ClosureName, pos.Globs); err != nil {
+		return err
+	}
+	if cli.prevNArgIndeterminant {
+		return errIndeterminantPositional
+	}
+
+	words := []string{"pos"}
+	if pos.Parser != DefaultParser {
+		words = append(words, "-p="+QuoteWord(string(pos.Parser)))
+	}
+	words = append(words, valueWords(pos.CompleteType, pos.Choices, pos.ChoiceDescriptions, pos.ClosureName, pos.Globs, pos.NArgs)...)
+	if pos.Help != "" {
+		words = append(words, "--help="+QuoteWord(pos.Help))
+	}
+	cli.addPositional(pos)
+	cli.Operations = append(cli.Operations, strings.Join(words, " "))
+	return nil
+}
+
+// resolveConfigPath makes the paths of include_source, autogen_file, autogen_closure_source and
+// autogen_reload_trigger absolute so reloads don't depend on the caller's working directory
+func (cli *Cli) resolveConfigPath(name string, value string) string {
+	switch name {
+	case "include_source", "autogen_file", "autogen_closure_source", "autogen_reload_trigger":
+		return resolveSpecPath(cli.specDir, value)
+	}
+	return value
+}
+
+// setConfig applies `cfg name=value`, stored is the state of a reload trigger read back from a compiled script.
+// It returns the int operations that follow the cfg operation
+func (cli *Cli) setConfig(name string, value string, stored ReloadTrigger) ([]string, error) {
+	switch name {
+	case "cli_name":
+		cli.cliName = value
+	case "outfile":
+		cli.Config.Outfile = value
+	case "shell":
+		if _, ok := backends[value]; !ok {
+			return nil, fmt.Errorf("unknown shell %q, expected one of %s", value, strings.Join(Shells(), ", "))
+		}
+		cli.Config.Shell = value
+	case "include_source":
+		cli.Config.IncludeSources = append(cli.Config.IncludeSources, value)
+	case "autogen_lang":
+		cli.Config.AutogenLang = value
+	case "autogen_file":
+		cli.Config.AutogenFile = value
+	case "autogen_closure_cmd":
+		cli.Config.AutogenClosureCmd = value
+	case "autogen_closure_func":
+		cli.Config.AutogenClosureFunc = value
+	case "autogen_closure_source":
+		cli.Config.AutogenClosureSource = value
+	case "autogen_help_cmd":
+		if len(SplitWords(value)) == 0 {
+			return nil, errors.New("autogen_help_cmd is empty, expected a command like tool --help")
+		}
+		cli.Config.AutogenHelpCmd = value
+	case "autogen_help_depth":
+		depth, err := strconv.Atoi(value)
+		if err != nil || depth < 0 {
+			return nil, fmt.Errorf("invalid autogen_help_depth %q, expected a number", value)
+		}
+		cli.Config.AutogenHelpDepth = depth
+	case "log_level":
+		if !ValidLogLevel(value) {
+			return nil, fmt.Errorf("invalid log_level %q, expected one of %s", value, strings.Join(LogLevels, ", "))
+		}
+		cli.Config.LogLevel = value
+	case "merge_single_opt":
+		if strings.TrimSpace(value) == "1" {
+			cli.Config.MergeSingleOpt = true
+		}
+	case "autogen_reload_trigger":
+		reloadTrigger := stored
+		reloadTrigger.File = value
+		if reloadTrigger.Timestamp == 0 {
+			var err error
+			if reloadTrigger, err = NewReloadTrigger(value); err != nil {
+				return nil, err
+			}
+		}
+		cli.Config.AutogenReloadTriggers = append(cli.Config.AutogenReloadTriggers, reloadTrigger)
+		return reloadTrigger.reloadTriggerOps(), nil
+	}
+	return nil, nil
+}
+
+func (cli *Cli) addParser(parent CliParserName, name string, help string) {
+	fqn := CliParserName(name)
+	if parent != DefaultParser {
+		fqn = parent + "." + fqn
+	}
+	// register the parser so nested subparsers can be added to it
+	parser := cli.Parsers.parser(fqn)
+	if help != "" {
+		parser.Help = help
+	}
+	cli.Parsers.parserMap[fqn] = parser
+	cli.Parsers.addSubparserChoice(fqn)
+}
+
+func (cli *Cli) addOptional(opt CliOptional) {
+	cli.Parsers.addOptional(opt)
+	for _, alt := range opt.Alternatives {
+		cli.Parsers.addOptional(CliOptional{
+			Parser:             opt.Parser,
+			Name:               alt,
+			CompleteType:       opt.CompleteType,
+			ClosureName:        opt.ClosureName,
+			Choices:            opt.Choices,
+			ChoiceDescriptions: opt.ChoiceDescriptions,
+			Globs:              opt.Globs,
+			ValueStyle:         opt.ValueStyle,
+			Help:               opt.Help,
+		})
+	}
+}
+
+func (cli *Cli) addPositional(pos CliPositional) {
+	if pos.NArgs.IsSet && (pos.NArgs.Min != pos.NArgs.Max || pos.NArgs.Max == math.Inf(+1)) {
+		cli.prevNArgIndeterminant = true
+	}
+	cli.Parsers.addPositional(pos)
+}
+
+func (parsers *CliParsers) checkGroup(parser CliParserName, group string) error {
+	if !parsers.hasGroup(parser, group) {
+		return fmt.Errorf("unknown group %q, groups must be added with grp first", group)
+	}
+	return nil
+}
+
+func (parsers *CliParsers) checkNewGroup(parser CliParserName, group string) error {
+	if parsers.hasGroup(parser, group) {
+		return fmt.Errorf("group %q already exists", group)
+	}
+	return nil
+}
+
+func checkValueStyle(style string) error {
+	switch style {
+	case "", ValueStyleEquals, ValueStyleSpace, ValueStyleBoth:
+		return nil
+	}
+	return fmt.Errorf("unknown value style %q, expected %s, %s or %s", style, ValueStyleEquals, ValueStyleSpace, ValueStyleBoth)
+}
+
+func unknownCompleteType(completeType string) error {
+	return fmt.Errorf("unknown complete type %q, expected %s, %s or %s", completeType, CompleteTypeFile, CompleteTypeDir, CompleteTypeValue)
+}
+
+// checkValue validates how an option or positional that wasn't parsed from the DSL completes its value
+func checkValue(completeType string, choices []string, closureName string, globs []string) error {
+	switch completeType {
+	case "", CompleteTypeFile, CompleteTypeDir, CompleteTypeValue:
+	case CompleteTypeChoices:
+		if len(choices) == 0 {
+			return errors.New("missing choices")
+		}
+		for _, choice := range choices {
+			// operations are lines and empty words are dropped
+			if choice == "" || strings.ContainsAny(choice, "\r\n") {
+				return fmt.Errorf("choice %q can't be empty or contain a line break", choice)
+			}
+		}
+	case CompleteTypeClosure:
+		if closureName == "" {
+			return errors.New("missing closure name")
+		}
+	default:
+		return unknownCompleteType(completeType)
+	}
+	if len(globs) > 0 && completeType != CompleteTypeFile {
+		return errGlobFilters
+	}
+	return nil
+}
+
+// valueWords are the words of the value options and positionals share
+func valueWords(completeType string, choices []string, descriptions map[string]string, closureName string, globs []string, nargs CliNargs) []string {
+	var words []string
+	switch completeType {
+	case CompleteTypeChoices:
+		words = append(words, "--choices="+QuoteChoices(choices))
+	case CompleteTypeClosure:
+		words = append(words, "--closure="+QuoteWord(closureName))
+	case CompleteTypeFile, CompleteTypeDir, CompleteTypeValue:
+		complete := completeType
+		if len(globs) > 0 {
+			complete += ":" + strings.Join(globs, ",")
+		}
+		words = append(words, "--complete="+QuoteWord(complete))
+	}
+	// descriptions in the order of the choices so the operation is stable, then any others sorted
+	described := make(map[string]bool, len(descriptions))
+	var order []string
+	for _, choice := range choices {
+		if _, ok := descriptions[choice]; ok && !described[choice] {
+			described[choice] = true
+			order = append(order, choice)
+		}
+	}
+	var others []string
+	for choice := range descriptions {
+		if !described[choice] {
+			others = append(others, choice)
+		}
+	}
+	sort.Strings(others)
+	for _, choice := range append(order, others...) {
+		words = append(words, "--desc="+QuoteWord(choice+"="+descriptions[choice]))
+	}
+	if nargs.IsSet {
+		words = append(words, "--nargs="+QuoteWord(nargsWord(nargs)))
+	}
+	if nargs.Unique {
+		words = append(words, "--nargs-unique")
+	}
+	if nargs.NoSpace {
+		words = append(words, "--nargs-nospace")
+	}
+	return words
+}
+
+// nargsWord is the --nargs value ParseNargs reads back as nargs
+func nargsWord(nargs CliNargs) string {
+	bound := func(value float64) string {
+		if math.IsInf(value, +1) {
+			return "inf"
+		}
+		return strconv.FormatFloat(value, 'f', 0, 64)
+	}
+	switch {
+	case nargs.Min == 0 && math.IsInf(nargs.Max, +1):
+		return "*"
+	case nargs.Min == 1 && math.IsInf(nargs.Max, +1):
+		return "+"
+	case nargs.Min == nargs.Max:
+		return bound(nargs.Max)
+	}
+	return "{" + bound(nargs.Min) + "," + bound(nargs.Max) + "}"
+}
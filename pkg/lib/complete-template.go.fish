@@ -0,0 +1,97 @@
+{{ if .ModifiedTimeMs -}}
+# last_modified_ms: {{.ModifiedTimeMs}}
+
+{{ end -}}
+{{/*gotype: shcomp2/pkg/lib.templateData*/ -}}
+{{.OperationsComment}}
+
+# succeeds when the positional being completed is within [from, to] for the parser at depth,
+# the values of options are skipped
+function __shcomp2_v2_fish_{{.Cli.CliNameClean}}_positional -a depth from to
+    set -l value_options {{ StringsJoin .FishValueOptions " " }}
+    set -l value_counts {{ StringsJoin .FishValueCounts " " }}
+    set -l index 1
+    set -l skip 0
+    for token in (commandline -opc)[2..-1]
+        if test $skip -gt 0
+            set skip (math $skip - 1)
+        else if contains -- $token $value_options
+            set skip $value_counts[(contains -i -- $token $value_options)]
+        else if not string match -q -- '-*' $token
+            set index (math $index + 1)
+        end
+    end
+    set index (math $index - $depth)
+    test $index -ge $from
+    and begin
+        test "$to" = inf
+        or test $index -le $to
+    end
+end
+
+# print choices not already used on the command line
+function __shcomp2_v2_fish_{{.Cli.CliNameClean}}_unique
+    set -l tokens (commandline -opc)
+    for choice in $argv
+        if not contains -- $choice $tokens
+            echo $choice
+        end
+    end
+end
+
+# closures are fish functions called with the current word as $argv[1] and the words before it as $argv[2..]
+# that print one value per line
+function __shcomp2_v2_fish_{{.Cli.CliNameClean}}_closure -a closure
+    if functions -q $closure
+        $closure (commandline -ct) (commandline -opc)
+    end
+end
+{{- if .CompletesPaths }}
+
+# print paths for file and dir completion, comma separated globs only filter files
+function __shcomp2_v2_fish_{{.Cli.CliNameClean}}_paths -a complete_type globs
+    set -l token (commandline -ct)
+    if test "$complete_type" = dir
+        __fish_complete_directories $token
+        return
+    end
+    for candidate in (__fish_complete_path $token)
+        set -l path (string split -f1 \t -- $candidate)
+        if test -z "$globs"; or test -d "$path"
+            echo $candidate
+            continue
+        end
+        for glob in (string split , -- $globs)
+            if string match -q -- $glob $path
+                echo $candidate
+                break
+            end
+        end
+    end
+end
+{{- end }}
+{{ range .FishIncludeSources }}
+source {{.}}
+{{- end }}
+
+complete -c {{ FishQuote .Cli.CliName }} -e
+complete -c {{ FishQuote .Cli.CliName }} -f
+{{- if .Cli.Config.AutogenReloadTriggers }}
+# runs as a condition so changes are picked up on the next completion
+function __shcomp2_v2_fish_{{.Cli.CliNameClean}}_reloader
+    printf '%s\n' \
+        {{ .StringsJoin .FishReloadConfig 8 }} \
+        | {{ .ReloadCheckCommand }}
+    set -l return_code $status
+    if test $return_code = 5
+        source {{ FishQuote .Cli.Config.Outfile }} # source self to reload changes
+    else if test $return_code != 0
+        echo "reload-check failed: $return_code" >&2
+    end
+    return 1
+end
+complete -c {{ FishQuote .Cli.CliName }} -n __shcomp2_v2_fish_{{.Cli.CliNameClean}}_reloader
+{{- end }}
+{{- range .FishCompletions }}
+complete -c {{ FishQuote $.Cli.CliName }} {{.}}
+{{- end }}
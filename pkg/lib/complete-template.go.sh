@@ -1,13 +1,104 @@
 #!/usr/bin/env bash
+{{- if .ModifiedTimeMs }}
 # last_modified_ms: {{.ModifiedTimeMs}}
+{{- end }}
 # todo: add version metadata
 # todo: add gotype to the top without effecting it somehow
 {{/*gotype: shcomp2/pkg/lib.templateData*/}}
+{{.OperationsComment}}
+{{- if .ScriptLogs }}
 
-log () { echo -e "[$(date '+%T.%3N')] $*" >> ~/bashscript.log; }
-log_everything () { if [[ "{{.Cli.CliNameClean}}" == "$1" ]]; then exec >> ~/bashscript.log; exec 2>&1; set -x; fi; }
+# compiled with -debug, appends to the log file of shcomp2
+__shcomp2_v2_log_{{.Cli.CliNameClean}} () {
+  local log_file="${XDG_STATE_HOME:-$HOME/.local/state}/shcomp2/shcomp2.log"
+  [[ -d "${log_file%/*}" ]] || mkdir -p "${log_file%/*}"
+  printf '[%(%T)T] DBG %s: %s\n' -1 {{ BashQuote .Cli.CliName }} "$*" >> "$log_file"
+}
+{{- end }}
 
-{{.OperationsComment}}
+# splits the line up to the cursor into words like the shell does, the words keep their quotes and escapes
+# as typed. =, : and @ don't break words so --opt=value, host:port and user@host stay one word.
+# current_word and previous_word have the quotes and escapes removed so they compare with candidates,
+# readline only replaces the text after an open quote so "o completes to "one. current_word_break is
+# current_word up to its last unquoted COMP_WORDBREAKS character, readline doesn't replace it either
+__shcomp2_v2_comp_words_{{.Cli.CliNameClean}} () {
+  # COMP_POINT counts bytes
+  local LC_ALL=C
+  local line="${COMP_LINE:0:COMP_POINT}" word="" plain="" previous_plain="" plain_break="" char quote="" escaped=0 in_word=0 i
+  words=()
+  for ((i = 0; i < ${#line}; i++)); do
+    char="${line:i:1}"
+    if [[ "$escaped" == 1 ]]; then
+      escaped=0
+      # in double quotes a backslash only escapes ", \, $ and `
+      if [[ "$quote" == '"' && "$char" != [\"\\\$\`] ]]; then
+        plain+="\\"
+      fi
+      plain+="$char"
+    elif [[ "$char" == "\\" && "$quote" != "'" ]]; then
+      escaped=1
+    elif [[ -n "$quote" ]]; then
+      if [[ "$char" == "$quote" ]]; then
+        quote=""
+      else
+        plain+="$char"
+      fi
+    elif [[ "$char" == [\"\'] ]]; then
+      quote="$char"
+    elif [[ "$char" == [[:space:]] ]]; then
+      if [[ "$in_word" == 1 ]]; then
+        words+=("$word")
+        previous_plain="$plain"
+        word=""
+        plain=""
+        plain_break=""
+        in_word=0
+      fi
+      continue
+    else
+      plain+="$char"
+      if [[ "$COMP_WORDBREAKS" == *"$char"* ]]; then
+        plain_break="$plain"
+      fi
+    fi
+    word+="$char"
+    in_word=1
+  done
+  words+=("$word")
+  cword_index=$((${#words[@]} - 1))
+  current_word="$plain"
+  current_word_break="$plain_break"
+  previous_word=""
+  if ((cword_index > 0)); then
+    previous_word="$previous_plain"
+  fi
+}
+{{- if .CompletesPaths }}
+
+# prints files or directories starting with the current word
+# glob filters only apply to files so directories can still be walked into
+__shcomp2_v2_complete_paths_{{.Cli.CliNameClean}} () {
+  local complete_type="$1" globs="$2" path_word="$3"
+  if [[ "$complete_type" == "dir" ]]; then
+    compgen -d -- "$path_word"
+  elif [[ -z "$globs" ]]; then
+    compgen -f -- "$path_word"
+  else
+    compgen -d -- "$path_word"
+    local extglob_was_set=0 path
+    shopt -q extglob && extglob_was_set=1
+    shopt -s extglob
+    while IFS= read -r path; do
+      if [[ ! -d "$path" ]]; then
+        printf '%s\n' "$path"
+      fi
+    done < <(compgen -f -X "!@(${globs//,/|})" -- "$path_word")
+    if [[ "$extglob_was_set" == 0 ]]; then
+      shopt -u extglob
+    fi
+  fi
+}
+{{- end }}
 
 __shcomp2_v2_autocomplete_{{.Cli.CliNameClean}} () {
   local -A subparsers={{ BashAssocNoQuote .ParserNameMap 2 }}
@@ -17,6 +108,10 @@ __shcomp2_v2_autocomplete_{{.Cli.CliNameClean}} () {
   local -A _option_{{$parser.NameClean}}_name_map={{ BashAssocQuote $parser.OptionalsNameMap 2 }}
   local -a _option_{{$parser.NameClean}}_names={{ BashArray $parser.OptionalsNames 2 }}
   local -A _option_{{$parser.NameClean}}_data={{ BashAssocQuote $parser.OptionalsData 2 }}
+  {{- $descriptions := $.DescriptionsData $parser }}
+  {{- if $descriptions }}
+  local -A _description_{{$parser.NameClean}}={{ BashAssocQuote $descriptions 2 }}
+  {{- end }}
   {{ end }}
 
   # arguments
@@ -35,23 +130,26 @@ __shcomp2_v2_autocomplete_{{.Cli.CliNameClean}} () {
   local _positional_{{$parser.NameClean}}_{{$pos.Number}}_choices={{- BashArray $pos.Choices 2 }}
   {{- else if eq $pos.CompleteType "closure" }}
   local _positional_{{$parser.NameClean}}_{{$pos.Number}}_type="closure"
-  local _positional_{{$parser.NameClean}}_{{$pos.Number}}_closure="{{ $pos.ClosureName }}"
+  local _positional_{{$parser.NameClean}}_{{$pos.Number}}_closure={{ BashQuote $pos.ClosureName }}
+  {{- else if or (eq $pos.CompleteType "file") (eq $pos.CompleteType "dir") }}
+  local _positional_{{$parser.NameClean}}_{{$pos.Number}}_type={{ BashQuote $pos.CompleteType }}
+  local _positional_{{$parser.NameClean}}_{{$pos.Number}}_globs={{ BashQuote (StringsJoin $pos.Globs ",") }}
   {{- end }}
   {{- end }}
   {{- end }}
   {{- end }}
 
-  # todo: _get_comp_words_by_ref remove dependency on bash-completion repo
   # shellcheck disable=SC2034
-  local cword_index previous_word words current_word
-  _get_comp_words_by_ref -n = -n @ -n : -w words -i cword_index -p previous_word -c current_word
+  local cword_index previous_word words current_word current_word_break
+  __shcomp2_v2_comp_words_{{.Cli.CliNameClean}}
 
   # default add space after completion
   compopt +o nospace
 
   local -A used_options=()
-  local carg_index=0
+  local carg_index=0 real_carg_index
   local i=0 # skip first word
+  local word subparser_candidate parser
   local current_parser=""
   local current_parser_clean="baseparser"
   local completing_option_val=0
@@ -69,6 +167,9 @@ __shcomp2_v2_autocomplete_{{.Cli.CliNameClean}} () {
     # option
     local -n option_data="_option_${current_parser_clean}_data"
     local -n option_map="_option_${current_parser_clean}_name_map"
+    if [[ "$word" == -*=* ]]; then
+      word="${word%%=*}" # --opt=value
+    fi
     if [[ "$word" =~ ^'-' && "$i" -le "$cword_index" ]]; then
       if [[ ${#word} == 2 || -n ${option_map[$word]} ]]; then
         local reached_max=1
@@ -101,7 +202,7 @@ __shcomp2_v2_autocomplete_{{.Cli.CliNameClean}} () {
         fi
       elif [[ ${#word} -ge 2 || $cword_index == $i ]]; then
         # count option usage in merged opts
-        local opt
+        local opt char
         while IFS='' read -r -d '' -n 1 char; do
           if [[ $char != $'\n' && $char != '-' ]]; then
             opt="-$char"
@@ -169,35 +270,76 @@ __shcomp2_v2_autocomplete_{{.Cli.CliNameClean}} () {
     parser="$current_parser_clean"
   fi
 
+  # closures are called with the word being completed as $1 and the words before it from the cli name on
+  # as $2 and up, they put their candidates in COMPREPLY. shcomp2_CURRENT_WORD is the word too for closures
+  # written before the arguments, it's local so it doesn't outlive the completion
+  local shcomp2_CURRENT_WORD
   local choices_all=()
+  local path_candidates=()
+  local quote_candidates=0
+  local description_prefix=""
+  local candidate_prefix=""
   local -n option_complete_data="_option_${parser}_data"
-  if [[ -v option_complete_data[@] && -v "option_complete_data[__type__,$previous_word]" ]]; then
+  local option_name="" value_word="$current_word"
+  if [[ "$current_word" == -*=* ]]; then
+    # --option=value
+    option_name="${current_word%%=*}"
+    value_word="${current_word#*=}"
+    if [[ "${option_complete_data[__value_style__,$option_name]}" == "space" ]]; then
+      option_name=""
+    fi
+  elif [[ "${option_complete_data[__value_style__,$previous_word]}" != "equals" ]]; then
+    # --option value
+    option_name="$previous_word"
+  fi
+  if [[ -n "$option_name" && -v "option_complete_data[__type__,$option_name]" ]]; then
     # --option values
     # solve edge cases with mistaking positionals with options
-    local option_name="$previous_word"
-    local option_choices
+    local -a option_choices=()
+    description_prefix="$option_name,"
     case "${option_complete_data[__type__,$option_name]}" in
       "choices")
-        option_choices="${option_complete_data[__value__,$option_name]}"
+        # spaces in a choice are escaped
+        IFS=' ' read -a option_choices <<< "${option_complete_data[__value__,$option_name]}"
+        quote_candidates=1
         ;;
       "closure")
         local option_closure="${option_complete_data[__value__,$option_name]}"
         COMPREPLY=()
-        declare -g shcomp2_CURRENT_WORD="$current_word"
-        "$option_closure"
-        option_choices="${COMPREPLY[*]}"
+        shcomp2_CURRENT_WORD="$value_word"
+        "$option_closure" "$value_word" "${words[@]:0:cword_index}"
+        option_choices=("${COMPREPLY[@]}")
         COMPREPLY=()
         ;;
+      {{- if .CompletesPaths }}
+      "file"|"dir")
+        mapfile -t path_candidates < <(__shcomp2_v2_complete_paths_{{.Cli.CliNameClean}} \
+          "${option_complete_data[__type__,$option_name]}" "${option_complete_data[__value__,$option_name]}" "$value_word")
+        ;;
+      {{- end }}
     esac
-    mapfile -t COMPREPLY < <(compgen -W "${option_choices}" -- "$current_word")
+    # compgen -W would expand $, ` and globs in the candidates, they are compared as they are
+    local candidate
+    COMPREPLY=()
+    for candidate in "${option_choices[@]}"; do
+      if [[ "$candidate" == "$value_word"* ]]; then
+        COMPREPLY+=("$candidate")
+      fi
+    done
+    if [[ "$value_word" != "$current_word" ]]; then
+      # the candidates are values, the word is --option=value
+      candidate_prefix="$option_name="
+    fi
   else
     # positionals
+    description_prefix="$carg_index,"
     local -n positional_complete_type="_positional_${parser}_${carg_index}_type"
     case "$positional_complete_type" in
       "choices")
         local -n positional_choices="_positional_${parser}_${carg_index}_choices"
         local -n positional_used="_positional_${parser}_${carg_index}_used"
         if [[ "${#positional_used[@]}" -gt 0 ]]; then
+          local choice
           for choice in "${positional_choices[@]}"; do
             if [[ -z "${positional_used[$choice]}" ]]; then
               choices_all+=("$choice")
@@ -206,15 +348,23 @@ __shcomp2_v2_autocomplete_{{.Cli.CliNameClean}} () {
         else
           choices_all+=("${positional_choices[@]}")
         fi
+        quote_candidates=1
         ;;
       "closure")
         local -n positional_closure="_positional_${parser}_${carg_index}_closure"
         COMPREPLY=()
-        declare -g shcomp2_CURRENT_WORD="$current_word"
-        "$positional_closure"
+        shcomp2_CURRENT_WORD="$current_word"
+        "$positional_closure" "$current_word" "${words[@]:0:cword_index}"
         choices_all+=("${COMPREPLY[@]}")
         COMPREPLY=()
         ;;
+      {{- if .CompletesPaths }}
+      "file"|"dir")
+        local -n positional_globs="_positional_${parser}_${carg_index}_globs"
+        mapfile -t path_candidates < <(__shcomp2_v2_complete_paths_{{.Cli.CliNameClean}} \
+          "$positional_complete_type" "$positional_globs" "$current_word")
+        ;;
+      {{- end }}
     esac
 
     local -n options_name_map="_option_${parser}_name_map"
@@ -222,6 +372,7 @@ __shcomp2_v2_autocomplete_{{.Cli.CliNameClean}} () {
     local -n options_name_dat="_option_${parser}_data"
 
     # options
+    local name
     for name in "${options_name_seq[@]}"; do
       {{ if .Cli.Config.MergeSingleOpt }}
       local shortopt_merged shortopt_merged_appended=0 shortopt_left
@@ -253,43 +404,118 @@ __shcomp2_v2_autocomplete_{{.Cli.CliNameClean}} () {
         fi
       else
         if [[ "${options_name_map[$name]}" == 1 && "${used_options[$name]}" != 1 ]]; then
-          choices_all+=("$name")
+          if [[ "${options_name_dat[__value_style__,$name]}" == "equals" ]]; then
+            choices_all+=("$name=")
+          else
+            choices_all+=("$name")
+          fi
         fi
       fi
       {{ else }}
       {{/* no merging of short opts*/}}
       if [[ "${options_name_map[$name]}" == 1 && "${used_options[$name]}" != 1 ]]; then
-        choices_all+=("$name")
+        if [[ "${options_name_dat[__value_style__,$name]}" == "equals" ]]; then
+          choices_all+=("$name=")
+        else
+          choices_all+=("$name")
+        fi
       fi
       {{ end }}
     done
 
-    mapfile -t COMPREPLY < <(compgen -W "${choices_all[*]}" -- "$current_word")
+    local candidate
+    COMPREPLY=()
+    for candidate in "${choices_all[@]}"; do
+      if [[ "$candidate" == "$current_word"* ]]; then
+        COMPREPLY+=("$candidate")
+      fi
+    done
+    if [[ "${#COMPREPLY[@]}" == 1 && "${COMPREPLY[0]}" == *= ]]; then
+      compopt -o nospace # --option= is followed by its value
+    fi
+  fi
+  {{- if .CompletesPaths }}
+
+  if [[ "${#path_candidates[@]}" -gt 0 ]]; then
+    # readline quotes special characters and appends a slash to directories
+    COMPREPLY+=("${path_candidates[@]}")
+    compopt -o filenames
+  fi
+  {{- end }}
+
+  # readline inserts candidates as they are, choices with spaces are escaped so they stay one word
+  local -a candidates_unquoted=("${COMPREPLY[@]}")
+  local candidate_index
+  if [[ -n "$candidate_prefix" || -n "$current_word_break" ]]; then
+    # readline keeps the word up to its last break like db: of db:5432 and only inserts the rest
+    for candidate_index in "${!COMPREPLY[@]}"; do
+      candidate="$candidate_prefix${COMPREPLY[$candidate_index]}"
+      COMPREPLY[$candidate_index]="${candidate#"$current_word_break"}"
+    done
+  fi
+  if [[ "$quote_candidates" == 1 ]]; then
+    for candidate_index in "${!COMPREPLY[@]}"; do
+      if [[ "${COMPREPLY[$candidate_index]}" == *[[:space:]]* ]]; then
+        printf -v "COMPREPLY[$candidate_index]" '%q' "${COMPREPLY[$candidate_index]}"
+      fi
+    done
+  fi
+
+  # descriptions are only shown when listing candidates, a single candidate is inserted as is
+  local -n descriptions="_description_${parser}"
+  if [[ "${#COMPREPLY[@]}" -gt 1 && "${#descriptions[@]}" -gt 0 && "${#path_candidates[@]}" == 0 ]]; then
+    local candidate description candidate_width=0
+    for candidate in "${COMPREPLY[@]}"; do
+      if [[ "${#candidate}" -gt "$candidate_width" ]]; then
+        candidate_width="${#candidate}"
+      fi
+    done
+    for candidate_index in "${!COMPREPLY[@]}"; do
+      candidate="${candidates_unquoted[$candidate_index]}"
+      description="${descriptions[$description_prefix$candidate]:-${descriptions[${candidate%=}]}}"
+      if [[ -n "$description" ]]; then
+        printf -v "COMPREPLY[$candidate_index]" '%-*s -- %s' "$candidate_width" "${COMPREPLY[$candidate_index]}" "$description"
+      fi
+    done
   fi
+  {{- if .ScriptLogs }}
+  __shcomp2_v2_log_{{.Cli.CliNameClean}} "parser=${current_parser:-baseparser} word=$current_word candidates=${#COMPREPLY[@]}"
+  {{- end }}
 }
 
 {{if .Cli.Config.IncludeSources}}
 {{range .Cli.Config.IncludeSources -}}
-source "{{.}}"
+source {{ BashQuote . }}
 {{end}}
 {{end}}
 
 {{if .Cli.Config.AutogenReloadTriggers}}
 __shcomp2_v2_autocomplete_autogen_reloader_{{.Cli.CliNameClean}} () {
-  shcomp2 -reload-check <<'OEF'
+  # only run the reload check when a trigger is newer than the stamp it leaves, no forks otherwise
+  local trigger_path reload_stamp={{ BashQuote .Cli.ReloadStamp }}
+  local -a trigger_paths={{ BashArray .Cli.ReloadPaths 2 }}
+  for trigger_path in "${trigger_paths[@]}"; do
+    if [[ ! -e "$reload_stamp" || "$trigger_path" -nt "$reload_stamp" ]]; then
+      {{ .ReloadCheckCommand }} <<'OEF'
     {{ .StringsJoin .Cli.OperationsReloadConfig 4 }}
 OEF
-  local return_code="$?"
-  if [[ "$return_code" == 5 ]]; then
-    source "{{.Cli.Config.Outfile}}" # source self to reload changes
-  elif [[ "$return_code" != 0 ]]; then
-    >&2 echo "reload-check failed: $return_code"
-  fi
+      local return_code="$?"
+      {{- if .ScriptLogs }}
+      __shcomp2_v2_log_{{.Cli.CliNameClean}} "reload check of $trigger_path returned $return_code"
+      {{- end }}
+      if [[ "$return_code" == 5 ]]; then
+        source {{ BashQuote .Cli.Config.Outfile }} # source self to reload changes
+      elif [[ "$return_code" != 0 ]]; then
+        >&2 echo "reload-check failed: $return_code"
+      fi
+      break
+    fi
+  done
 
   __shcomp2_v2_autocomplete_{{.Cli.CliNameClean}}
 }
-complete -F __shcomp2_v2_autocomplete_autogen_reloader_{{.Cli.CliNameClean}} -o nospace "{{ .Cli.CliName }}"
+complete -F __shcomp2_v2_autocomplete_autogen_reloader_{{.Cli.CliNameClean}} -o nospace {{ BashQuote .Cli.CliName }}
 {{else}}
 # todo: add closure validation when sourcing
-complete -F __shcomp2_v2_autocomplete_{{ .Cli.CliNameClean }} -o nospace "{{ .Cli.CliName }}"
+complete -F __shcomp2_v2_autocomplete_{{ .Cli.CliNameClean }} -o nospace {{ BashQuote .Cli.CliName }}
 {{end}}
@@ -0,0 +1,256 @@
+package lib
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strings"
+)
+
+//go:embed complete-template.go.fish
+var completeTemplateFish string
+
+// FishCompletions are the `complete` arguments for every parser, already quoted for fish
+func (d templateData) FishCompletions() []string {
+	var completions []string
+	for _, parser := range d.Parsers() {
+		path := d.fishParserPath(parser)
+		condition := d.fishCondition(parser, path)
+		withCondition := func(extra string) string {
+			conditions := condition
+			if extra != "" {
+				if conditions != "" {
+					conditions += "; and "
+				}
+				conditions += extra
+			}
+			if conditions == "" {
+				return ""
+			}
+			return "-n " + fishQuote(conditions) + " "
+		}
+
+		alternativeNames := map[string]bool{}
+		for _, optional := range parser.Optionals {
+			for _, alt := range optional.Alternatives {
+				alternativeNames[alt] = true
+			}
+		}
+
+		for _, optional := range parser.Optionals {
+			if alternativeNames[optional.Name] {
+				continue
+			}
+
+			names := append([]string{optional.Name}, optional.Alternatives...)
+			flags := make([]string, len(names))
+			for i, name := range names {
+				flags[i] = fishFlag(name)
+			}
+
+			used := fishNotContainsOpt(parser.conflicts(optional.Name))
+			if optional.NArgs.Max <= 1 {
+				used = fishNotContainsOpt(append([]string{optional.Name}, parser.conflicts(optional.Name)...))
+			}
+
+			completion := withCondition(used) + strings.Join(flags, " ")
+			if action := d.fishAction(optional.CompleteType, optional.Choices, optional.ChoiceDescriptions, optional.ClosureName, optional.Globs, false); action != "" {
+				completion += " -r -a " + fishQuote(action)
+			} else if optional.CompleteType == CompleteTypeValue {
+				// requires a value but doesn't complete files for it
+				completion += " -x"
+			}
+			if optional.Help != "" {
+				completion += " -d " + fishQuote(optional.Help)
+			}
+			completions = append(completions, completion)
+		}
+
+		depth := len(path)
+		if len(parser.Subparsers) > 0 {
+			// subparsers are always the first and only positional
+			subparsers := make([]string, len(parser.Subparsers))
+			for i, name := range parser.Subparsers {
+				subparsers[i] = fishEscape(name)
+				if help := d.subparserHelp(parser, name); help != "" {
+					subparsers[i] += `\t` + fishEscape(help)
+				}
+			}
+			positional := fmt.Sprintf("__shcomp2_v2_fish_%s_positional %d 1 1", d.Cli.CliNameClean(), depth)
+			completions = append(completions, withCondition(positional)+"-a "+fishQuote(strings.Join(subparsers, " ")))
+			continue
+		}
+
+		for _, pos := range parser.Positionals {
+			action := d.fishAction(pos.CompleteType, pos.Choices, pos.ChoiceDescriptions, pos.ClosureName, pos.Globs, pos.NArgs.Unique)
+			if action == "" {
+				continue
+			}
+			to := fmt.Sprintf("%d", pos.Number)
+			if pos.NArgs.Max == math.Inf(+1) {
+				to = "inf"
+			} else if pos.NArgs.IsSet {
+				to = fmt.Sprintf("%d", pos.Number+int(pos.NArgs.Max)-1)
+			}
+			positional := fmt.Sprintf("__shcomp2_v2_fish_%s_positional %d %d %s", d.Cli.CliNameClean(), depth, pos.Number, to)
+			completion := withCondition(positional) + "-a " + fishQuote(action)
+			if pos.Help != "" {
+				completion += " -d " + fishQuote(pos.Help)
+			}
+			completions = append(completions, completion)
+		}
+	}
+	return completions
+}
+
+// FishValueOptions are the options that take the tokens after them as values, the positional helper skips
+// FishValueCounts of those tokens. Options that only take --opt=value don't skip anything
+func (d templateData) FishValueOptions() []string {
+	names, _ := d.fishValueOptions()
+	return names
+}
+
+func (d templateData) FishValueCounts() []string {
+	_, counts := d.fishValueOptions()
+	return counts
+}
+
+func (d templateData) fishValueOptions() ([]string, []string) {
+	var names, counts []string
+	seen := map[string]bool{}
+	for _, parser := range d.Parsers() {
+		for _, optional := range parser.Optionals {
+			if optional.CompleteType == "" || optional.ValueStyle == ValueStyleEquals || seen[optional.Name] {
+				continue
+			}
+			seen[optional.Name] = true
+			count := 1
+			if optional.NArgs.Max > 1 && optional.NArgs.Max != math.Inf(+1) {
+				count = int(optional.NArgs.Max)
+			}
+			names = append(names, FishQuote(optional.Name))
+			counts = append(counts, fmt.Sprintf("%d", count))
+		}
+	}
+	return names, counts
+}
+
+func (d templateData) FishIncludeSources() []string {
+	sources := make([]string, len(d.Cli.Config.IncludeSources))
+	for i, source := range d.Cli.Config.IncludeSources {
+		sources[i] = fishQuote(source)
+	}
+	return sources
+}
+
+// FishReloadConfig are the reload config operations quoted and with a line continuation
+func (d templateData) FishReloadConfig() []string {
+	operations := d.Cli.OperationsReloadConfig()
+	quoted := make([]string, len(operations))
+	for i, operation := range operations {
+		quoted[i] = fishQuote(operation)
+		if i < len(operations)-1 {
+			quoted[i] += " \\"
+		}
+	}
+	return quoted
+}
+
+// fishParserPath is the subparser names leading to parser
+func (d templateData) fishParserPath(parser CliParser) []string {
+	if parser.Name == DefaultParser {
+		return nil
+	}
+	return strings.Split(string(parser.Name), ".")
+}
+
+// fishCondition is true when parser is the deepest subparser on the command line
+func (d templateData) fishCondition(parser CliParser, path []string) string {
+	var conditions []string
+	for _, name := range path {
+		conditions = append(conditions, "__fish_seen_subcommand_from "+fishEscape(name))
+	}
+	if len(parser.Subparsers) > 0 {
+		subparsers := make([]string, len(parser.Subparsers))
+		for i, name := range parser.Subparsers {
+			subparsers[i] = fishEscape(name)
+		}
+		conditions = append(conditions, "not __fish_seen_subcommand_from "+strings.Join(subparsers, " "))
+	}
+	return strings.Join(conditions, "; and ")
+}
+
+func (d templateData) fishAction(completeType string, choices []string, descriptions map[string]string, closureName string, globs []string, unique bool) string {
+	switch completeType {
+	case CompleteTypeChoices:
+		escaped := make([]string, len(choices))
+		for i, choice := range choices {
+			escaped[i] = fishEscape(choice)
+		}
+		if unique {
+			return fmt.Sprintf("(__shcomp2_v2_fish_%s_unique %s)", d.Cli.CliNameClean(), strings.Join(escaped, " "))
+		}
+		for i, choice := range choices {
+			// a tab separates a candidate from its description
+			if description, ok := descriptions[choice]; ok {
+				escaped[i] += `\t` + fishEscape(description)
+			}
+		}
+		return strings.Join(escaped, " ")
+	case CompleteTypeClosure:
+		return fmt.Sprintf("(__shcomp2_v2_fish_%s_closure %s)", d.Cli.CliNameClean(), fishEscape(closureName))
+	case CompleteTypeFile, CompleteTypeDir:
+		action := fmt.Sprintf("(__shcomp2_v2_fish_%s_paths %s", d.Cli.CliNameClean(), completeType)
+		if len(globs) > 0 {
+			action += " " + fishEscape(strings.Join(globs, ","))
+		}
+		return action + ")"
+	}
+	return ""
+}
+
+// fishFlag converts an option name to a `complete` flag: -s for -x, -l for --long, -o for -old
+func fishFlag(name string) string {
+	if long, found := strings.CutPrefix(name, "--"); found {
+		return "-l " + fishEscape(long)
+	} else if short, found := strings.CutPrefix(name, "-"); found && len(short) == 1 {
+		return "-s " + fishEscape(short)
+	} else {
+		return "-o " + fishEscape(strings.TrimPrefix(name, "-"))
+	}
+}
+
+// fishNotContainsOpt hides an option once it or one of its alternatives is used
+func fishNotContainsOpt(names []string) string {
+	var args []string
+	for _, name := range names {
+		if long, found := strings.CutPrefix(name, "--"); found {
+			args = append(args, fishEscape(long))
+		} else if short, found := strings.CutPrefix(name, "-"); found && len(short) == 1 {
+			args = append(args, "-s "+fishEscape(short))
+		}
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return "not __fish_contains_opt " + strings.Join(args, " ")
+}
+
+// fishEscape escapes a single word for fish
+func fishEscape(str string) string {
+	var escaped strings.Builder
+	for _, r := range str {
+		switch r {
+		case '\\', ' ', '\t', '\'', '"', '$', '(', ')', '{', '}', '[', ']', '*', '?', '~', '#', '&', '|', ';', '<', '>', '%':
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+func fishQuote(str string) string {
+	str = strings.ReplaceAll(str, `\`, `\\`)
+	str = strings.ReplaceAll(str, `'`, `\'`)
+	return "'" + str + "'"
+}
@@ -1,56 +1,79 @@
 package lib
 
 import (
-	"bytes"
 	_ "embed"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 	"io"
 	"math"
 	"os"
-	"path"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
-	"text/template"
-	"time"
 )
 
-//go:embed complete-template.go.sh
-var completeTemplate string
-
 const (
 	CompleteTypeClosure = "closure"
 	CompleteTypeChoices = "choices"
+	CompleteTypeFile    = "file"
+	CompleteTypeDir     = "dir"
+	CompleteTypeValue   = "value" // takes a value but has nothing to suggest for it
+	ValueStyleEquals    = "equals"
+	ValueStyleSpace     = "space"
+	ValueStyleBoth      = "both"
 	DefaultParser       = "__base_parser__"
+	ShellBash           = "bash"
+	ShellZsh            = "zsh"
+	ShellFish           = "fish"
 )
 
 type CliParserName string
+
+// CliParser is the base parser or a subparser, Name is the fully qualified name like cmd.subcmd
 type CliParser struct {
-	parserName      CliParserName
+	Name            CliParserName   `json:"name"`
+	Help            string          `json:"help,omitempty"`
+	Subparsers      []string        `json:"subparsers"`
+	Positionals     []CliPositional `json:"positionals"`
+	Optionals       []CliOptional   `json:"optionals"`
+	Groups          []CliGroup      `json:"groups"`
 	subparsers      map[CliParserName]bool
-	subparsersSeq   []string
-	positionals     []CliPositional
-	optionals       []CliOptional
 	positionalCount int
 }
 
+// CliGroup is a group of options, once one member of an exclusive group is used the others are hidden
+type CliGroup struct {
+	Name      string   `json:"name"`
+	Exclusive bool     `json:"exclusive"`
+	Members   []string `json:"members"`
+}
+
 type CliParsers struct {
 	parserMap map[CliParserName]CliParser
 	parserSeq []CliParserName
 }
 
+// MarshalJSON writes the parsers in the order they were added, the base parser first
+func (parsers *CliParsers) MarshalJSON() ([]byte, error) {
+	list := make([]CliParser, len(parsers.parserSeq))
+	for i, name := range parsers.parserSeq {
+		list[i] = parsers.parserMap[name]
+	}
+	return json.Marshal(list)
+}
+
 func (parsers *CliParsers) addPositional(pos CliPositional) {
-	name := pos.parser
+	name := pos.Parser
 	if parser, ok := parsers.parserMap[name]; ok {
 		pos.Number = parser.positionalCount
 		parser.positionalCount += 1
 		if pos.NArgs.Max != math.Inf(+1) && pos.NArgs.Max > 0 {
 			parser.positionalCount += int(pos.NArgs.Max) - 1
 		}
-		parser.positionals = append(parser.positionals, pos)
+		parser.Positionals = append(parser.Positionals, pos)
 		parsers.parserMap[name] = parser
 	} else {
 		parser = parsers.parser(name)
@@ -59,28 +82,52 @@ func (parsers *CliParsers) addPositional(pos CliPositional) {
 		if pos.NArgs.Max != math.Inf(+1) && pos.NArgs.Max > 0 {
 			parser.positionalCount += int(pos.NArgs.Max) - 1
 		}
-		parser.positionals = append(parser.positionals, pos)
+		parser.Positionals = append(parser.Positionals, pos)
 		parsers.parserMap[name] = parser
-		parsers.parserSeq = append(parsers.parserSeq, name)
 	}
 	parsers.addSubparserChoice(name)
 }
 
 func (parsers *CliParsers) addOptional(opt CliOptional) {
-	name := opt.parser
+	name := opt.Parser
 	if parser, ok := parsers.parserMap[name]; ok {
 		// existing parser
-		parser.optionals = append(parser.optionals, opt)
+		parser.Optionals = append(parser.Optionals, opt)
 		parsers.parserMap[name] = parser
 	} else {
 		// new parser
 		parser = parsers.parser(name)
-		parser.optionals = append(parser.optionals, opt)
+		parser.Optionals = append(parser.Optionals, opt)
 		parsers.parserMap[name] = parser
 	}
+	if opt.Group != "" {
+		parser := parsers.parserMap[name]
+		for i := range parser.Groups {
+			if parser.Groups[i].Name == opt.Group {
+				parser.Groups[i].Members = append(parser.Groups[i].Members, opt.Name)
+			}
+		}
+		parsers.parserMap[name] = parser
+	}
+	parsers.addSubparserChoice(name)
+}
+
+func (parsers *CliParsers) addGroup(name CliParserName, group CliGroup) {
+	parser := parsers.parser(name)
+	parser.Groups = append(parser.Groups, group)
+	parsers.parserMap[name] = parser
 	parsers.addSubparserChoice(name)
 }
 
+func (parsers *CliParsers) hasGroup(name CliParserName, groupName string) bool {
+	for _, group := range parsers.parserMap[name].Groups {
+		if group.Name == groupName {
+			return true
+		}
+	}
+	return false
+}
+
 func (parsers *CliParsers) addSubparserChoice(parserFQN CliParserName) {
 	if parserFQN == DefaultParser {
 		return
@@ -101,7 +148,7 @@ func (parsers *CliParsers) addSubparserChoice(parserFQN CliParserName) {
 				}
 				if _, ok := parserParent.subparsers[parserName]; !ok {
 					parserParent.subparsers[parserName] = true
-					parserParent.subparsersSeq = append(parserParent.subparsersSeq, string(parserName))
+					parserParent.Subparsers = append(parserParent.Subparsers, string(parserName))
 				}
 				parsers.parserMap[parserParentName] = parserParent
 			}
@@ -114,9 +161,11 @@ func (parsers *CliParsers) parser(name CliParserName) CliParser {
 		return parser
 	} else {
 		parser = CliParser{
-			parserName:      name,
-			positionals:     []CliPositional{},
-			optionals:       []CliOptional{},
+			Name:            name,
+			Subparsers:      []string{},
+			Positionals:     []CliPositional{},
+			Optionals:       []CliOptional{},
+			Groups:          []CliGroup{},
 			positionalCount: 1,
 		}
 		parsers.parserMap[name] = parser
@@ -126,25 +175,21 @@ func (parsers *CliParsers) parser(name CliParserName) CliParser {
 }
 
 func (parser CliParser) NameClean() string {
-	return cleanShellIdentifier(string(parser.parserName))
-}
-
-func (parser CliParser) Positionals() []CliPositional {
-	return parser.positionals
+	return cleanShellIdentifier(string(parser.Name))
 }
 
 func (parser CliParser) OptionalsNames() []string {
-	names := make([]string, len(parser.optionals))
-	for i, optional := range parser.optionals {
-		names[i] = optional.name
+	names := make([]string, len(parser.Optionals))
+	for i, optional := range parser.Optionals {
+		names[i] = optional.Name
 	}
 	return names
 }
 
 func (parser CliParser) OptionalsNameMap() map[string]string {
-	names := make(map[string]string, len(parser.optionals))
-	for _, optional := range parser.optionals {
-		names[optional.name] = "1"
+	names := make(map[string]string, len(parser.Optionals))
+	for _, optional := range parser.Optionals {
+		names[optional.Name] = "1"
 	}
 	return names
 }
@@ -154,49 +199,96 @@ func (parser CliParser) OptionalsData() map[string]string {
 		return fmt.Sprintf(format, vals...)
 	}
 	assoc := make(map[string]string, 0)
-	for _, optional := range parser.optionals {
-		if optional.completeType != "" {
-			assoc["__type__,"+optional.name] = optional.completeType
-			if optional.completeType == "choices" {
-				assoc["__value__,"+optional.name] = strings.Join(optional.choices, " ")
-			} else if optional.completeType == "closure" {
-				assoc["__value__,"+optional.name] = optional.closureName
+	for _, optional := range parser.Optionals {
+		if optional.CompleteType != "" {
+			assoc["__type__,"+optional.Name] = optional.CompleteType
+			if optional.CompleteType == "choices" {
+				// read -a splits the choices on spaces that aren't escaped
+				escaped := make([]string, len(optional.Choices))
+				for i, choice := range optional.Choices {
+					escaped[i] = bashReadEscaper.Replace(choice)
+				}
+				assoc["__value__,"+optional.Name] = strings.Join(escaped, " ")
+			} else if optional.CompleteType == "closure" {
+				assoc["__value__,"+optional.Name] = optional.ClosureName
+			} else if optional.CompleteType == CompleteTypeFile || optional.CompleteType == CompleteTypeDir {
+				assoc["__value__,"+optional.Name] = strings.Join(optional.Globs, ",")
 			}
 		}
 		if optional.NArgs.Max > 0.0 {
 			if optional.NArgs.Max == math.Inf(+1) {
-				assoc["__narg_max__,"+optional.name] = "inf"
+				assoc["__narg_max__,"+optional.Name] = "inf"
 			} else {
-				assoc["__narg_max__,"+optional.name] = fmt.Sprintf("%.0f", optional.NArgs.Max)
+				assoc["__narg_max__,"+optional.Name] = fmt.Sprintf("%.0f", optional.NArgs.Max)
 			}
-			assoc["__narg_count__,"+optional.name] = "0"
+			assoc["__narg_count__,"+optional.Name] = "0"
 		}
 		if optional.NArgs.NoSpace {
-			assoc["__narg_nospace__,"+optional.name] = "1"
+			assoc["__narg_nospace__,"+optional.Name] = "1"
 		}
-		name := optional.name
-		if len(optional.alternatives) > 0 {
-			// todo: algorithm complexity for alternatives is currently O(n*n)
-			allAlternatives := append(optional.alternatives, name)
-			for i, altCur := range allAlternatives {
-				index := 0
-				for j, altOther := range allAlternatives {
-					if i == j {
-						continue
-					}
-					assoc[key("__alternatives__,%s,%d", altCur, index)] = altOther
-					index += 1
-				}
-			}
+		if optional.ValueStyle == ValueStyleEquals || optional.ValueStyle == ValueStyleSpace {
+			assoc["__value_style__,"+optional.Name] = optional.ValueStyle
+		}
+		// alternatives and exclusive group members are hidden once the option is used
+		for index, conflict := range parser.conflicts(optional.Name) {
+			assoc[key("__alternatives__,%s,%d", optional.Name, index)] = conflict
 		}
 	}
 
 	return assoc
 }
 
+// aliases is the option name with its alternatives, the primary name first
+func (parser CliParser) aliases(name string) []string {
+	for _, optional := range parser.Optionals {
+		if len(optional.Alternatives) == 0 {
+			continue
+		}
+		names := append([]string{optional.Name}, optional.Alternatives...)
+		for _, alias := range names {
+			if alias == name {
+				return names
+			}
+		}
+	}
+	return []string{name}
+}
+
+// conflicts are the options that can't be used after name: its alternatives and the other members
+// of its exclusive groups
+func (parser CliParser) conflicts(name string) []string {
+	var conflicts []string
+	seen := map[string]bool{name: true}
+	add := func(names []string) {
+		for _, conflict := range names {
+			if !seen[conflict] {
+				seen[conflict] = true
+				conflicts = append(conflicts, conflict)
+			}
+		}
+	}
+
+	aliases := parser.aliases(name)
+	add(aliases)
+	for _, group := range parser.Groups {
+		if !group.Exclusive {
+			continue
+		}
+		for _, member := range group.Members {
+			if member == aliases[0] {
+				for _, other := range group.Members {
+					add(parser.aliases(other))
+				}
+				break
+			}
+		}
+	}
+	return conflicts
+}
+
 func (parser CliParser) PositionalsData() map[string]string {
 	assoc := make(map[string]string, 0)
-	for _, positional := range parser.positionals {
+	for _, positional := range parser.Positionals {
 		if positional.NArgs != (CliNargs{}) {
 			num := fmt.Sprintf("%d", positional.Number)
 			assoc["__nargs_min__,"+num] = fmt.Sprintf("%.0f", positional.NArgs.Min)
@@ -207,10 +299,6 @@ func (parser CliParser) PositionalsData() map[string]string {
 	return assoc
 }
 
-func (parser CliParser) Subparsers() []string {
-	return parser.subparsersSeq
-}
-
 // CliNargs
 // {min,max}
 // ? => {0,1}
@@ -225,45 +313,78 @@ type CliNargs struct {
 	NoSpace bool
 }
 
-type CliPositional struct {
-	parser       CliParserName
-	Number       int
-	CompleteType string
-	ClosureName  string
-	Choices      []string
-	NArgs        CliNargs
+// MarshalJSON writes an unbounded min or max as null since json has no infinity
+func (nargs CliNargs) MarshalJSON() ([]byte, error) {
+	bound := func(value float64) *float64 {
+		if math.IsInf(value, 0) {
+			return nil
+		}
+		return &value
+	}
+	return json.Marshal(struct {
+		Min     *float64 `json:"min"`
+		Max     *float64 `json:"max"`
+		Unique  bool     `json:"unique"`
+		IsSet   bool     `json:"is_set"`
+		NoSpace bool     `json:"nospace"`
+	}{bound(nargs.Min), bound(nargs.Max), nargs.Unique, nargs.IsSet, nargs.NoSpace})
 }
 
-type CliOptional struct {
-	parser       CliParserName
-	parserParent CliParser
-	name         string
-	completeType string
-	closureName  string
-	choices      []string
-	NArgs        CliNargs
-	alternatives []string
+// CliPositional is a positional, Number is its 1-based position counting every value of the positionals before it
+type CliPositional struct {
+	Parser             CliParserName     `json:"parser"`
+	Number             int               `json:"number"`
+	CompleteType       string            `json:"complete_type,omitempty"`
+	ClosureName        string            `json:"closure,omitempty"`
+	Choices            []string          `json:"choices,omitempty"`
+	ChoiceDescriptions map[string]string `json:"choice_descriptions,omitempty"`
+	Globs              []string          `json:"globs,omitempty"`
+	NArgs              CliNargs          `json:"nargs"`
+	Help               string            `json:"help,omitempty"`
 }
 
-type ReloadTrigger struct {
-	File      string
-	Timestamp int64
+// CliOptional is an option, every alternative name is also added to the parser as its own CliOptional
+type CliOptional struct {
+	Parser             CliParserName     `json:"parser"`
+	Name               string            `json:"name"`
+	CompleteType       string            `json:"complete_type,omitempty"`
+	ClosureName        string            `json:"closure,omitempty"`
+	Choices            []string          `json:"choices,omitempty"`
+	ChoiceDescriptions map[string]string `json:"choice_descriptions,omitempty"`
+	Globs              []string          `json:"globs,omitempty"`
+	ValueStyle         string            `json:"value_style,omitempty"`
+	Group              string            `json:"group,omitempty"`
+	NArgs              CliNargs          `json:"nargs"`
+	Alternatives       []string          `json:"alternatives,omitempty"`
+	Help               string            `json:"help,omitempty"`
 }
 
-func (r ReloadTrigger) String() string {
-	return r.File
+type CliConfig struct {
+	Shell                 string          `json:"shell"`
+	Outfile               string          `json:"outfile"`
+	IncludeSources        []string        `json:"include_source"`
+	MergeSingleOpt        bool            `json:"merge_single_opt"`
+	AutogenLang           string          `json:"autogen_lang"`
+	AutogenFile           string          `json:"autogen_file"`
+	AutogenClosureCmd     string          `json:"autogen_closure_cmd"`
+	AutogenClosureFunc    string          `json:"autogen_closure_func"`
+	AutogenClosureSource  string          `json:"autogen_closure_source"`
+	AutogenHelpCmd        string          `json:"autogen_help_cmd"`
+	AutogenHelpDepth      int             `json:"autogen_help_depth"`
+	AutogenReloadTriggers []ReloadTrigger `json:"autogen_reload_trigger"`
+	LogLevel              string          `json:"log_level"` // set by -debug, empty scripts don't log
 }
 
-type CliConfig struct {
-	Outfile               string
-	IncludeSources        []string
-	MergeSingleOpt        bool
-	AutogenLang           string
-	AutogenFile           string
-	AutogenClosureCmd     string
-	AutogenClosureFunc    string
-	AutogenClosureSource  string
-	AutogenReloadTriggers []ReloadTrigger
+// MarshalJSON writes unset lists as [] like the parser lists so dumps diff the same
+func (config CliConfig) MarshalJSON() ([]byte, error) {
+	type plainConfig CliConfig
+	if config.IncludeSources == nil {
+		config.IncludeSources = []string{}
+	}
+	if config.AutogenReloadTriggers == nil {
+		config.AutogenReloadTriggers = []ReloadTrigger{}
+	}
+	return json.Marshal(plainConfig(config))
 }
 
 func (c Cli) CliName() string {
@@ -275,7 +396,7 @@ func (c Cli) CliNameClean() string {
 }
 
 func (c Cli) OperationsComment() string {
-	return "# " + strings.Join(c.Operations, "\n# ")
+	return BashComment(c.Operations)
 }
 
 func (c Cli) OperationsReloadConfig() []string {
@@ -294,6 +415,17 @@ type Cli struct {
 	Parsers               *CliParsers
 	Operations            []string
 	prevNArgIndeterminant bool
+	specDir               string
+}
+
+// MarshalJSON writes the resolved model, the field names are stable for tools diffing it
+func (c Cli) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		CliName    string      `json:"cli_name"`
+		Config     CliConfig   `json:"config"`
+		Parsers    *CliParsers `json:"parsers"`
+		Operations []string    `json:"operations"`
+	}{c.cliName, c.Config, c.Parsers, c.Operations})
 }
 
 type Argument struct {
@@ -335,8 +467,21 @@ func (d templateData) Parsers() []CliParser {
 	return parsers
 }
 
+// ScriptLogs is true when the script logs too, its logs are all debug level
+func (d templateData) ScriptLogs() bool {
+	return d.Cli.Config.LogLevel == "trace" || d.Cli.Config.LogLevel == "debug"
+}
+
+// ReloadCheckCommand runs the reload check, in debug mode at the level the script was compiled with
+func (d templateData) ReloadCheckCommand() string {
+	if d.Cli.Config.LogLevel == "" {
+		return "shcomp2 -reload-check"
+	}
+	return "shcomp2 -debug -log-level=" + d.Cli.Config.LogLevel + " -reload-check"
+}
+
 func (d templateData) OperationsComment() string {
-	return "# " + strings.Join(d.Cli.Operations, "\n# ")
+	return BashComment(d.Cli.Operations)
 }
 
 func (d templateData) StringsJoin(values []string, indent int) string {
@@ -347,9 +492,29 @@ func (d templateData) StringsJoin(values []string, indent int) string {
 	return strings.Join(values, "\n"+indentStr)
 }
 
+// CompletesPaths is true when any option or positional uses file or dir completion
+func (d templateData) CompletesPaths() bool {
+	isPath := func(completeType string) bool {
+		return completeType == CompleteTypeFile || completeType == CompleteTypeDir
+	}
+	for _, parser := range d.Parsers() {
+		for _, optional := range parser.Optionals {
+			if isPath(optional.CompleteType) {
+				return true
+			}
+		}
+		for _, pos := range parser.Positionals {
+			if isPath(pos.CompleteType) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (d templateData) NargsSwitchHas() bool {
 	for _, parser := range d.Parsers() {
-		for _, pos := range parser.positionals {
+		for _, pos := range parser.Positionals {
 			if pos.NArgs != (CliNargs{}) {
 				return true
 			}
@@ -365,7 +530,7 @@ func (d templateData) NargsSwitch() string {
 	foundNargs := false
 	infinity := false
 	for _, parser := range d.Parsers() {
-		for _, pos := range parser.positionals {
+		for _, pos := range parser.Positionals {
 			if pos.NArgs != (CliNargs{}) {
 				foundNargs = true
 				if pos.NArgs.Max == math.Inf(+1) {
@@ -402,6 +567,43 @@ func (d templateData) NargsSwitch() string {
 	}
 }
 
+// DescriptionsData maps candidates to their help text. Options are keyed by name, option choices by
+// "option,choice" and positional choices (including subparsers) by "number,choice"
+func (d templateData) DescriptionsData(parser CliParser) map[string]string {
+	assoc := make(map[string]string, 0)
+	for _, optional := range parser.Optionals {
+		if optional.Help != "" {
+			assoc[optional.Name] = optional.Help
+		}
+		for choice, description := range optional.ChoiceDescriptions {
+			assoc[optional.Name+","+choice] = description
+		}
+	}
+	if len(parser.Subparsers) > 0 {
+		for _, name := range parser.Subparsers {
+			if help := d.subparserHelp(parser, name); help != "" {
+				assoc["1,"+name] = help
+			}
+		}
+		return assoc
+	}
+	for _, pos := range parser.Positionals {
+		for choice, description := range pos.ChoiceDescriptions {
+			assoc[fmt.Sprintf("%d,%s", pos.Number, choice)] = description
+		}
+	}
+	return assoc
+}
+
+// subparserHelp is the help of the subparser name of parser, if it has one
+func (d templateData) subparserHelp(parser CliParser, name string) string {
+	fqn := CliParserName(name)
+	if parser.Name != DefaultParser {
+		fqn = parser.Name + "." + fqn
+	}
+	return d.Cli.Parsers.parserMap[fqn].Help
+}
+
 func ParseOperationsStdin(stdin io.Reader) (string, error) {
 	content, err := io.ReadAll(stdin)
 	Check(err)
@@ -414,7 +616,34 @@ func ParseOperationsStdin(stdin io.Reader) (string, error) {
 	return completeCode, nil
 }
 
-func parseNargs(value string, nargs CliNargs) (CliNargs, error) {
+// parseCompleteType parses the built-in complete types: file, dir, value and file:glob,glob...
+func parseCompleteType(value string) (string, []string, error) {
+	completeType, globsStr, hasGlobs := strings.Cut(value, ":")
+	switch completeType {
+	case CompleteTypeFile, CompleteTypeDir, CompleteTypeValue:
+	default:
+		return "", nil, unknownCompleteType(completeType)
+	}
+	if !hasGlobs {
+		return completeType, nil, nil
+	}
+	if completeType != CompleteTypeFile {
+		return "", nil, errGlobFilters
+	}
+	var globs []string
+	for _, glob := range strings.Split(globsStr, ",") {
+		if glob = strings.TrimSpace(glob); glob != "" {
+			globs = append(globs, glob)
+		}
+	}
+	if len(globs) == 0 {
+		return "", nil, fmt.Errorf("missing glob filters in %q", value)
+	}
+	return completeType, globs, nil
+}
+
+// ParseNargs reads a count like 2, ?, *, + or {1,3} into nargs, Unique and NoSpace are kept
+func ParseNargs(value string, nargs CliNargs) (CliNargs, error) {
 	if value == "*" || value == "inf" {
 		nargs.Min = 0
 		nargs.Max = math.Inf(+1)
@@ -463,110 +692,176 @@ func parseNargs(value string, nargs CliNargs) (CliNargs, error) {
 	return nargs, nil
 }
 
-func ParseOperations(operationsStr string) (Cli, error) {
-	var parsers = CliParsers{
-		parserMap: map[CliParserName]CliParser{},
-		parserSeq: []CliParserName{},
+// ParseError is a failure to parse a single operation. Line and Column are 1-based
+type ParseError struct {
+	Line   int
+	Column int
+	Op     string
+	Msg    string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// ParseErrors collects every ParseError found in a single parse
+type ParseErrors []ParseError
+
+func (errs ParseErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
 	}
+	return strings.Join(messages, "\n")
+}
 
-	cli := Cli{
-		Config: CliConfig{Outfile: "-"},
+// ParseOperationsFile parses a spec file. Relative paths in the spec are resolved against the spec file's directory
+func ParseOperationsFile(specFile string) (Cli, error) {
+	content, err := os.ReadFile(specFile)
+	if err != nil {
+		return Cli{}, fmt.Errorf("unable to read spec file: %w", err)
 	}
-	cli.prevNArgIndeterminant = false
-	parsers.parser(DefaultParser)
+	specDir, err := filepath.Abs(filepath.Dir(specFile))
+	if err != nil {
+		return Cli{}, err
+	}
+	return parseOperations(string(content), specDir)
+}
+
+func ParseOperations(operationsStr string) (Cli, error) {
+	return parseOperations(operationsStr, "")
+}
+
+// ParseOperationsDir parses operations that came from a spec in specDir, relative paths resolve against it
+func ParseOperationsDir(operationsStr string, specDir string) (Cli, error) {
+	return parseOperations(operationsStr, specDir)
+}
+
+func parseOperations(operationsStr string, specDir string) (Cli, error) {
+	cli := NewCli(specDir)
 
 	var operationLinesParsed []string
+	var parseErrors ParseErrors
 	operationLines := strings.Split(operationsStr, "\n")
-	for opIndex, opStr := range operationLines {
-		opStr = strings.TrimSpace(opStr)
+nextOperation:
+	for opIndex, opLine := range operationLines {
+		opStr := strings.TrimSpace(opLine)
 		if opStr == "" {
 			continue
 		}
 
-		words := parseWords(opStr)
+		words, columns := parseWordsColumns(opStr)
+		if len(words) == 0 {
+			continue
+		}
 		opType := words[0]
+		indent := strings.Index(opLine, opStr)
 		var intOperations []string
 
+		// column is relative to the trimmed operation
+		addError := func(column int, format string, values ...any) {
+			parseErrors = append(parseErrors, ParseError{
+				Line:   opIndex + 1,
+				Column: indent + column,
+				Op:     opType,
+				Msg:    fmt.Sprintf(format, values...),
+			})
+		}
+		endColumn := len(opStr) + 1
+
 		switch opType {
 		case "int":
 			continue
 		case "cfg":
+			if len(words) < 2 {
+				addError(endColumn, "missing config name=value")
+				continue
+			}
 			configName, configValue, valid := strings.Cut(unquote(words[1]), "=")
 			if !valid {
-				panic(fmt.Sprintf("error : cfg op is invalid : %s", opStr))
+				addError(columns[1], "invalid config %q, expected name=value", words[1])
+				continue
 			}
 			configName = unquote(configName)
 			configValue = unquote(configValue)
-			switch configName {
-			case "cli_name":
-				cli.cliName = configValue
-			case "outfile":
-				cli.Config.Outfile = configValue
-			case "include_source":
-				cli.Config.IncludeSources = append(cli.Config.IncludeSources, configValue)
-			case "autogen_lang":
-				cli.Config.AutogenLang = configValue
-			case "autogen_file":
-				cli.Config.AutogenFile = configValue
-			case "autogen_closure_cmd":
-				cli.Config.AutogenClosureCmd = configValue
-			case "autogen_closure_func":
-				cli.Config.AutogenClosureFunc = configValue
-			case "autogen_closure_source":
-				cli.Config.AutogenClosureSource = configValue
-			case "merge_single_opt":
-				if strings.TrimSpace(configValue) == "1" {
-					cli.Config.MergeSingleOpt = true
-				}
-			case "autogen_reload_trigger":
-				reloadTrigger := ReloadTrigger{
-					File:      configValue,
-					Timestamp: 0,
-				}
-				if len(operationLines) > opIndex+1 {
-					nextOp := strings.TrimSpace(operationLines[opIndex+1])
+			if resolved := cli.resolveConfigPath(configName, configValue); resolved != configValue {
+				configValue = resolved
+				opStr = fmt.Sprintf("cfg %s=%s", configName, QuoteWord(configValue))
+			}
+			var stored ReloadTrigger
+			if configName == "autogen_reload_trigger" {
+				// the state stored when the script was compiled follows the cfg operation
+				for _, nextLine := range operationLines[opIndex+1:] {
+					nextOp := strings.TrimSpace(nextLine)
 					if strAfter, found := strings.CutPrefix(nextOp, "int autogen_reload_trigger_ts="); found {
-						timestamp, _ := strconv.Atoi(strAfter)
-						reloadTrigger.Timestamp = int64(timestamp)
+						stored.Timestamp, _ = strconv.ParseInt(strAfter, 10, 64)
+					} else if strAfter, found := strings.CutPrefix(nextOp, "int autogen_reload_trigger_size="); found {
+						stored.Size, _ = strconv.ParseInt(strAfter, 10, 64)
+					} else if strAfter, found := strings.CutPrefix(nextOp, "int autogen_reload_trigger_hash="); found {
+						stored.Hash = strAfter
+					} else if strAfter, found := strings.CutPrefix(nextOp, "int autogen_reload_trigger_racy="); found {
+						stored.Racy = strAfter == "1"
+					} else {
+						break
 					}
 				}
-				cli.Config.AutogenReloadTriggers = append(cli.Config.AutogenReloadTriggers, reloadTrigger)
-
-				if reloadTrigger.Timestamp == 0 {
-					fileInfo, err := os.Stat(configValue)
-					reloadTrigger.Timestamp = fileInfo.ModTime().UnixMilli()
-					if err != nil {
-						panic(err)
-					}
-				}
-				intOperations = append(intOperations, fmt.Sprintf("int autogen_reload_trigger_ts=%d", reloadTrigger.Timestamp))
+			}
+			var err error
+			if intOperations, err = cli.setConfig(configName, configValue, stored); err != nil {
+				addError(columns[1], "%s", err)
+				continue
 			}
 		case "pos":
 			arg := CliPositional{}
 
 			if cli.prevNArgIndeterminant {
-				return Cli{}, fmt.Errorf("cannot have a positional come after a indeterminant narg positional")
+				addError(columns[0], "%s", errIndeterminantPositional)
+				continue
 			}
 
 			// -p=parser
 			if len(words) > 1 && strings.HasPrefix(words[1], "-p=") {
 				if value, ok := tryOption(words[1], "-p"); ok {
-					arg.parser = CliParserName(value)
+					arg.Parser = CliParserName(value)
 					words = append(words[:1], words[1+1:]...)
+					columns = append(columns[:1], columns[1+1:]...)
 				}
 			} else {
-				arg.parser = DefaultParser
+				arg.Parser = DefaultParser
 			}
 
-			for _, word := range words {
-				if value, ok := tryOption(word, "--choices"); ok {
+			for i, word := range words {
+				if _, ok := tryOption(word, "--choices"); ok {
 					arg.CompleteType = CompleteTypeChoices
-					arg.Choices = strings.Fields(value)
+					arg.Choices = parseChoices(word)
 				}
 				if value, ok := tryOption(word, "--closure"); ok {
 					arg.CompleteType = CompleteTypeClosure
 					arg.ClosureName = value
 				}
+				if value, ok := tryOption(word, "--complete"); ok {
+					completeType, globs, err := parseCompleteType(value)
+					if err != nil {
+						addError(columns[i], "%s", err)
+						continue nextOperation
+					}
+					arg.CompleteType = completeType
+					arg.Globs = globs
+				}
+				if value, ok := tryOption(word, "--help"); ok {
+					arg.Help = value
+				}
+				if value, ok := tryOption(word, "--desc"); ok {
+					choice, description, valid := strings.Cut(value, "=")
+					if !valid {
+						addError(columns[i], "invalid choice description %q, expected choice=description", value)
+						continue nextOperation
+					}
+					if arg.ChoiceDescriptions == nil {
+						arg.ChoiceDescriptions = map[string]string{}
+					}
+					arg.ChoiceDescriptions[choice] = unquote(description)
+				}
 				if _, ok := tryOption(word, "--nargs-unique"); ok {
 					nargs := arg.NArgs
 					nargs.Unique = true
@@ -574,103 +869,174 @@ func ParseOperations(operationsStr string) (Cli, error) {
 				}
 				if value, ok := tryOption(word, "--nargs"); ok {
 					nargs := arg.NArgs
-					nargs, err := parseNargs(value, nargs)
+					nargs, err := ParseNargs(value, nargs)
 					if err != nil {
-						return Cli{}, err
+						addError(columns[i], "%s", err)
+						continue nextOperation
 					}
 					arg.NArgs = nargs
-					if nargs.Min != nargs.Max || nargs.Max == math.Inf(+1) {
-						cli.prevNArgIndeterminant = true
-					}
 				}
 			}
 
-			parsers.addPositional(arg)
+			cli.addPositional(arg)
 		case "opt":
 			opt := CliOptional{}
 
 			// -p=parser can come before name
-			if strings.HasPrefix(words[1], "-p=") {
+			if len(words) > 1 && strings.HasPrefix(words[1], "-p=") {
 				if value, ok := tryOption(words[1], "-p"); ok {
-					opt.parser = CliParserName(value)
+					opt.Parser = CliParserName(value)
 					words = append(words[:1], words[1+1:]...)
+					columns = append(columns[:1], columns[1+1:]...)
 				}
 			} else {
-				opt.parser = DefaultParser
+				opt.Parser = DefaultParser
+			}
+
+			if len(words) < 2 {
+				addError(endColumn, "missing option name")
+				continue
 			}
 
 			optName := unquote(words[1])
 			optNameSplit := strings.Split(optName, "|")
-			opt.name = optNameSplit[0]
-			opt.alternatives = optNameSplit[1:]
+			opt.Name = optNameSplit[0]
+			if len(optNameSplit) > 1 {
+				opt.Alternatives = optNameSplit[1:]
+			}
 
-			for _, word := range words {
-				if value, ok := tryOption(word, "--choices"); ok {
-					opt.completeType = CompleteTypeChoices
-					opt.choices = strings.Fields(value)
+			for i, word := range words {
+				if i <= 1 {
+					// operation and option name
+					continue
+				}
+				if _, ok := tryOption(word, "--choices"); ok {
+					opt.CompleteType = CompleteTypeChoices
+					opt.Choices = parseChoices(word)
 				}
 				if value, ok := tryOption(word, "--closure"); ok {
-					opt.completeType = CompleteTypeClosure
-					opt.closureName = value
+					opt.CompleteType = CompleteTypeClosure
+					opt.ClosureName = value
+				}
+				if value, ok := tryOption(word, "--complete"); ok {
+					completeType, globs, err := parseCompleteType(value)
+					if err != nil {
+						addError(columns[i], "%s", err)
+						continue nextOperation
+					}
+					opt.CompleteType = completeType
+					opt.Globs = globs
+				}
+				if value, ok := tryOption(word, "--value-style"); ok {
+					if err := checkValueStyle(value); err != nil {
+						addError(columns[i], "%s", err)
+						continue nextOperation
+					}
+					opt.ValueStyle = value
+				}
+				if value, ok := tryOption(word, "--help"); ok {
+					opt.Help = value
+				}
+				if value, ok := tryOption(word, "--desc"); ok {
+					choice, description, valid := strings.Cut(value, "=")
+					if !valid {
+						addError(columns[i], "invalid choice description %q, expected choice=description", value)
+						continue nextOperation
+					}
+					if opt.ChoiceDescriptions == nil {
+						opt.ChoiceDescriptions = map[string]string{}
+					}
+					opt.ChoiceDescriptions[choice] = unquote(description)
 				}
 				if value, ok := tryOption(word, "--nargs"); ok {
 					nargs := opt.NArgs
-					nargs, err := parseNargs(value, nargs)
+					nargs, err := ParseNargs(value, nargs)
 					if err != nil {
-						return Cli{}, err
+						addError(columns[i], "%s", err)
+						continue nextOperation
 					}
 					opt.NArgs = nargs
 				}
 				if _, ok := tryOption(word, "--nargs-nospace"); ok {
 					opt.NArgs.NoSpace = true
 				}
-			}
-
-			parsers.addOptional(opt)
-
-			if len(opt.alternatives) > 0 {
-				if opt.NArgs.IsSet {
-					return Cli{}, fmt.Errorf("nargs and alternatives is not supported")
-				}
-				for _, alt := range opt.alternatives {
-					altOpt := CliOptional{
-						parser:       opt.parser,
-						parserParent: opt.parserParent,
-						name:         alt,
-						completeType: opt.completeType,
-						closureName:  opt.closureName,
-						choices:      opt.choices,
+				if value, ok := tryOption(word, "--group"); ok {
+					if err := cli.Parsers.checkGroup(opt.Parser, value); err != nil {
+						addError(columns[i], "%s", err)
+						continue nextOperation
 					}
-					parsers.addOptional(altOpt)
+					opt.Group = value
 				}
 			}
+
+			if len(opt.Alternatives) > 0 && opt.NArgs.IsSet {
+				addError(columns[1], "%s", errNargsAlternatives)
+				continue
+			}
+
+			cli.addOptional(opt)
 		case "psr":
 			// allow standalone subparsers that only do one thing
 			var parentParserName string
-			var parserName string
-			var parserFQN string
 
 			// -p=parser can come before name
-			if strings.HasPrefix(words[1], "-p=") {
+			if len(words) > 1 && strings.HasPrefix(words[1], "-p=") {
 				if value, ok := tryOption(words[1], "-p"); ok {
 					parentParserName = value
 					words = append(words[:1], words[1+1:]...)
+					columns = append(columns[:1], columns[1+1:]...)
 				}
 			} else {
 				parentParserName = DefaultParser
 			}
 
-			parserName = words[1]
+			if len(words) < 2 {
+				addError(endColumn, "missing parser name")
+				continue
+			}
+
+			var help string
+			for _, word := range words[2:] {
+				if value, ok := tryOption(word, "--help"); ok {
+					help = value
+				}
+			}
+			cli.addParser(CliParserName(parentParserName), words[1], help)
+		case "grp":
+			group := CliGroup{}
+			var parserName CliParserName
 
-			if parentParserName == DefaultParser {
-				parserFQN = parserName
+			// -p=parser can come before name
+			if len(words) > 1 && strings.HasPrefix(words[1], "-p=") {
+				if value, ok := tryOption(words[1], "-p"); ok {
+					parserName = CliParserName(value)
+					words = append(words[:1], words[1+1:]...)
+					columns = append(columns[:1], columns[1+1:]...)
+				}
 			} else {
-				parserFQN = parentParserName + "." + parserName
+				parserName = DefaultParser
 			}
 
-			parsers.addSubparserChoice(CliParserName(parserFQN))
+			if len(words) < 2 {
+				addError(endColumn, "missing group name")
+				continue
+			}
+
+			group.Name = unquote(words[1])
+			if err := cli.Parsers.checkNewGroup(parserName, group.Name); err != nil {
+				addError(columns[1], "%s", err)
+				continue
+			}
+			for _, word := range words[2:] {
+				if _, ok := tryOption(word, "--exclusive"); ok {
+					group.Exclusive = true
+				}
+			}
+
+			cli.Parsers.addGroup(parserName, group)
 		default:
-			panic(fmt.Sprintf("error : unknown operation : %s", opType))
+			addError(columns[0], "unknown operation %q", opType)
+			continue
 		}
 
 		operationLinesParsed = append(operationLinesParsed, opStr)
@@ -679,7 +1045,10 @@ func ParseOperations(operationsStr string) (Cli, error) {
 		}
 	}
 
-	cli.Parsers = &parsers
+	if len(parseErrors) > 0 {
+		return Cli{}, parseErrors
+	}
+
 	cli.Operations = operationLinesParsed
 	return cli, nil
 }
@@ -702,112 +1071,29 @@ func CommitCli(cli Cli, compiled string, stdout io.Writer) error {
 }
 
 func CompileCli(cli Cli) (string, error) {
+	shell := cli.Config.Shell
+	if shell == "" {
+		shell = ShellBash
+	}
+	shellBackend, ok := backends[shell]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell %s", shell)
+	}
+
 	data := templateData{
-		ModifiedTimeMs:     time.Now().UnixMilli(),
 		Cli:                cli,
 		DefaultParserClean: cleanShellIdentifier(DefaultParser),
 	}
-
-	// new template feature '\}}' chomps next newline rather than trim all whitespace '-}}'
-	pattern := regexp.MustCompile(`(^|\n)([\t\r ]+)(\{\{.*)\\(}}[\t\r ]*)\n(.*)($|\n)`)
-	completeTemplateNew := pattern.ReplaceAllFunc([]byte(completeTemplate), func(matched []byte) []byte {
-		match := pattern.FindStringSubmatch(string(matched))
-		matchStart := match[1]
-		matchStartWhitespace := match[2]
-		matchAction := match[3] + match[4]
-		matchNextLine := match[5] + match[6]
-		nextLine, _ := strings.CutPrefix(matchNextLine, matchStartWhitespace)
-		replaceStr := matchStart + matchStartWhitespace + matchAction + nextLine
-		return []byte(replaceStr)
-	})
-
-	// dedent `{{ something | indent num }}`
-	completeTemplateNew = regexp.MustCompile(`(?m:^\s+(.*\| indent \d+ }}))`).ReplaceAll(completeTemplateNew, []byte("$1"))
-
-	t := template.New("shcomp2-compile")
-	var funcMap = template.FuncMap{
-		"StringsJoin":      strings.Join,
-		"BashArray":        BashArray,
-		"BashAssocQuote":   BashAssocQuote,
-		"BashAssocNoQuote": BashAssocNoQuote,
-		"BashAssoc":        BashAssoc,
-		"loop": func(from any, to any) <-chan int {
-			ch := make(chan int)
-			var fromint int
-			var toint int
-			switch v := from.(type) {
-			case int:
-				fromint = v
-			case float64:
-				fromint = int(v)
-			}
-			switch v := to.(type) {
-			case int:
-				toint = v
-			case float64:
-				toint = int(v)
-			}
-			go func() {
-				for i := fromint; i <= toint; i++ {
-					ch <- i
-				}
-				close(ch)
-			}()
-			return ch
-		},
-	}
-	funcMap["include"] = func(name string, data ...any) (string, error) {
-		buf := bytes.NewBuffer(nil)
-		if err := t.ExecuteTemplate(buf, name, data); err != nil {
-			return "", err
-		}
-		return buf.String(), nil
-	}
-	funcMap["indent"] = func(indent int, data ...any) string {
-		switch v := data[0].(type) {
-		case string:
-			var indentStr = strings.Repeat(" ", indent)
-			var indented strings.Builder
-			var indentNext = false
-			indented.WriteString(indentStr)
-			for _, r := range v {
-				if r == '\n' {
-					indentNext = true
-				} else if indentNext {
-					indented.WriteString(indentStr)
-					indentNext = false
-				}
-
-				indented.WriteRune(r)
-			}
-			return indented.String()
-		default:
-			panic("unknown data type")
+	// the same spec compiles to the same bytes, a timestamp is only added when the build asks for one
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil || seconds < 0 {
+			return "", fmt.Errorf("invalid SOURCE_DATE_EPOCH %q, expected seconds since the epoch", epoch)
 		}
+		data.ModifiedTimeMs = seconds * 1000
 	}
-	templateParsed, err := t.Funcs(funcMap).Parse(string(completeTemplateNew))
-	Check(err)
 
-	var buffer bytes.Buffer
-	err = templateParsed.Execute(&buffer, data)
-	if err != nil {
-		re := regexp.MustCompile(`shcomp2-compile:(\d+):(\d+)`)
-		matches := re.FindStringSubmatch(err.Error())
-		col, _ := strconv.Atoi(matches[2])
-		return "", fmt.Errorf(
-			"error in template ./pkg/lib/complete-template.go.sh:%s:%d: \n%s",
-			matches[1],
-			col+1,
-			err,
-		)
-	}
-
-	compiledShell := buffer.String()
-
-	// collapse multiple newlines into one
-	compiledShell = regexp.MustCompile(`(?m)^\s+\n`).ReplaceAllString(compiledShell, "\n")
-
-	return compiledShell, nil
+	return shellBackend.compile(data)
 }
 
 func tryOption(word string, name string) (string, bool) {
@@ -823,8 +1109,46 @@ func tryOption(word string, name string) (string, bool) {
 	}
 }
 
+func resolveSpecPath(specDir string, file string) string {
+	if specDir == "" || file == "" || filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(specDir, file)
+}
+
+// parseChoices splits the value of --choices into words so a choice can be quoted, like 'us east'. The value isn't
+// unquoted first as that would take the quotes of the first and last choice
+func parseChoices(word string) []string {
+	_, value, _ := strings.Cut(word, "=")
+	return parseWords(value)
+}
+
+// QuoteChoices quotes choices as the value of --choices. Choices with spaces, quotes or backslashes are quoted
+// as words of their own, the others are separated by spaces like in a spec file
+func QuoteChoices(choices []string) string {
+	words := make([]string, len(choices))
+	for i, choice := range choices {
+		switch {
+		case !strings.ContainsAny(choice, " \t'\"\\"):
+			words[i] = choice
+		case !strings.Contains(choice, "'"):
+			words[i] = "'" + choice + "'"
+		default:
+			words[i] = QuoteWord(choice)
+		}
+	}
+	return QuoteWord(strings.Join(words, " "))
+}
+
+// QuoteWord quotes a value so parseWords reads it back as a single word
+func QuoteWord(word string) string {
+	word = strings.ReplaceAll(word, `\`, `\\`)
+	word = strings.ReplaceAll(word, `"`, `\"`)
+	return `"` + word + `"`
+}
+
 func cleanShellIdentifier(identifier string) string {
-	return regexp.MustCompile(`[^a-zA-Z0-9 ]+`).ReplaceAllString(identifier, "")
+	return regexp.MustCompile(`[^a-zA-Z0-9]+`).ReplaceAllString(identifier, "")
 }
 
 func Check(e error) {
@@ -877,19 +1201,20 @@ func BashAssocNoQuote(assoc map[string]string, indent int) string {
 	return BashAssoc(assoc, indent, false)
 }
 
-// BashAssoc todo: sorted if possible and prettier
+// BashAssoc is an associative array assignment with its keys sorted so the output is reproducible
 func BashAssoc(assoc map[string]string, indent int, quoteKey bool) string {
 	maxLength := 80
 	arrayLines := make([]string, 0)
 	indentStr := strings.Repeat(" ", indent)
-	var quoteStr = ""
-	if quoteKey {
-		quoteStr = "\""
+	keys := make([]string, 0, len(assoc))
+	for key := range assoc {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
 	line := ""
-	for key, value := range assoc {
-		concatStr := "[" + quoteStr + key + quoteStr + "]=\"" + value + "\""
+	for _, key := range keys {
+		concatStr := bashAssocKey(key, quoteKey) + "=" + BashQuote(assoc[key])
 		if len(line) == 0 {
 			line = concatStr
 		} else if len(line)+len(concatStr)+1 > maxLength {
@@ -923,7 +1248,7 @@ func BashArray(values []string, indent int) string {
 
 	line := ""
 	for _, value := range values {
-		concatStr := "\"" + value + "\""
+		concatStr := BashQuote(value)
 		if len(line) == 0 {
 			line = concatStr
 		} else if len(line)+len(concatStr)+1 > maxLength {
@@ -993,13 +1318,30 @@ func Dedent(str string) string {
 	return strings.Join(lines, "\n") + "\n"
 }
 
+// SplitWords splits a line into words the way operations are split, quotes and backslashes group words
+func SplitWords(line string) []string {
+	return parseWords(line)
+}
+
 func parseWords(line string) []string {
+	words, _ := parseWordsColumns(line)
+	return words
+}
+
+// parseWordsColumns splits line into words and the 1-based column each word starts at
+func parseWordsColumns(line string) ([]string, []int) {
 	var escapeNext = false
 	var quoted = false
 	var closeQuote rune
 	var words []string
+	var columns []int
 	var word string
-	for _, r := range line {
+	var wordStart = -1
+	for i, r := range line {
+		if wordStart == -1 && r != ' ' && r != '\t' {
+			wordStart = i
+		}
+
 		if !escapeNext {
 			if quoted && r == closeQuote {
 				quoted = false
@@ -1019,8 +1361,10 @@ func parseWords(line string) []string {
 		if (r == ' ' || r == '\t') && !escapeNext && !quoted {
 			if word != "" {
 				words = append(words, word)
+				columns = append(columns, wordStart+1)
 			}
 			word = ""
+			wordStart = -1
 		} else {
 			word += string(r)
 			escapeNext = false
@@ -1029,34 +1373,8 @@ func parseWords(line string) []string {
 
 	if word != "" {
 		words = append(words, word)
+		columns = append(columns, wordStart+1)
 	}
 
-	return words
-}
-
-func SetupLogger() func() {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		panic(err)
-	}
-	logFile, err := os.OpenFile(path.Join(home, "bashscript.log"), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0664)
-	if err != nil {
-		panic(err)
-	}
-
-	// https://github.com/rs/zerolog/tree/master#pretty-logging
-	output := zerolog.ConsoleWriter{Out: logFile, TimeFormat: "[15:04:05.000]"}
-	output.FormatFieldName = func(i interface{}) string {
-		return fmt.Sprintf("%s:", i)
-	}
-	output.FormatFieldValue = func(i interface{}) string {
-		return strings.ToUpper(fmt.Sprintf("%s", i))
-	}
-
-	zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	log.Logger = log.Output(output)
-
-	return func() {
-		Check(logFile.Close())
-	}
+	return words, columns
 }
@@ -1,11 +1,18 @@
 package lib
 
 import (
+	"fmt"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/suite"
+	"math"
 	"os"
+	"os/exec"
 	"path"
+	"strings"
 	"testing"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 var loggerCleanup func()
@@ -20,7 +27,9 @@ type LibTestSuite struct {
 }
 
 func (suite *LibTestSuite) SetupSuite() {
-	loggerCleanup = SetupLogger()
+	var err error
+	loggerCleanup, err = SetupLogger(false, "")
+	suite.Require().NoError(err)
 	log.Printf("RUNNING TESTS")
 }
 
@@ -81,3 +90,474 @@ func (suite *LibTestSuite) TestParseWords() {
 		})
 	}
 }
+
+func (suite *LibTestSuite) TestParseWordsColumns() {
+	words, columns := parseWordsColumns(`opt   -p="sub cmd" --nargs=2`)
+	suite.Assert().Equal([]string{`opt`, `-p=sub cmd`, `--nargs=2`}, words)
+	suite.Assert().Equal([]int{1, 7, 20}, columns)
+}
+
+func (suite *LibTestSuite) TestQuoteChoices() {
+	choices := []string{"plain", "us east", "it's", `say"hi"`, `a\b`, "tab\tbed"}
+	quoted := QuoteChoices(choices)
+	suite.Assert().Equal(`"plain 'us east' \"it's\" 'say\"hi\"' 'a\\b' 'tab`+"\t"+`bed'"`, quoted)
+	suite.Assert().Equal(`"fast slow"`, QuoteChoices([]string{"fast", "slow"}))
+
+	cli, err := ParseOperations("cfg cli_name=testcli\nopt --opt --choices=" + quoted + "\npos --choices=\"'new york' paris\"")
+	suite.Require().NoError(err)
+	parser := cli.Parsers.parserMap[DefaultParser]
+	suite.Assert().Equal(choices, parser.Optionals[0].Choices)
+	suite.Assert().Equal([]string{"new york", "paris"}, parser.Positionals[0].Choices)
+	suite.Assert().Equal(`plain us\ east it's say"hi" a\\b tab`+"\t"+`bed`, parser.OptionalsData()["__value__,--opt"])
+}
+
+func (suite *LibTestSuite) TestShellQuote() {
+	suite.Assert().Equal("testcli", ZshQuote("testcli"))
+	suite.Assert().Equal(`'my tool'`, ZshQuote("my tool"))
+	suite.Assert().Equal(`'it'\''s'`, ZshQuote("it's"))
+	suite.Assert().Equal(`$'a\u000atouch pwned\'s'`, ZshQuote("a\ntouch pwned's"))
+	suite.Assert().Equal("/tmp/out.fish", FishQuote("/tmp/out.fish"))
+	suite.Assert().Equal(`'my tool'`, FishQuote("my tool"))
+	suite.Assert().Equal(`'it\'s \\ $HOME'`, FishQuote(`it's \ $HOME`))
+	suite.Assert().Equal("mytool", cleanShellIdentifier("my tool"))
+}
+
+func (suite *LibTestSuite) TestFishValueOptions() {
+	cli, err := ParseOperations(Dedent(`
+		cfg cli_name=testcli
+		opt --verbose
+		opt "--tag|-t" --complete=value
+		opt --point --complete=value --nargs=2
+		opt --color --choices="auto never" --value-style=equals
+		psr run
+		opt -p=run "--out" --complete=file
+	`))
+	suite.Require().NoError(err)
+	data := templateData{Cli: cli}
+	suite.Assert().Equal([]string{"--tag", "-t", "--point", "--out"}, data.FishValueOptions())
+	suite.Assert().Equal([]string{"1", "1", "2", "1"}, data.FishValueCounts())
+}
+
+func (suite *LibTestSuite) TestParseErrors() {
+	_, err := ParseOperations(strings.Join([]string{
+		`cfg cli_name=testcli`,
+		`  opts --verbose`,
+		`opt "--key" --nargs={0,0}`,
+		`psr`,
+	}, "\n"))
+
+	var parseErrors ParseErrors
+	suite.Require().ErrorAs(err, &parseErrors)
+	suite.Assert().Equal(ParseErrors{
+		{Line: 2, Column: 3, Op: "opts", Msg: `unknown operation "opts"`},
+		{Line: 3, Column: 13, Op: "opt", Msg: "cannot use 0 for narg max {0,0}"},
+		{Line: 4, Column: 4, Op: "psr", Msg: "missing parser name"},
+	}, parseErrors)
+}
+
+func (suite *LibTestSuite) TestParseCompleteType() {
+	cli, err := ParseOperations(strings.Join([]string{
+		`cfg cli_name=testcli`,
+		`opt --config --complete=file:*.json,*.yaml`,
+		`opt --name --complete=value`,
+		`pos --complete=dir`,
+	}, "\n"))
+	suite.Require().NoError(err)
+	parser := cli.Parsers.parserMap[DefaultParser]
+	suite.Assert().Equal(CompleteTypeFile, parser.Optionals[0].CompleteType)
+	suite.Assert().Equal([]string{"*.json", "*.yaml"}, parser.Optionals[0].Globs)
+	suite.Assert().Equal(CompleteTypeValue, parser.Optionals[1].CompleteType)
+	suite.Assert().Equal(CompleteTypeDir, parser.Positionals[0].CompleteType)
+
+	_, err = ParseOperations(strings.Join([]string{
+		`cfg cli_name=testcli`,
+		`opt --config --complete=path`,
+		`pos --complete=dir:*.d`,
+	}, "\n"))
+	var parseErrors ParseErrors
+	suite.Require().ErrorAs(err, &parseErrors)
+	suite.Assert().Equal(ParseErrors{
+		{Line: 2, Column: 14, Op: "opt", Msg: `unknown complete type "path", expected file, dir or value`},
+		{Line: 3, Column: 5, Op: "pos", Msg: "glob filters are only supported for file completion"},
+	}, parseErrors)
+}
+
+func (suite *LibTestSuite) TestParseValueStyle() {
+	_, err := ParseOperations(strings.Join([]string{
+		`cfg cli_name=testcli`,
+		`opt --color --choices="auto never" --value-style=colon`,
+	}, "\n"))
+	var parseErrors ParseErrors
+	suite.Require().ErrorAs(err, &parseErrors)
+	suite.Assert().Equal(ParseErrors{
+		{Line: 2, Column: 36, Op: "opt", Msg: `unknown value style "colon", expected equals, space or both`},
+	}, parseErrors)
+}
+
+func (suite *LibTestSuite) TestParseGroups() {
+	cli, err := ParseOperations(strings.Join([]string{
+		`cfg cli_name=testcli`,
+		`grp flavor --exclusive`,
+		`opt --vanilla --group=flavor`,
+		`opt --chocolate|-c --group=flavor`,
+	}, "\n"))
+	suite.Require().NoError(err)
+	parser := cli.Parsers.parserMap[DefaultParser]
+	suite.Assert().Equal([]CliGroup{{Name: "flavor", Exclusive: true, Members: []string{"--vanilla", "--chocolate"}}}, parser.Groups)
+	suite.Assert().Equal([]string{"--chocolate", "--vanilla"}, parser.conflicts("-c"))
+
+	_, err = ParseOperations(strings.Join([]string{
+		`cfg cli_name=testcli`,
+		`grp`,
+		`opt --vanilla --group=flavor`,
+		`grp -p=sub size`,
+		`grp -p=sub size`,
+	}, "\n"))
+	var parseErrors ParseErrors
+	suite.Require().ErrorAs(err, &parseErrors)
+	suite.Assert().Equal(ParseErrors{
+		{Line: 2, Column: 4, Op: "grp", Msg: "missing group name"},
+		{Line: 3, Column: 15, Op: "opt", Msg: `unknown group "flavor", groups must be added with grp first`},
+		{Line: 5, Column: 12, Op: "grp", Msg: `group "size" already exists`},
+	}, parseErrors)
+}
+
+func (suite *LibTestSuite) TestNewCli() {
+	cli := NewCli("")
+	suite.Require().NoError(cli.SetConfig("cli_name", "testcli"))
+	suite.Require().NoError(cli.AddGroup(DefaultParser, CliGroup{Name: "flavor", Exclusive: true}))
+	suite.Require().NoError(cli.AddOptional(CliOptional{
+		Name:               "--mode",
+		CompleteType:       CompleteTypeChoices,
+		Choices:            []string{"fast", "slow"},
+		ChoiceDescriptions: map[string]string{"slow": `run "every" check`},
+		ValueStyle:         ValueStyleEquals,
+		Group:              "flavor",
+		NArgs:              CliNargs{Min: 1, Max: 3, IsSet: true, NoSpace: true},
+	}))
+	suite.Require().NoError(cli.AddParser(DefaultParser, "run", "run a task"))
+	suite.Require().NoError(cli.AddPositional(CliPositional{
+		Parser:       "run",
+		CompleteType: CompleteTypeFile,
+		Globs:        []string{"*.go"},
+		NArgs:        CliNargs{Min: 1, Max: math.Inf(+1), IsSet: true, Unique: true},
+	}))
+	suite.Assert().Equal([]string{
+		`cfg cli_name="testcli"`,
+		`grp "flavor" --exclusive`,
+		`opt "--mode" --choices="fast slow" --desc="slow=run \"every\" check" --nargs="{1,3}" --nargs-nospace --value-style="equals" --group="flavor"`,
+		`psr "run" --help="run a task"`,
+		`pos -p="run" --complete="file:*.go" --nargs="+" --nargs-unique`,
+	}, cli.Operations)
+
+	parsed, err := ParseOperations(strings.Join(cli.Operations, "\n"))
+	suite.Require().NoError(err)
+	suite.Assert().Equal(parsed, cli)
+
+	suite.Assert().EqualError(cli.AddOptional(CliOptional{Name: "--vanilla", Group: "size"}), `unknown group "size", groups must be added with grp first`)
+	suite.Assert().EqualError(cli.AddOptional(CliOptional{Name: "--tag", CompleteType: "path"}), `unknown complete type "path", expected file, dir or value`)
+	suite.Assert().EqualError(cli.AddPositional(CliPositional{Parser: "run"}), "cannot have a positional come after a indeterminant narg positional")
+}
+
+func (suite *LibTestSuite) TestParseAutogenHelp() {
+	cli, err := ParseOperations(strings.Join([]string{
+		`cfg cli_name=testcli`,
+		`cfg autogen_help_cmd="tool --help"`,
+	}, "\n"))
+	suite.Require().NoError(err)
+	suite.Assert().Equal("tool --help", cli.Config.AutogenHelpCmd)
+	suite.Assert().Equal(1, cli.Config.AutogenHelpDepth)
+	suite.Assert().Equal([]string{"tool", "sub command", "--help"}, SplitWords(`tool "sub command" --help`))
+
+	_, err = ParseOperations(strings.Join([]string{
+		`cfg cli_name=testcli`,
+		`cfg autogen_help_depth=deep`,
+	}, "\n"))
+	var parseErrors ParseErrors
+	suite.Require().ErrorAs(err, &parseErrors)
+	suite.Assert().Equal(ParseErrors{
+		{Line: 2, Column: 5, Op: "cfg", Msg: `invalid autogen_help_depth "deep", expected a number`},
+	}, parseErrors)
+}
+
+func (suite *LibTestSuite) TestParseLogLevel() {
+	cli, err := ParseOperations("cfg cli_name=testcli\ncfg log_level=info")
+	suite.Require().NoError(err)
+	suite.Assert().Equal("info", cli.Config.LogLevel)
+
+	_, err = ParseOperations("cfg cli_name=testcli\ncfg log_level=loud")
+	var parseErrors ParseErrors
+	suite.Require().ErrorAs(err, &parseErrors)
+	suite.Assert().Equal(ParseErrors{
+		{Line: 2, Column: 5, Op: "cfg", Msg: `invalid log_level "loud", expected one of trace, debug, info, warn, error`},
+	}, parseErrors)
+}
+
+func (suite *LibTestSuite) TestReloadTrigger() {
+	main := suite.CreateFile("main.py", "import cmd\n")
+	suite.CreateFile("cmd.py", "parser = None\n")
+	suite.Require().NoError(os.MkdirAll(path.Join(suite.tmpdir, "sub", "__pycache__"), 0755))
+	suite.CreateFile("sub/args.py", "args = []\n")
+	suite.CreateFile("sub/__pycache__/args.pyc", "bytecode")
+	suite.CreateFile("sub/README.md", "docs")
+
+	files, _, err := reloadTriggerFiles(path.Join(suite.tmpdir, "**", "*.py"))
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{
+		path.Join(suite.tmpdir, "cmd.py"),
+		path.Join(suite.tmpdir, "main.py"),
+		path.Join(suite.tmpdir, "sub", "args.py"),
+	}, files)
+	files, _, err = reloadTriggerFiles(path.Join(suite.tmpdir, "sub"))
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{path.Join(suite.tmpdir, "sub", "README.md"), path.Join(suite.tmpdir, "sub", "args.py")}, files)
+	_, _, err = reloadTriggerFiles(path.Join(suite.tmpdir, "**", "*.js"))
+	suite.Assert().EqualError(err, "reload trigger "+path.Join(suite.tmpdir, "**", "*.js")+" matches no files")
+
+	trigger, err := NewReloadTrigger(path.Join(suite.tmpdir, "**", "*.py"))
+	suite.Require().NoError(err)
+	changed, err := trigger.Changed()
+	suite.Require().NoError(err)
+	suite.Assert().False(changed)
+
+	// a touch changes the modification time but not what the files say
+	later := time.Now().Add(time.Hour)
+	suite.Require().NoError(os.Chtimes(main, later, later))
+	changed, err = trigger.Changed()
+	suite.Require().NoError(err)
+	suite.Assert().False(changed, "touched")
+
+	suite.CreateFile("sub/args.py", "args = [1]\n")
+	changed, err = trigger.Changed()
+	suite.Require().NoError(err)
+	suite.Assert().True(changed, "edited")
+
+	// an edit in the same tick as the read keeps the size and modification time, racy triggers are hashed
+	suite.Require().NoError(os.WriteFile(main, []byte("import cli\n"), 0644))
+	suite.Require().NoError(os.Chtimes(main, later, later))
+	trigger, err = NewReloadTrigger(main)
+	suite.Require().NoError(err)
+	suite.Assert().True(trigger.Racy)
+	suite.Require().NoError(os.WriteFile(main, []byte("import cmd\n"), 0644))
+	suite.Require().NoError(os.Chtimes(main, later, later))
+	changed, err = trigger.Changed()
+	suite.Require().NoError(err)
+	suite.Assert().True(changed, "same size and time")
+
+	// files that were last modified well before they were read aren't racy
+	earlier := time.Now().Add(-time.Hour)
+	suite.Require().NoError(os.Chtimes(main, earlier, earlier))
+	trigger, err = NewReloadTrigger(main)
+	suite.Require().NoError(err)
+	suite.Assert().False(trigger.Racy)
+	changed, err = trigger.Changed()
+	suite.Require().NoError(err)
+	suite.Assert().False(changed)
+}
+
+func (suite *LibTestSuite) TestParseReloadTrigger() {
+	trigger := suite.CreateFile("cmd.py", "parser = None\n")
+	cli, err := ParseOperations("cfg cli_name=testcli\ncfg autogen_reload_trigger=" + trigger)
+	suite.Require().NoError(err)
+	suite.Require().Len(cli.Config.AutogenReloadTriggers, 1)
+	stored := cli.Config.AutogenReloadTriggers[0]
+	suite.Assert().Equal(int64(14), stored.Size)
+	suite.Assert().Len(stored.Hash, 64)
+	suite.Assert().Equal([]string{
+		"cfg autogen_reload_trigger=" + trigger,
+		fmt.Sprintf("int autogen_reload_trigger_ts=%d", stored.Timestamp),
+		"int autogen_reload_trigger_size=14",
+		"int autogen_reload_trigger_hash=" + stored.Hash,
+		"int autogen_reload_trigger_racy=1",
+	}, cli.OperationsReloadConfig()[1:])
+
+	// the stored state is read back instead of the current one
+	reparsed, err := ParseOperations(strings.Join(cli.Operations, "\n"))
+	suite.Require().NoError(err)
+	suite.Assert().Equal(stored, reparsed.Config.AutogenReloadTriggers[0])
+	old, err := ParseOperations(strings.Join([]string{
+		"cfg cli_name=testcli",
+		"cfg autogen_reload_trigger=" + trigger,
+		"int autogen_reload_trigger_ts=1000",
+	}, "\n"))
+	suite.Require().NoError(err)
+	suite.Assert().Equal(ReloadTrigger{File: trigger, Timestamp: 1000}, old.Config.AutogenReloadTriggers[0])
+}
+
+func (suite *LibTestSuite) TestBashQuote() {
+	tests := []struct {
+		value  string
+		expect string
+	}{
+		{"plain", `"plain"`},
+		{"", `""`},
+		{"it's", `"it's"`},
+		{`say "hi"`, `'say "hi"'`},
+		{"$HOME", `'$HOME'`},
+		{"`id`", "'`id`'"},
+		{`a\b`, `'a\b'`},
+		{`'$'`, `''\''$'\'''`},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.value, func() {
+			suite.Assert().Equal(tt.expect, BashQuote(tt.value))
+		})
+	}
+
+	suite.Assert().Equal(`([run,remote]="run")`, BashAssocNoQuote(map[string]string{"run,remote": "run"}, 2))
+	suite.Assert().Equal(`(['$(id)']='$x')`, BashAssocNoQuote(map[string]string{"$(id)": "$x"}, 2))
+	suite.Assert().Equal(`(["--opt"]="1")`, BashAssocQuote(map[string]string{"--opt": "1"}, 2))
+	suite.Assert().Equal("# cfg a=1\n# opt --x --help=\"a\\nb\"", BashComment([]string{"cfg a=1", "opt --x --help=\"a\nb\""}))
+}
+
+// FuzzCompleteChoices compiles a value into a script as a choice, the cli name, a closure name and an
+// include_source path. Bash has to complete exactly the choice, zsh and fish have to source the script, and no
+// shell may run anything from the value
+func FuzzCompleteChoices(f *testing.F) {
+	for _, seed := range []string{"plain", `say"hi"`, `"open`, "$HOME", "$(touch pwned)", "`touch pwned`", `back\slash`, "it's", "'; touch pwned; '", "*", "-dash", `ü$'\'`, "two words", "tab\there", "{a,b}", "(x)"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		// operations are lines, shell strings can't hold NUL and file names are limited
+		if value == "" || !utf8.ValidString(value) || strings.ContainsAny(value, "\x00\n\r") || len(value) > 100 {
+			t.Skip()
+		}
+		dir := t.TempDir()
+		cliName := "testcli" + value
+		source := path.Join(dir, "source"+strings.ReplaceAll(value, "/", "_"))
+		operations := strings.Join([]string{
+			"cfg cli_name=" + QuoteWord(cliName),
+			"cfg include_source=" + QuoteWord(source),
+			"opt --opt --choices=" + QuoteChoices([]string{value}),
+			"opt --run --closure=" + QuoteWord("__fuzz"+value),
+			"opt --src --closure=__fuzz_sourced",
+			"pos --choices=" + QuoteChoices([]string{value}),
+		}, "\n")
+
+		installed := func(shell string) bool {
+			_, err := exec.LookPath(shell)
+			return err == nil
+		}
+		run := func(shell string, sourceContent string, script string, args ...string) string {
+			t.Helper()
+			cli, err := ParseOperations(operations + "\ncfg shell=" + shell)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compiled, err := CompileCli(cli)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file := path.Join(dir, "testcli."+shell)
+			if err = os.WriteFile(file, []byte(compiled), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err = os.WriteFile(source, []byte(sourceContent), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cmd := exec.Command(shell, append([]string{"-c", script, shell, file}, args...)...)
+			cmd.Dir = dir
+			var stderr strings.Builder
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("%s: %v: %s", shell, err, stderr.String())
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+				t.Fatalf("%s ran %q", shell, value)
+			}
+			return string(out)
+		}
+
+		if !installed(ShellBash) {
+			t.Skip("bash not found")
+		}
+		bashSource := "__fuzz_sourced () { COMPREPLY=(sourced); }\n"
+		out := run(ShellBash, bashSource, `
+			source "$1"
+			compopt () { :; }
+			complete -p -- "$2" >/dev/null || exit 1
+			complete_function="__shcomp2_v2_autocomplete_$3"
+			complete_line () {
+				COMP_LINE="$1" COMP_POINT="${#1}"
+				COMPREPLY=()
+				"$complete_function" 2>/dev/null
+				printf '%s\0' "${COMPREPLY[@]}"
+				printf '\n'
+			}
+			complete_line "testcli "
+			complete_line "testcli --opt "
+			complete_line "testcli --src "
+			complete_line "testcli --run "
+		`, cliName, cleanShellIdentifier(cliName))
+		// choices with whitespace are completed escaped so readline inserts them as one word
+		choice := value
+		if strings.IndexFunc(value, unicode.IsSpace) != -1 {
+			quoted, err := exec.Command("bash", "-c", `printf '%q' "$1"`, "bash", value).Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			choice = string(quoted)
+		}
+		expect := choice + "\x00--opt\x00--run\x00--src\x00\n" + choice + "\x00\n" + "sourced\x00\n" + "\x00\n"
+		if out != expect {
+			t.Fatalf("completed %q, expected %q", out, expect)
+		}
+
+		if installed(ShellZsh) {
+			out = run(ShellZsh, bashSource, `
+				compdef () { print -r -- "${@[-1]}"; }
+				source "$1"
+				IFS= read -r line < "$1"
+				print -r -- "${(Q)${(z)line#\#compdef }}"
+			`)
+			if expect = cliName + "\n" + cliName + "\n"; out != expect {
+				t.Fatalf("zsh registered %q, expected %q", out, expect)
+			}
+		}
+
+		if installed(ShellFish) {
+			out = run(ShellFish, "function __fuzz_sourced\n    echo sourced\nend\n", `
+				source $argv[1]
+				functions -q __fuzz_sourced; or exit 1
+				complete -c $argv[2] | count
+			`, cliName)
+			if out == "0\n" {
+				t.Fatalf("fish didn't register completions for %q", cliName)
+			}
+		}
+	})
+}
+
+func (suite *LibTestSuite) TestCompileReproducible() {
+	operations := []string{"cfg cli_name=testcli"}
+	for i := 0; i < 20; i++ {
+		operations = append(operations,
+			fmt.Sprintf(`opt --opt-%d --choices="a b" --desc=a="choice %d" --help="option %d"`, i, i, i),
+			fmt.Sprintf(`psr sub-%d --help="subcommand %d"`, i, i),
+		)
+	}
+	suite.T().Setenv("SOURCE_DATE_EPOCH", "")
+	for _, shell := range Shells() {
+		suite.Run(shell, func() {
+			cli, err := ParseOperations(strings.Join(append(operations, "cfg shell="+shell), "\n"))
+			suite.Require().NoError(err)
+			first, err := CompileCli(cli)
+			suite.Require().NoError(err)
+			second, err := CompileCli(cli)
+			suite.Require().NoError(err)
+			suite.Require().Equal(first, second)
+			suite.Assert().NotContains(first, "last_modified_ms")
+		})
+	}
+
+	cli, err := ParseOperations(strings.Join(operations, "\n"))
+	suite.Require().NoError(err)
+	suite.T().Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	compiled, err := CompileCli(cli)
+	suite.Require().NoError(err)
+	suite.Assert().Contains(compiled, "\n# last_modified_ms: 1700000000000\n")
+	suite.T().Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	_, err = CompileCli(cli)
+	suite.Assert().EqualError(err, `invalid SOURCE_DATE_EPOCH "yesterday", expected seconds since the epoch`)
+}
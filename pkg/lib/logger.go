@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LogLevels are the levels -log-level and cfg log_level accept
+var LogLevels = []string{"trace", "debug", "info", "warn", "error"}
+
+// ValidLogLevel is true for one of LogLevels
+func ValidLogLevel(level string) bool {
+	for _, valid := range LogLevels {
+		if level == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// LogFile is where debug logs go, $XDG_STATE_HOME/shcomp2/shcomp2.log or ~/.local/state when it isn't set
+func LogFile() (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "shcomp2", "shcomp2.log"), nil
+}
+
+// SetupLogger logs warnings and errors to stderr. In debug mode everything from level up is appended to
+// LogFile instead, without it nothing under $HOME is opened
+func SetupLogger(debug bool, level string) (func(), error) {
+	if !debug {
+		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+		log.Logger = log.Output(zerolog.ConsoleWriter{
+			Out:          os.Stderr,
+			NoColor:      true,
+			PartsExclude: []string{zerolog.TimestampFieldName},
+		})
+		return func() {}, nil
+	}
+
+	if !ValidLogLevel(level) {
+		return nil, fmt.Errorf("invalid log level %q, expected one of %s", level, strings.Join(LogLevels, ", "))
+	}
+	parsedLevel, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	file, err := LogFile()
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	logFile, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0664)
+	if err != nil {
+		return nil, err
+	}
+
+	zerolog.SetGlobalLevel(parsedLevel)
+	log.Logger = log.Output(debugOutput(logFile))
+	return func() {
+		Check(logFile.Close())
+	}, nil
+}
+
+// debugOutput is zerolog's pretty logging https://github.com/rs/zerolog/tree/master#pretty-logging
+func debugOutput(out io.Writer) zerolog.ConsoleWriter {
+	output := zerolog.ConsoleWriter{Out: out, NoColor: true, TimeFormat: "[15:04:05.000]"}
+	output.FormatFieldName = func(i interface{}) string {
+		return fmt.Sprintf("%s:", i)
+	}
+	output.FormatFieldValue = func(i interface{}) string {
+		return strings.ToUpper(fmt.Sprintf("%s", i))
+	}
+	return output
+}
@@ -0,0 +1,81 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// bashPlainWord is a key that bash reads literally without quotes
+var bashPlainWord = regexp.MustCompile(`^[A-Za-z0-9_.,:+@%/-]+$`)
+
+// shellPlainWord is a word that bash, zsh and fish all read literally without quotes
+var shellPlainWord = regexp.MustCompile(`^[A-Za-z0-9_.,:+@/-]+$`)
+
+// bashReadEscaper escapes the spaces `IFS=' ' read -a` splits on and the backslashes it reads as escapes
+var bashReadEscaper = strings.NewReplacer(`\`, `\\`, " ", `\ `)
+
+// BashQuote quotes value as one bash word that expands to exactly value. Values without characters
+// that are special inside double quotes keep the double quotes scripts always used, others are single
+// quoted where nothing is special and a single quote is closed, escaped and reopened.
+// Bash strings can't hold NUL so those are dropped. \x01 and \x7f are bash's own escape markers, in
+// double quotes of a `local -a` assignment they come out with an extra \x01
+func BashQuote(value string) string {
+	value = strings.ReplaceAll(value, "\x00", "")
+	if !strings.ContainsAny(value, "\"$`\\\x01\x7f") {
+		return `"` + value + `"`
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// ZshQuote quotes value as one zsh word, plain words stay as they are. Values with line breaks or other
+// control characters use zsh's dollar quotes with escapes so they stay on one line, like the name after #compdef
+func ZshQuote(value string) string {
+	if shellPlainWord.MatchString(value) {
+		return value
+	}
+	if strings.IndexFunc(value, unicode.IsControl) == -1 {
+		return zshSingleQuote(value)
+	}
+	var quoted strings.Builder
+	quoted.WriteString("$'")
+	for _, r := range value {
+		switch {
+		case r == '\\' || r == '\'':
+			quoted.WriteString(`\` + string(r))
+		case unicode.IsControl(r):
+			_, _ = fmt.Fprintf(&quoted, `\u%04x`, r)
+		default:
+			quoted.WriteRune(r)
+		}
+	}
+	quoted.WriteString("'")
+	return quoted.String()
+}
+
+// FishQuote quotes value as one fish word, plain words stay as they are
+func FishQuote(value string) string {
+	if shellPlainWord.MatchString(value) {
+		return value
+	}
+	return fishQuote(value)
+}
+
+// bashAssocKey is the [key] of an associative array entry, plain keys stay unquoted when quote is false
+func bashAssocKey(key string, quote bool) string {
+	if !quote && bashPlainWord.MatchString(key) {
+		return "[" + key + "]"
+	}
+	return "[" + BashQuote(key) + "]"
+}
+
+// BashComment comments out lines, line breaks inside a line are shown escaped so they can't end the comment
+func BashComment(lines []string) string {
+	escaper := strings.NewReplacer("\n", `\n`, "\r", `\r`)
+	commented := make([]string, len(lines))
+	for i, line := range lines {
+		commented[i] = "# " + escaper.Replace(line)
+	}
+	return strings.Join(commented, "\n")
+}
@@ -0,0 +1,297 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReloadTrigger is a file, a directory or a glob like src/**/*.py whose changes regenerate the script.
+// Timestamp and Size are the newest modification and total size of its files, they are checked first
+// and Hash of the names and contents when they differ so a touch or checkout doesn't regenerate.
+// Racy triggers were modified within reloadRacyWindow of being read, an edit right after could keep
+// the same time and size so their hash is always compared
+type ReloadTrigger struct {
+	File      string `json:"file"`
+	Timestamp int64  `json:"timestamp"`
+	Size      int64  `json:"size"`
+	Hash      string `json:"hash,omitempty"`
+	Racy      bool   `json:"racy,omitempty"`
+}
+
+// reloadRacyWindow is the coarsest modification time granularity of common filesystems, FAT's 2 seconds
+const reloadRacyWindow = 2 * time.Second
+
+func (r ReloadTrigger) String() string {
+	return r.File
+}
+
+// reloadTriggerOps are the int operations that store the state of a trigger after its cfg operation
+func (r ReloadTrigger) reloadTriggerOps() []string {
+	ops := []string{
+		fmt.Sprintf("int autogen_reload_trigger_ts=%d", r.Timestamp),
+		fmt.Sprintf("int autogen_reload_trigger_size=%d", r.Size),
+	}
+	if r.Hash != "" {
+		ops = append(ops, "int autogen_reload_trigger_hash="+r.Hash)
+	}
+	if r.Racy {
+		ops = append(ops, "int autogen_reload_trigger_racy=1")
+	}
+	return ops
+}
+
+// NewReloadTrigger reads the current state of the files matching pattern
+func NewReloadTrigger(pattern string) (ReloadTrigger, error) {
+	trigger := ReloadTrigger{File: pattern}
+	files, dirs, err := reloadTriggerFiles(pattern)
+	if err != nil {
+		return trigger, err
+	}
+	if trigger.Timestamp, trigger.Size, err = statFiles(append(dirs, files...)); err != nil {
+		return trigger, err
+	}
+	if trigger.Hash, err = hashFiles(files); err != nil {
+		return trigger, err
+	}
+	trigger.Racy = isRacy(time.UnixMilli(trigger.Timestamp))
+	return trigger, nil
+}
+
+// Changed compares the files of the trigger with its stored state, the hash is read when the modification
+// time or size differ or the trigger was racy. Triggers from scripts without a hash change with their timestamp
+func (r ReloadTrigger) Changed() (bool, error) {
+	files, dirs, err := reloadTriggerFiles(r.File)
+	if err != nil {
+		return false, err
+	}
+	timestamp, size, err := statFiles(append(dirs, files...))
+	if err != nil {
+		return false, err
+	}
+	unchanged := timestamp == r.Timestamp && size == r.Size
+	if unchanged && !r.Racy {
+		return false, nil
+	}
+	if r.Hash == "" {
+		return !unchanged, nil
+	}
+	hash, err := hashFiles(files)
+	if err != nil {
+		return false, err
+	}
+	return hash != r.Hash, nil
+}
+
+// ReloadStamp is the file next to the outfile whose modification time is the newest of the trigger paths
+// when they were last checked. It's hidden so completion directories don't source it
+func (c Cli) ReloadStamp() string {
+	if c.Config.Outfile == "" {
+		return ""
+	}
+	dir, name := filepath.Split(c.Config.Outfile)
+	return filepath.Join(dir, "."+name+".stamp")
+}
+
+// ReloadPaths are the files and directories of every trigger. The script compares them to the stamp
+// with `-nt` and only runs the reload check when one is newer, a new or removed file changes its directory
+func (c Cli) ReloadPaths() []string {
+	var paths []string
+	for _, trigger := range c.Config.AutogenReloadTriggers {
+		files, dirs, err := reloadTriggerFiles(trigger.File)
+		if err != nil {
+			continue
+		}
+		paths = append(paths, dirs...)
+		paths = append(paths, files...)
+	}
+	return paths
+}
+
+// WriteReloadStamp sets the modification time of the stamp to the newest trigger path, not the current
+// time, so an edit made while the reload check runs is still newer. While the newest path is racy the stamp
+// is set a window earlier so the script keeps checking, an edit in the same tick doesn't move the time
+func WriteReloadStamp(cli Cli) error {
+	stamp := cli.ReloadStamp()
+	if stamp == "" {
+		return nil
+	}
+	var newest time.Time
+	for _, path := range cli.ReloadPaths() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	if newest.IsZero() {
+		return nil
+	}
+	if isRacy(newest) {
+		newest = newest.Add(-reloadRacyWindow)
+	}
+	if _, err := os.Stat(stamp); err != nil {
+		if err = os.WriteFile(stamp, nil, 0644); err != nil {
+			return err
+		}
+	}
+	return os.Chtimes(stamp, newest, newest)
+}
+
+// isRacy is true for a modification time that an edit made now could still share
+func isRacy(modified time.Time) bool {
+	return modified.After(time.Now().Add(-reloadRacyWindow))
+}
+
+// reloadTriggerFiles are the files of a trigger in a stable order. A directory is every file below it
+// without hidden files and __pycache__, a glob matches with ** spanning directories. The directories
+// walked are returned too, adding, removing or renaming a file changes their modification time
+func reloadTriggerFiles(pattern string) ([]string, []string, error) {
+	if !hasGlobMeta(pattern) {
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reload trigger file not found %s", pattern)
+		}
+		if !info.IsDir() {
+			return []string{pattern}, nil, nil
+		}
+		return walkFiles(pattern, func(string) bool { return true })
+	}
+
+	root, rest := globRoot(pattern)
+	if _, err := os.Stat(root); err != nil {
+		return nil, nil, fmt.Errorf("reload trigger %s matches no files", pattern)
+	}
+	segments := strings.Split(rest, "/")
+	files, dirs, err := walkFiles(root, func(relative string) bool {
+		return matchGlob(segments, strings.Split(filepath.ToSlash(relative), "/"))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("reload trigger %s matches no files", pattern)
+	}
+	return files, dirs, nil
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// globRoot splits a glob into the directory before the first pattern and the pattern relative to it
+func globRoot(pattern string) (string, string) {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	for i, segment := range segments {
+		if hasGlobMeta(segment) {
+			root := strings.Join(segments[:i], "/")
+			if root == "" && i > 0 {
+				root = "/"
+			} else if root == "" {
+				root = "."
+			}
+			return filepath.FromSlash(root), strings.Join(segments[i:], "/")
+		}
+	}
+	return pattern, ""
+}
+
+// matchGlob matches path segments against pattern segments, ** matches any number of directories
+func matchGlob(pattern []string, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchGlob(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	if matched, err := filepath.Match(pattern[0], path[0]); err != nil || !matched {
+		return false
+	}
+	return matchGlob(pattern[1:], path[1:])
+}
+
+// walkFiles lists the files below root that match and the directories walked, skipping hidden entries
+// and python's bytecode caches
+func walkFiles(root string, match func(relative string) bool) ([]string, []string, error) {
+	var files, dirs []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if path != root && (strings.HasPrefix(name, ".") || name == "__pycache__") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if match(relative) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, dirs, err
+}
+
+// statFiles is the newest modification time in milliseconds and the total size of the files in paths
+func statFiles(paths []string) (int64, int64, error) {
+	var timestamp, size int64
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, 0, err
+		}
+		if modified := info.ModTime().UnixMilli(); modified > timestamp {
+			timestamp = modified
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+	}
+	return timestamp, size, nil
+}
+
+// hashFiles is a sha256 of the names and contents of files, a renamed file changes it too
+func hashFiles(files []string) (string, error) {
+	hasher := sha256.New()
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		_, _ = fmt.Fprintf(hasher, "%s\x00", file)
+		_, err = io.Copy(hasher, f)
+		_ = f.Close()
+		if err != nil {
+			return "", err
+		}
+		_, _ = hasher.Write([]byte{0})
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,215 @@
+package lib
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strings"
+)
+
+//go:embed complete-template.go.zsh
+var completeTemplateZsh string
+
+type zshSubparser struct {
+	Name      string
+	NameClean string
+}
+
+// ZshArguments are the _arguments specs for a parser, already quoted for zsh
+func (d templateData) ZshArguments(parser CliParser) []string {
+	var specs []string
+
+	alternativeNames := map[string]bool{}
+	for _, optional := range parser.Optionals {
+		for _, alt := range optional.Alternatives {
+			alternativeNames[alt] = true
+		}
+	}
+
+	for _, optional := range parser.Optionals {
+		if alternativeNames[optional.Name] {
+			continue
+		}
+
+		names := append([]string{optional.Name}, optional.Alternatives...)
+
+		repeat := ""
+		if optional.NArgs.Max > 1 {
+			repeat = "*"
+		}
+
+		exclusions := ""
+		if conflicts := parser.conflicts(optional.Name); len(conflicts) > 0 {
+			if repeat == "" {
+				conflicts = append([]string{optional.Name}, conflicts...)
+			}
+			exclusions = "(" + strings.Join(conflicts, " ") + ")"
+		}
+
+		description := ""
+		if optional.Help != "" {
+			description = "[" + zshEscapeSpec(optional.Help) + "]"
+		}
+
+		value := ""
+		if action := d.zshAction(optional.CompleteType, optional.Choices, optional.ChoiceDescriptions, optional.ClosureName, optional.Globs, false); action != "" {
+			value = ":" + zshEscapeSpec(strings.TrimLeft(optional.Name, "-")) + ":" + action
+		}
+
+		for _, name := range names {
+			specs = append(specs, zshSingleQuote(exclusions+repeat+name+zshValueStyle(name, optional.ValueStyle, value)+description+value))
+		}
+	}
+
+	if len(parser.Subparsers) > 0 {
+		// subparsers are always the first and only positional
+		specs = append(specs, zshSingleQuote("1: :->subparsers"))
+		specs = append(specs, zshSingleQuote("*:: :->subparser_args"))
+		return specs
+	}
+
+	for _, pos := range parser.Positionals {
+		action := d.zshAction(pos.CompleteType, pos.Choices, pos.ChoiceDescriptions, pos.ClosureName, pos.Globs, pos.NArgs.Unique)
+		if action == "" {
+			action = " "
+		}
+		message := " "
+		if pos.Help != "" {
+			message = zshEscapeSpec(pos.Help)
+		}
+		if pos.NArgs.Max == math.Inf(+1) {
+			specs = append(specs, zshSingleQuote("*:"+message+":"+action))
+		} else if pos.NArgs.IsSet {
+			for i := 0; i < int(pos.NArgs.Max); i++ {
+				optional := ""
+				if float64(i) >= pos.NArgs.Min {
+					optional = ":"
+				}
+				specs = append(specs, zshSingleQuote(fmt.Sprintf("%d:%s%s:%s", pos.Number+i, optional, message, action)))
+			}
+		} else {
+			specs = append(specs, zshSingleQuote(fmt.Sprintf("%d:%s:%s", pos.Number, message, action)))
+		}
+	}
+
+	return specs
+}
+
+func (d templateData) ZshJoinArguments(specs []string, indent int) string {
+	return strings.Join(specs, " \\\n"+strings.Repeat(" ", indent))
+}
+
+// ZshSubparsers are the subparsers of parser that have their own completion function
+func (d templateData) ZshSubparsers(parser CliParser) []zshSubparser {
+	var subparsers []zshSubparser
+	for _, name := range parser.Subparsers {
+		fqn := CliParserName(name)
+		if parser.Name != DefaultParser {
+			fqn = parser.Name + "." + fqn
+		}
+		if _, ok := d.Cli.Parsers.parserMap[fqn]; ok {
+			subparsers = append(subparsers, zshSubparser{
+				Name:      name,
+				NameClean: cleanShellIdentifier(string(fqn)),
+			})
+		}
+	}
+	return subparsers
+}
+
+func (d templateData) ZshSubparserChoices(parser CliParser) string {
+	choices := make([]string, len(parser.Subparsers))
+	for i, name := range parser.Subparsers {
+		choice := strings.ReplaceAll(name, ":", `\:`)
+		if help := d.subparserHelp(parser, name); help != "" {
+			choice += ":" + help
+		}
+		choices[i] = zshSingleQuote(choice)
+	}
+	return "(" + strings.Join(choices, " ") + ")"
+}
+
+func (d templateData) ZshIncludeSources() string {
+	sources := make([]string, len(d.Cli.Config.IncludeSources))
+	for i, source := range d.Cli.Config.IncludeSources {
+		sources[i] = zshSingleQuote(source)
+	}
+	return "(" + strings.Join(sources, " ") + ")"
+}
+
+func (d templateData) zshAction(completeType string, choices []string, descriptions map[string]string, closureName string, globs []string, unique bool) string {
+	switch completeType {
+	case CompleteTypeChoices:
+		escaped := make([]string, len(choices))
+		for i, choice := range choices {
+			escaped[i] = zshEscapeSpec(choice)
+		}
+		if unique {
+			return fmt.Sprintf("__shcomp2_v2_zsh_%s_unique %s", d.Cli.CliNameClean(), strings.Join(escaped, " "))
+		}
+		if len(descriptions) > 0 {
+			// ((value\:description ...)) shows the descriptions next to the values
+			for i, choice := range choices {
+				if description, ok := descriptions[choice]; ok {
+					escaped[i] += `\:` + zshEscapeSpec(description)
+				}
+			}
+			return "((" + strings.Join(escaped, " ") + "))"
+		}
+		return "(" + strings.Join(escaped, " ") + ")"
+	case CompleteTypeClosure:
+		return fmt.Sprintf("__shcomp2_v2_zsh_%s_bridge %s", d.Cli.CliNameClean(), zshEscapeSpec(closureName))
+	case CompleteTypeDir:
+		return "_files -/"
+	case CompleteTypeFile:
+		if len(globs) == 0 {
+			return "_files"
+		}
+		escaped := make([]string, len(globs))
+		for i, glob := range globs {
+			escaped[i] = strings.ReplaceAll(glob, ":", `\:`)
+		}
+		return `_files -g "(` + strings.Join(escaped, "|") + `)"`
+	case CompleteTypeValue:
+		// an empty action still makes _arguments expect the value
+		return " "
+	}
+	return ""
+}
+
+// zshValueStyle is the _arguments suffix for how an option takes its value: = allows --opt=value and
+// --opt value, =- only allows --opt=value. Long options allow both unless told otherwise
+func zshValueStyle(name string, valueStyle string, value string) string {
+	if value == "" {
+		return ""
+	}
+	switch valueStyle {
+	case ValueStyleEquals:
+		return "=-"
+	case ValueStyleBoth:
+		return "="
+	case ValueStyleSpace:
+		return ""
+	}
+	if strings.HasPrefix(name, "--") {
+		return "="
+	}
+	return ""
+}
+
+// zshEscapeSpec escapes characters _arguments treats specially inside a spec
+func zshEscapeSpec(str string) string {
+	var escaped strings.Builder
+	for _, r := range str {
+		switch r {
+		case '\\', ':', '[', ']', '(', ')', ' ':
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+func zshSingleQuote(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+}
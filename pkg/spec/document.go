@@ -0,0 +1,309 @@
+package spec
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"shcomp2/pkg/lib"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatDSL  = "dsl"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// Schema is the JSON Schema for json and yaml documents
+//
+//go:embed shcomp2.schema.json
+var Schema string
+
+// Document is a spec as a json or yaml document, it has the same concepts as the DSL
+type Document struct {
+	Schema         string         `json:"$schema,omitempty" yaml:"$schema,omitempty"`
+	CliName        string         `json:"cli_name" yaml:"cli_name"`
+	Config         DocumentConfig `json:"config,omitempty" yaml:"config,omitempty"`
+	DocumentParser `yaml:",inline"`
+}
+
+// DocumentConfig are the cfg operations
+type DocumentConfig struct {
+	Shell                 string   `json:"shell,omitempty" yaml:"shell,omitempty"`
+	Outfile               string   `json:"outfile,omitempty" yaml:"outfile,omitempty"`
+	IncludeSource         []string `json:"include_source,omitempty" yaml:"include_source,omitempty"`
+	MergeSingleOpt        bool     `json:"merge_single_opt,omitempty" yaml:"merge_single_opt,omitempty"`
+	AutogenLang           string   `json:"autogen_lang,omitempty" yaml:"autogen_lang,omitempty"`
+	AutogenFile           string   `json:"autogen_file,omitempty" yaml:"autogen_file,omitempty"`
+	AutogenClosureCmd     string   `json:"autogen_closure_cmd,omitempty" yaml:"autogen_closure_cmd,omitempty"`
+	AutogenClosureFunc    string   `json:"autogen_closure_func,omitempty" yaml:"autogen_closure_func,omitempty"`
+	AutogenClosureSource  string   `json:"autogen_closure_source,omitempty" yaml:"autogen_closure_source,omitempty"`
+	AutogenHelpCmd        string   `json:"autogen_help_cmd,omitempty" yaml:"autogen_help_cmd,omitempty"`
+	AutogenHelpDepth      *int     `json:"autogen_help_depth,omitempty" yaml:"autogen_help_depth,omitempty"`
+	AutogenReloadTriggers []string `json:"autogen_reload_trigger,omitempty" yaml:"autogen_reload_trigger,omitempty"`
+	LogLevel              string   `json:"log_level,omitempty" yaml:"log_level,omitempty"`
+}
+
+// DocumentParser is the base parser or a subcommand
+type DocumentParser struct {
+	Options     []DocumentOption     `json:"options,omitempty" yaml:"options,omitempty"`
+	Positionals []DocumentPositional `json:"positionals,omitempty" yaml:"positionals,omitempty"`
+	Groups      []DocumentGroup      `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Subcommands []DocumentSubcommand `json:"subcommands,omitempty" yaml:"subcommands,omitempty"`
+}
+
+type DocumentSubcommand struct {
+	Name           string `json:"name" yaml:"name"`
+	Help           string `json:"help,omitempty" yaml:"help,omitempty"`
+	DocumentParser `yaml:",inline"`
+}
+
+type DocumentOption struct {
+	Name               string            `json:"name" yaml:"name"`
+	Alternatives       []string          `json:"alternatives,omitempty" yaml:"alternatives,omitempty"`
+	Help               string            `json:"help,omitempty" yaml:"help,omitempty"`
+	Choices            []string          `json:"choices,omitempty" yaml:"choices,omitempty"`
+	ChoiceDescriptions map[string]string `json:"choice_descriptions,omitempty" yaml:"choice_descriptions,omitempty"`
+	Closure            string            `json:"closure,omitempty" yaml:"closure,omitempty"`
+	Complete           string            `json:"complete,omitempty" yaml:"complete,omitempty"`
+	Globs              []string          `json:"globs,omitempty" yaml:"globs,omitempty"`
+	Nargs              DocumentNargs     `json:"nargs,omitempty" yaml:"nargs,omitempty"`
+	NargsNoSpace       bool              `json:"nargs_nospace,omitempty" yaml:"nargs_nospace,omitempty"`
+	ValueStyle         string            `json:"value_style,omitempty" yaml:"value_style,omitempty"`
+	Group              string            `json:"group,omitempty" yaml:"group,omitempty"`
+}
+
+type DocumentPositional struct {
+	Help               string            `json:"help,omitempty" yaml:"help,omitempty"`
+	Choices            []string          `json:"choices,omitempty" yaml:"choices,omitempty"`
+	ChoiceDescriptions map[string]string `json:"choice_descriptions,omitempty" yaml:"choice_descriptions,omitempty"`
+	Closure            string            `json:"closure,omitempty" yaml:"closure,omitempty"`
+	Complete           string            `json:"complete,omitempty" yaml:"complete,omitempty"`
+	Globs              []string          `json:"globs,omitempty" yaml:"globs,omitempty"`
+	Nargs              DocumentNargs     `json:"nargs,omitempty" yaml:"nargs,omitempty"`
+	NargsUnique        bool              `json:"nargs_unique,omitempty" yaml:"nargs_unique,omitempty"`
+}
+
+type DocumentGroup struct {
+	Name      string `json:"name" yaml:"name"`
+	Exclusive bool   `json:"exclusive,omitempty" yaml:"exclusive,omitempty"`
+}
+
+// DocumentNargs is a count like 2 or a string like "+", "*", "?" or "{1,3}"
+type DocumentNargs string
+
+func (n *DocumentNargs) UnmarshalJSON(data []byte) error {
+	var count int
+	if err := json.Unmarshal(data, &count); err == nil {
+		*n = DocumentNargs(strconv.Itoa(count))
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("nargs must be a number or a string")
+	}
+	*n = DocumentNargs(str)
+	return nil
+}
+
+func (n *DocumentNargs) UnmarshalYAML(value *yaml.Node) error {
+	var str string
+	if err := value.Decode(&str); err != nil {
+		return fmt.Errorf("nargs must be a number or a string")
+	}
+	*n = DocumentNargs(str)
+	return nil
+}
+
+// ParseDocument decodes a json or yaml document, unknown fields are errors
+func ParseDocument(data []byte, format string) (Document, error) {
+	var doc Document
+	switch format {
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&doc); err != nil {
+			return Document{}, fmt.Errorf("invalid json spec: %w", err)
+		}
+	case FormatYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&doc); err != nil {
+			return Document{}, fmt.Errorf("invalid yaml spec: %w", err)
+		}
+	default:
+		return Document{}, fmt.Errorf("unknown spec format %q, expected %s or %s", format, FormatJSON, FormatYAML)
+	}
+	return doc, nil
+}
+
+// FormatOf infers the format of a spec file from its extension, anything else is the DSL
+func FormatOf(specFile string) string {
+	switch strings.ToLower(filepath.Ext(specFile)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return FormatDSL
+}
+
+// ParseDocumentFile reads a json or yaml spec file, relative paths resolve against its directory
+func ParseDocumentFile(specFile string, format string) (lib.Cli, error) {
+	content, err := os.ReadFile(specFile)
+	if err != nil {
+		return lib.Cli{}, fmt.Errorf("unable to read spec file: %w", err)
+	}
+	specDir, err := filepath.Abs(filepath.Dir(specFile))
+	if err != nil {
+		return lib.Cli{}, err
+	}
+	return parseDocument(content, format, specDir)
+}
+
+// ParseDocumentBytes is ParseDocumentFile for a document that isn't in a file
+func ParseDocumentBytes(content []byte, format string) (lib.Cli, error) {
+	return parseDocument(content, format, "")
+}
+
+func parseDocument(content []byte, format string, specDir string) (lib.Cli, error) {
+	doc, err := ParseDocument(content, format)
+	if err != nil {
+		return lib.Cli{}, err
+	}
+	s, err := fromDocument(doc, specDir)
+	if err != nil {
+		return lib.Cli{}, err
+	}
+	return s.Cli()
+}
+
+// FromDocument builds the spec a document describes
+func FromDocument(doc Document) (*Spec, error) {
+	return fromDocument(doc, "")
+}
+
+func fromDocument(doc Document, specDir string) (*Spec, error) {
+	if doc.CliName == "" {
+		return nil, errors.New("cli_name is required")
+	}
+
+	s := New(doc.CliName)
+	s.specDir = specDir
+	config := doc.Config
+	configs := []struct {
+		name   string
+		values []string
+	}{
+		{"shell", []string{config.Shell}},
+		{"outfile", []string{config.Outfile}},
+		{"include_source", config.IncludeSource},
+		{"autogen_lang", []string{config.AutogenLang}},
+		{"autogen_file", []string{config.AutogenFile}},
+		{"autogen_closure_cmd", []string{config.AutogenClosureCmd}},
+		{"autogen_closure_func", []string{config.AutogenClosureFunc}},
+		{"autogen_closure_source", []string{config.AutogenClosureSource}},
+		{"autogen_help_cmd", []string{config.AutogenHelpCmd}},
+		{"autogen_reload_trigger", config.AutogenReloadTriggers},
+		{"log_level", []string{config.LogLevel}},
+	}
+	for _, cfg := range configs {
+		for _, value := range cfg.values {
+			if value != "" {
+				s.Config(cfg.name, value)
+			}
+		}
+	}
+	if config.MergeSingleOpt {
+		s.Config("merge_single_opt", "1")
+	}
+	if config.AutogenHelpDepth != nil {
+		s.Config("autogen_help_depth", strconv.Itoa(*config.AutogenHelpDepth))
+	}
+
+	addDocumentParser(s, doc.DocumentParser)
+	return s, s.Err()
+}
+
+func addDocumentParser(s *Spec, parser DocumentParser) {
+	for _, group := range parser.Groups {
+		var settings []Setting
+		if group.Exclusive {
+			settings = append(settings, Exclusive())
+		}
+		s.Group(group.Name, settings...)
+	}
+
+	for _, option := range parser.Options {
+		settings := valueSettings(option.Help, option.Choices, option.ChoiceDescriptions, option.Closure, option.Complete, option.Globs, option.Nargs)
+		if len(option.Alternatives) > 0 {
+			settings = append(settings, Alt(option.Alternatives...))
+		}
+		if option.NargsNoSpace {
+			settings = append(settings, NargsNoSpace())
+		}
+		if option.ValueStyle != "" {
+			settings = append(settings, ValueStyle(option.ValueStyle))
+		}
+		if option.Group != "" {
+			settings = append(settings, InGroup(option.Group))
+		}
+		s.Option(option.Name, settings...)
+	}
+
+	for _, positional := range parser.Positionals {
+		settings := valueSettings(positional.Help, positional.Choices, positional.ChoiceDescriptions, positional.Closure, positional.Complete, positional.Globs, positional.Nargs)
+		if positional.NargsUnique {
+			settings = append(settings, NargsUnique())
+		}
+		s.Positional(settings...)
+	}
+
+	for _, subcommand := range parser.Subcommands {
+		var settings []Setting
+		if subcommand.Help != "" {
+			settings = append(settings, Help(subcommand.Help))
+		}
+		subparser := subcommand.DocumentParser
+		s.Subcommand(subcommand.Name, func(cmd *Spec) {
+			addDocumentParser(cmd, subparser)
+		}, settings...)
+	}
+}
+
+// valueSettings are the settings options and positionals share
+func valueSettings(help string, choices []string, descriptions map[string]string, closure string, complete string, globs []string, nargs DocumentNargs) []Setting {
+	var settings []Setting
+	if help != "" {
+		settings = append(settings, Help(help))
+	}
+	if len(choices) > 0 {
+		settings = append(settings, Choices(choices...))
+		// keep the order of choices so the output is stable
+		for _, choice := range choices {
+			if description, ok := descriptions[choice]; ok {
+				settings = append(settings, Desc(choice, description))
+			}
+		}
+	}
+	if closure != "" {
+		settings = append(settings, Closure(closure))
+	}
+	if complete != "" || len(globs) > 0 {
+		// the model validates the type and globs like the parser does for the DSL
+		settings = append(settings, func(arg *argument) {
+			arg.completeType = complete
+			arg.globs = globs
+		})
+	}
+	if nargs != "" {
+		settings = append(settings, Nargs(string(nargs)))
+	}
+	return settings
+}
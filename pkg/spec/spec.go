@@ -0,0 +1,309 @@
+// Package spec builds completion specs from Go instead of formatting DSL text
+//
+//	cli, err := spec.New("tool").
+//		Option("--verbose", spec.Alt("-v"), spec.Help("print more output")).
+//		Subcommand("run", func(run *spec.Spec) {
+//			run.Positional(spec.Choices("build", "test"))
+//		}).
+//		Cli()
+//
+// Every call adds to the model through the lib constructors, which validate it like the parser validates
+// spec files and record the DSL operation of each step, and String serializes it back to the DSL.
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"shcomp2/pkg/lib"
+	"strings"
+)
+
+type Spec struct {
+	root    *Spec
+	parser  lib.CliParserName
+	specDir string
+	steps   []step
+	errs    []error
+}
+
+// step adds one operation to the model, what names it in errors
+type step struct {
+	what  string
+	build func(cli *lib.Cli) error
+}
+
+// Setting configures an option, positional, subcommand or group
+type Setting func(arg *argument)
+
+type argument struct {
+	alternatives []string
+	completeType string
+	choices      []string
+	descriptions map[string]string
+	closure      string
+	globs        []string
+	nargs        lib.CliNargs
+	help         string
+	valueStyle   string
+	group        string
+	exclusive    bool
+	err          error
+}
+
+// New starts a spec for cliName
+func New(cliName string) *Spec {
+	s := &Spec{parser: lib.DefaultParser}
+	s.root = s
+	return s.Config("cli_name", cliName)
+}
+
+// Config adds a `cfg name=value` operation
+func (s *Spec) Config(name string, value string) *Spec {
+	s.add("config "+name, func(cli *lib.Cli) error {
+		return cli.SetConfig(name, value)
+	})
+	return s
+}
+
+// Option adds an option to the current parser, name is the primary name like --verbose
+func (s *Spec) Option(name string, settings ...Setting) *Spec {
+	what := "option " + name
+	if arg, ok := s.apply(what, settings); ok {
+		s.add(what, func(cli *lib.Cli) error {
+			return cli.AddOptional(lib.CliOptional{
+				Parser:             s.parser,
+				Name:               name,
+				CompleteType:       arg.completeType,
+				ClosureName:        arg.closure,
+				Choices:            arg.choices,
+				ChoiceDescriptions: arg.descriptions,
+				Globs:              arg.globs,
+				ValueStyle:         arg.valueStyle,
+				Group:              arg.group,
+				NArgs:              arg.nargs,
+				Alternatives:       arg.alternatives,
+				Help:               arg.help,
+			})
+		})
+	}
+	return s
+}
+
+// Positional adds the next positional to the current parser
+func (s *Spec) Positional(settings ...Setting) *Spec {
+	what := "positional"
+	if arg, ok := s.apply(what, settings); ok {
+		s.add(what, func(cli *lib.Cli) error {
+			return cli.AddPositional(lib.CliPositional{
+				Parser:             s.parser,
+				CompleteType:       arg.completeType,
+				ClosureName:        arg.closure,
+				Choices:            arg.choices,
+				ChoiceDescriptions: arg.descriptions,
+				Globs:              arg.globs,
+				NArgs:              arg.nargs,
+				Help:               arg.help,
+			})
+		})
+	}
+	return s
+}
+
+// Subcommand adds a subparser, options and positionals added in build belong to it
+func (s *Spec) Subcommand(name string, build func(cmd *Spec), settings ...Setting) *Spec {
+	what := "subcommand " + name
+	if arg, ok := s.apply(what, settings); ok {
+		s.add(what, func(cli *lib.Cli) error {
+			return cli.AddParser(s.parser, name, arg.help)
+		})
+	}
+	if build != nil {
+		fqn := lib.CliParserName(name)
+		if s.parser != lib.DefaultParser {
+			fqn = s.parser + "." + fqn
+		}
+		build(&Spec{root: s.root, parser: fqn})
+	}
+	return s
+}
+
+// Group adds an option group to the current parser, use InGroup to add options to it
+func (s *Spec) Group(name string, settings ...Setting) *Spec {
+	what := "group " + name
+	if arg, ok := s.apply(what, settings); ok {
+		s.add(what, func(cli *lib.Cli) error {
+			return cli.AddGroup(s.parser, lib.CliGroup{Name: name, Exclusive: arg.exclusive})
+		})
+	}
+	return s
+}
+
+// Err is the first error from a setting, the spec itself is validated by Cli
+func (s *Spec) Err() error {
+	if len(s.root.errs) > 0 {
+		return s.root.errs[0]
+	}
+	return nil
+}
+
+// Cli builds the same model ParseOperations returns for the operations in String
+func (s *Spec) Cli() (lib.Cli, error) {
+	if err := s.Err(); err != nil {
+		return lib.Cli{}, err
+	}
+	cli, errs := s.build()
+	if len(errs) > 0 {
+		return lib.Cli{}, errors.Join(errs...)
+	}
+	return cli, nil
+}
+
+// Compile builds the completion script
+func (s *Spec) Compile() (string, error) {
+	cli, err := s.Cli()
+	if err != nil {
+		return "", err
+	}
+	return lib.CompileCli(cli)
+}
+
+// String serializes the spec to the DSL, one operation per line. Steps Cli rejects are left out
+func (s *Spec) String() string {
+	cli, _ := s.build()
+	return strings.Join(cli.Operations, "\n") + "\n"
+}
+
+// build runs every step on a new model, the model is rebuilt each time so it never changes after it's returned
+func (s *Spec) build() (lib.Cli, []error) {
+	cli := lib.NewCli(s.root.specDir)
+	var errs []error
+	for _, step := range s.root.steps {
+		if err := step.build(&cli); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", step.what, err))
+		}
+	}
+	return cli, errs
+}
+
+func (s *Spec) add(what string, build func(cli *lib.Cli) error) {
+	s.root.steps = append(s.root.steps, step{what: what, build: build})
+}
+
+// apply runs settings, it isn't ok when one of them failed
+func (s *Spec) apply(what string, settings []Setting) (argument, bool) {
+	arg := argument{}
+	ok := true
+	for _, setting := range settings {
+		setting(&arg)
+		if arg.err != nil {
+			s.root.errs = append(s.root.errs, fmt.Errorf("%s: %w", what, arg.err))
+			arg.err = nil
+			ok = false
+		}
+	}
+	return arg, ok
+}
+
+// Alt adds alternative names to an option
+func Alt(names ...string) Setting {
+	return func(arg *argument) {
+		arg.alternatives = append(arg.alternatives, names...)
+	}
+}
+
+// Choices completes one of choices, a choice with spaces is completed escaped
+func Choices(choices ...string) Setting {
+	return func(arg *argument) {
+		arg.completeType = lib.CompleteTypeChoices
+		arg.choices = choices
+	}
+}
+
+// Closure completes with a bash function from an include_source file
+func Closure(function string) Setting {
+	return func(arg *argument) {
+		arg.completeType = lib.CompleteTypeClosure
+		arg.closure = function
+	}
+}
+
+// File completes file paths, globs like *.json only keep matching files
+func File(globs ...string) Setting {
+	return func(arg *argument) {
+		arg.completeType = lib.CompleteTypeFile
+		arg.globs = globs
+	}
+}
+
+// Dir completes directory paths
+func Dir() Setting {
+	return func(arg *argument) {
+		arg.completeType = lib.CompleteTypeDir
+	}
+}
+
+// Value takes a value that can't be completed, without it an option is a flag
+func Value() Setting {
+	return func(arg *argument) {
+		arg.completeType = lib.CompleteTypeValue
+	}
+}
+
+// Nargs is the number of values, like 2, ?, * or +
+func Nargs(nargs string) Setting {
+	return func(arg *argument) {
+		arg.nargs, arg.err = lib.ParseNargs(nargs, arg.nargs)
+	}
+}
+
+// NargsUnique doesn't complete a positional choice twice
+func NargsUnique() Setting {
+	return func(arg *argument) {
+		arg.nargs.Unique = true
+	}
+}
+
+// NargsNoSpace doesn't add a space after an option value
+func NargsNoSpace() Setting {
+	return func(arg *argument) {
+		arg.nargs.NoSpace = true
+	}
+}
+
+// Help describes an option, positional or subcommand
+func Help(help string) Setting {
+	return func(arg *argument) {
+		arg.help = help
+	}
+}
+
+// Desc describes a single choice
+func Desc(choice string, description string) Setting {
+	return func(arg *argument) {
+		if arg.descriptions == nil {
+			arg.descriptions = map[string]string{}
+		}
+		arg.descriptions[choice] = description
+	}
+}
+
+// ValueStyle is how an option takes its value: lib.ValueStyleEquals, lib.ValueStyleSpace or lib.ValueStyleBoth
+func ValueStyle(style string) Setting {
+	return func(arg *argument) {
+		arg.valueStyle = style
+	}
+}
+
+// InGroup adds an option to a group added with Group
+func InGroup(group string) Setting {
+	return func(arg *argument) {
+		arg.group = group
+	}
+}
+
+// Exclusive hides the other options of a group once one is used
+func Exclusive() Setting {
+	return func(arg *argument) {
+		arg.exclusive = true
+	}
+}
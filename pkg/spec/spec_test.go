@@ -0,0 +1,282 @@
+package spec
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/suite"
+	"reflect"
+	"shcomp2/pkg/lib"
+	"shcomp2/pkg/testutil"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSuite(t *testing.T) {
+	suite.Run(t, new(Suite))
+}
+
+type Suite struct {
+	testutil.BaseSuite
+}
+
+func (suite *Suite) buildTool() *Spec {
+	return New("tool").
+		Option("--verbose", Alt("-v"), Help("print more output")).
+		Option("--mode", Choices("fast", "slow"), Desc("fast", "skip checks")).
+		Group("flavor", Exclusive()).
+		Option("--vanilla", InGroup("flavor")).
+		Option("--chocolate", InGroup("flavor")).
+		Subcommand("run", func(run *Spec) {
+			run.Option("--config", File("*.json", "*.yaml"))
+			run.Option("--tag", Value())
+			run.Positional(Choices("build", "test"))
+		}, Help("run a task")).
+		Subcommand("deploy", func(deploy *Spec) {
+			deploy.Subcommand("remote", func(remote *Spec) {
+				remote.Positional(Closure("__tool_remotes"), Nargs("*"))
+			})
+		})
+}
+
+// toolDSL is buildTool written as a spec file
+const toolDSL = `
+cfg cli_name="tool"
+opt "--verbose|-v" --help="print more output"
+opt "--mode" --choices="fast slow" --desc="fast=skip checks"
+grp "flavor" --exclusive
+opt "--vanilla" --group="flavor"
+opt "--chocolate" --group="flavor"
+psr "run" --help="run a task"
+opt -p="run" "--config" --complete="file:*.json,*.yaml"
+opt -p="run" "--tag" --complete="value"
+pos -p="run" --choices="build test"
+psr "deploy"
+psr -p="deploy" "remote"
+pos -p="deploy.remote" --closure="__tool_remotes" --nargs="*"
+`
+
+func (suite *Suite) TestString() {
+	suite.Require().Equal(strings.TrimPrefix(toolDSL, "\n"), suite.buildTool().String())
+}
+
+func (suite *Suite) TestSameModelAsDSL() {
+	built, err := suite.buildTool().Cli()
+	suite.Require().NoError(err)
+	parsed, err := lib.ParseOperations(toolDSL)
+	suite.Require().NoError(err)
+	suite.Require().Equal(parsed, built)
+	suite.Require().Equal("tool", built.CliName())
+}
+
+func (suite *Suite) TestCompile() {
+	shell, err := suite.buildTool().Compile()
+	suite.Require().NoError(err)
+	suite.RequireComplete(shell, "tool --mode ", "fast -- skip checks slow")
+	suite.RequireComplete(shell, "tool --vanilla -", "--verbose -- print more output -v        -- print more output --mode")
+	suite.RequireComplete(shell, "tool run ", "build test --config --tag")
+	suite.RequireComplete(shell, "tool run --tag ", "")
+	suite.RequireComplete(shell, "tool deploy ", "remote")
+}
+
+func (suite *Suite) TestValidation() {
+	_, err := New("tool").Option("--mode", Choices("fast\nmode")).Cli()
+	suite.Require().EqualError(err, `option --mode: choice "fast\nmode" can't be empty or contain a line break`)
+
+	_, err = New("tool").Option("--vanilla", InGroup("flavor")).Cli()
+	suite.Require().EqualError(err, `option --vanilla: unknown group "flavor", groups must be added with grp first`)
+
+	_, err = New("tool").Option("--tag", Alt("-t"), Value(), Nargs("2")).Positional(Nargs("*")).Positional().Cli()
+	suite.Require().EqualError(err, "option --tag: nargs and alternatives is not supported\n"+
+		"positional: cannot have a positional come after a indeterminant narg positional")
+}
+
+const toolJSON = `{
+	"$schema": "shcomp2.schema.json",
+	"cli_name": "tool",
+	"config": {"merge_single_opt": true},
+	"groups": [{"name": "flavor", "exclusive": true}],
+	"options": [
+		{"name": "--verbose", "alternatives": ["-v"], "help": "print more output"},
+		{"name": "--mode", "choices": ["fast", "slow"], "choice_descriptions": {"fast": "skip checks"}},
+		{"name": "--vanilla", "group": "flavor"},
+		{"name": "--color", "choices": ["auto", "never"], "value_style": "equals"}
+	],
+	"subcommands": [
+		{
+			"name": "run",
+			"help": "run a task",
+			"options": [{"name": "--config", "complete": "file", "globs": ["*.json", "*.yaml"]}],
+			"positionals": [{"choices": ["build", "test"], "nargs": 2, "nargs_unique": true}]
+		},
+		{
+			"name": "deploy",
+			"subcommands": [{"name": "remote", "positionals": [{"closure": "__tool_remotes", "nargs": "*"}]}]
+		}
+	]
+}`
+
+const toolYAML = `
+$schema: shcomp2.schema.json
+cli_name: tool
+config:
+  merge_single_opt: true
+groups:
+  - {name: flavor, exclusive: true}
+options:
+  - name: --verbose
+    alternatives: [-v]
+    help: print more output
+  - name: --mode
+    choices: [fast, slow]
+    choice_descriptions:
+      fast: skip checks
+  - {name: --vanilla, group: flavor}
+  - {name: --color, choices: [auto, never], value_style: equals}
+subcommands:
+  - name: run
+    help: run a task
+    options:
+      - {name: --config, complete: file, globs: ["*.json", "*.yaml"]}
+    positionals:
+      - {choices: [build, test], nargs: 2, nargs_unique: true}
+  - name: deploy
+    subcommands:
+      - name: remote
+        positionals:
+          - {closure: __tool_remotes, nargs: "*"}
+`
+
+func (suite *Suite) TestDocument() {
+	expected := lib.Dedent(`
+		cfg cli_name="tool"
+		cfg merge_single_opt="1"
+		grp "flavor" --exclusive
+		opt "--verbose|-v" --help="print more output"
+		opt "--mode" --choices="fast slow" --desc="fast=skip checks"
+		opt "--vanilla" --group="flavor"
+		opt "--color" --choices="auto never" --value-style="equals"
+		psr "run" --help="run a task"
+		opt -p="run" "--config" --complete="file:*.json,*.yaml"
+		pos -p="run" --choices="build test" --nargs="2" --nargs-unique
+		psr "deploy"
+		psr -p="deploy" "remote"
+		pos -p="deploy.remote" --closure="__tool_remotes" --nargs="*"
+	`)
+
+	for format, content := range map[string]string{FormatJSON: toolJSON, FormatYAML: toolYAML} {
+		doc, err := ParseDocument([]byte(content), format)
+		suite.Require().NoError(err, format)
+		s, err := FromDocument(doc)
+		suite.Require().NoError(err, format)
+		suite.Require().Equal(expected, s.String(), format)
+
+		cli, err := ParseDocumentBytes([]byte(content), format)
+		suite.Require().NoError(err, format)
+		parsed, err := lib.ParseOperations(expected)
+		suite.Require().NoError(err, format)
+		suite.Require().Equal(parsed, cli, format)
+	}
+}
+
+func (suite *Suite) TestSpacedChoices() {
+	content := `{
+		"cli_name": "tool",
+		"options": [{"name": "--region", "choices": ["us east", "us west", "it's", "eu"]}],
+		"positionals": [{"choices": ["new york", "paris"]}]
+	}`
+	expected := lib.Dedent(`
+		cfg cli_name="tool"
+		opt "--region" --choices="'us east' 'us west' \"it's\" eu"
+		pos --choices="'new york' paris"
+	`)
+
+	doc, err := ParseDocument([]byte(content), FormatJSON)
+	suite.Require().NoError(err)
+	s, err := FromDocument(doc)
+	suite.Require().NoError(err)
+	suite.Require().Equal(expected, s.String())
+
+	cli, err := ParseDocumentBytes([]byte(content), FormatJSON)
+	suite.Require().NoError(err)
+	parsed, err := lib.ParseOperations(expected)
+	suite.Require().NoError(err)
+	suite.Require().Equal(parsed, cli)
+
+	shell, err := lib.CompileCli(cli)
+	suite.Require().NoError(err)
+	suite.RequireComplete(shell, "tool --region us", `us\ east us\ west`)
+	suite.RequireComplete(shell, "tool --region us\\ e", `us\ east`)
+	suite.RequireComplete(shell, "tool --region i", `it's`)
+	suite.RequireComplete(shell, "tool new", `new\ york`)
+}
+
+func (suite *Suite) TestDocumentErrors() {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		expect  string
+	}{
+		{"unknown json field", FormatJSON, `{"cli_name": "tool", "option": []}`, `invalid json spec: json: unknown field "option"`},
+		{"unknown yaml field", FormatYAML, "cli_name: tool\noptions:\n  - {name: --mode, choice: [a]}", "invalid yaml spec: yaml: unmarshal errors:\n  line 3: field choice not found in type spec.DocumentOption"},
+		{"missing cli_name", FormatJSON, `{"options": []}`, "cli_name is required"},
+		{"bad nargs", FormatJSON, `{"cli_name": "tool", "positionals": [{"nargs": true}]}`, "invalid json spec: nargs must be a number or a string"},
+		{"bad choice", FormatYAML, "cli_name: tool\npositionals: [{choices: ['']}]", `positional: choice "" can't be empty or contain a line break`},
+		{"parse error", FormatJSON, `{"cli_name": "tool", "options": [{"name": "--mode", "complete": "dir", "globs": ["*.go"]}]}`, `option --mode: glob filters are only supported for file completion`},
+		{"unknown format", "toml", `cli_name = "tool"`, `unknown spec format "toml", expected json or yaml`},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			_, err := ParseDocumentBytes([]byte(tt.content), tt.format)
+			suite.Require().EqualError(err, tt.expect)
+		})
+	}
+}
+
+func (suite *Suite) TestFormatOf() {
+	suite.Require().Equal(FormatJSON, FormatOf("tool.json"))
+	suite.Require().Equal(FormatYAML, FormatOf("tool.yaml"))
+	suite.Require().Equal(FormatYAML, FormatOf("dir/tool.YML"))
+	suite.Require().Equal(FormatDSL, FormatOf("tool.shcomp"))
+	suite.Require().Equal(FormatDSL, FormatOf("-"))
+}
+
+// TestSchema keeps the published schema in sync with the document fields
+func (suite *Suite) TestSchema() {
+	var schema map[string]any
+	suite.Require().NoError(json.Unmarshal([]byte(Schema), &schema))
+	defs := schema["$defs"].(map[string]any)
+
+	properties := func(def map[string]any) []string {
+		var names []string
+		for name := range def["properties"].(map[string]any) {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	fields := func(value any) []string {
+		var names []string
+		var walk func(t reflect.Type)
+		walk = func(t reflect.Type) {
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				if field.Anonymous {
+					walk(field.Type)
+					continue
+				}
+				names = append(names, strings.Split(field.Tag.Get("json"), ",")[0])
+			}
+		}
+		walk(reflect.TypeOf(value))
+		sort.Strings(names)
+		return names
+	}
+
+	suite.Require().Equal(fields(Document{}), properties(schema))
+	suite.Require().Equal(fields(DocumentConfig{}), properties(defs["config"].(map[string]any)))
+	suite.Require().Equal(fields(DocumentOption{}), properties(defs["option"].(map[string]any)))
+	suite.Require().Equal(fields(DocumentPositional{}), properties(defs["positional"].(map[string]any)))
+	suite.Require().Equal(fields(DocumentGroup{}), properties(defs["group"].(map[string]any)))
+	suite.Require().Equal(fields(DocumentSubcommand{}), properties(defs["subcommand"].(map[string]any)))
+}
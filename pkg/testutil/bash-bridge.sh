@@ -1,10 +1,6 @@
+# bash-completion is deliberately not sourced, compiled scripts must work without it
 cat - <<'EOF' >/tmp/complete-withexpect-init.sh
 bind 'set bell-style none'
-if [ -f /usr/share/bash-completion/bash_completion ]; then
-  source /usr/share/bash-completion/bash_completion
-elif [ -f /etc/bash_completion ]; then
-  source /etc/bash_completion
-fi
 EOF
 
 log () {
@@ -58,7 +54,7 @@ EOF
 }
 
 complete_str() {
-  local input_line="$1"
+  local input_line="$1" insert="$2"
 
   # fixes: "compopt: not currently executing completion function"
   # allows compopt calls without giving the cmdname arg
@@ -74,7 +70,7 @@ complete_str() {
   COMP_LINE="$input_line"
   COMP_WORDS=("${comp_words[@]}")
   COMP_CWORD="$((${#comp_words[@]} - 1))"
-  COMP_POINT="$(("${#input_line}" + 0))"
+  COMP_POINT="$(LC_ALL=C; echo "${#input_line}")" # bytes like readline
 
   complete_func="$(complete -p "$cmd_name" | awk '{print $(NF-1)}')"
   __complete_str_compopt_current_cmd="$cmd_name"
@@ -82,25 +78,43 @@ complete_str() {
   __complete_str_compopt_current_cmd=""
   unset compopt
 
+  if [[ "$insert" == 1 && "${#COMPREPLY[@]}" == 1 ]]; then
+    # readline replaces the text after an open quote or the last unquoted COMP_WORDBREAKS character
+    local i char quote="" escaped=0 word_start=0
+    for ((i = 0; i < ${#input_line}; i++)); do
+      char="${input_line:i:1}"
+      if [[ "$escaped" == 1 ]]; then
+        escaped=0
+      elif [[ "$char" == "\\" && "$quote" != "'" ]]; then
+        escaped=1
+      elif [[ -n "$quote" ]]; then
+        [[ "$char" == "$quote" ]] && quote=""
+      elif [[ "$char" == [\"\'] ]]; then
+        quote="$char"
+        word_start=$((i+1))
+      elif [[ "$COMP_WORDBREAKS" == *"$char"* ]]; then
+        word_start=$((i+1))
+      fi
+    done
+    printf '%s\n' "${input_line:0:word_start}${COMPREPLY[0]}"
+    return
+  fi
   printf '%s\n' "${COMPREPLY[*]}"
 }
 
-if [ -f /usr/share/bash-completion/bash_completion ]; then
-  source /usr/share/bash-completion/bash_completion
-elif [ -f /etc/bash_completion ]; then
-  source /etc/bash_completion
-fi
-
 while IFS= read -r line; do
   IFS=$'\n' read -d "" -ra split <<< "${line//:/$'\n'}"
   test_method="${split[0]}"
   if [[ $test_method == bashfunc ]]; then
-    test_line="${line##*:}"
+    test_line="${line#*:}"
     complete_str "$test_line"
+  elif [[ $test_method == bashinsert ]]; then
+    test_line="${line#*:}"
+    complete_str "$test_line" 1
   elif [[ $test_method == expecttcl ]]; then
     test_method="${split[0]}"
     test_file="${split[1]}"
-    test_line="${line##*:*:}"
+    test_line="${line#*:*:}"
     complete_str_with_expect "$test_line" "$test_file"
   else
     >&2 echo "unknown test method: $test_method"
@@ -3,6 +3,7 @@ package testutil
 import (
 	"bytes"
 	_ "embed"
+	"flag"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/require"
@@ -32,13 +33,17 @@ var (
 
 var loggerCleanup func()
 
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
 type BaseSuite struct {
 	suite.Suite
 	tmpdir string
 }
 
 func (suite *BaseSuite) SetupSuite() {
-	loggerCleanup = lib.SetupLogger()
+	var err error
+	loggerCleanup, err = lib.SetupLogger(false, "")
+	suite.Require().NoError(err)
 	log.Printf("RUNNING TESTS")
 }
 
@@ -88,6 +93,16 @@ func (suite *BaseSuite) RequireComplete(shell, cmdStr string, expected string) {
 	}, expected)
 }
 
+// RequireCompleteInserted checks the line readline makes when it inserts the only candidate, readline only
+// replaces the text after the last COMP_WORDBREAKS character like the 5432 of --host db:5432
+func (suite *BaseSuite) RequireCompleteInserted(shell, cmdStr string, expected string) {
+	suite.requireCompleteHelper(completeRequest{
+		shell:      shell,
+		testMethod: "bashinsert",
+		cmdStr:     cmdStr,
+	}, expected)
+}
+
 func (suite *BaseSuite) requireCompleteHelper(request completeRequest, expected string) {
 	suite.T().Helper()
 	t := suite.T()
@@ -142,6 +157,100 @@ func (suite *BaseSuite) requireCompleteHelper(request completeRequest, expected
 	}
 }
 
+// RequireGolden compares compiled output with a golden file. Run tests with -update to rewrite golden files
+func (suite *BaseSuite) RequireGolden(goldenFile string, actual string) {
+	suite.T().Helper()
+	if *updateGolden {
+		check(os.MkdirAll(filepath.Dir(goldenFile), 0755))
+		check(os.WriteFile(goldenFile, []byte(actual), 0644))
+	}
+	expected, err := os.ReadFile(goldenFile)
+	suite.Require().NoError(err, "missing golden file, run tests with -update")
+	suite.Require().Equal(string(expected), actual, "compiled output does not match "+goldenFile)
+}
+
+// volatileVariable are variables bash itself changes while completing, they aren't state a script leaves behind
+var volatileVariable = regexp.MustCompile(`^declare -\S+ (BASH_\w+|BASHPID|COMP_\w+|COMPREPLY|EPOCHREALTIME|EPOCHSECONDS|FUNCNAME|HISTCMD|LINENO|PIPESTATUS|RANDOM|SECONDS|SRANDOM|_|__stateless_\w+)(=|$)`)
+
+// statelessScript snapshots the shell before sourcing, after sourcing and after completing every line
+const statelessScript = `
+__stateless_snapshot () { echo "@@$1"; declare -p; declare -F; shopt -p; set +o; }
+__stateless_file="$2" __stateless_cli="$3" __stateless_line="" __stateless_function=""
+__stateless_lines=("${@:4}")
+COMP_LINE="" COMP_POINT=0 COMP_WORDS=() COMP_CWORD=0 COMPREPLY=()
+source "$1"
+__stateless_snapshot before
+source "$__stateless_file"
+__stateless_snapshot sourced
+[[ "$(complete -p "$__stateless_cli")" =~ -F\ ([^ ]+) ]] && __stateless_function="${BASH_REMATCH[1]}"
+echo "@@function $__stateless_function"
+for __stateless_line in "${__stateless_lines[@]}"; do
+  COMP_LINE="$__stateless_line" COMP_POINT="${#__stateless_line}"
+  "$__stateless_function" "$__stateless_cli" "" "" >/dev/null 2>&1
+done
+__stateless_snapshot completed
+`
+
+// RequireStateless sources a compiled script after setup in a clean bash and completes each line with the
+// function it registers for cliName. Sourcing may only add functions namespaced for the cli, completing may
+// not change any variable, function or shell option. The state is compared with declare -p, declare -F and
+// shopt -p so setup can define the user's own functions and variables that must survive
+func (suite *BaseSuite) RequireStateless(setup string, shell string, cliName string, cmdStrs ...string) {
+	suite.T().Helper()
+	setupFile := suite.CreateFile("stateless-setup.bash", setup)
+	file := suite.CreateFile("stateless.bash", shell)
+	args := append([]string{"-c", statelessScript, "stateless", setupFile, file, cliName}, cmdStrs...)
+	out, err := exec.Command("bash", args...).CombinedOutput()
+	suite.Require().NoError(err, string(out))
+
+	snapshots := map[string][]string{}
+	var section, function string
+	for _, line := range strings.Split(string(out), "\n") {
+		if name, found := strings.CutPrefix(line, "@@function "); found {
+			function = name
+		} else if name, found := strings.CutPrefix(line, "@@"); found {
+			section = name
+		} else if section != "" && line != "" && !volatileVariable.MatchString(line) {
+			snapshots[section] = append(snapshots[section], line)
+		}
+	}
+	suite.Require().NotEmpty(function, "%s didn't register a completion for %s", shell, cliName)
+	namespace := function[strings.LastIndex(function, "_"):]
+
+	added, removed := diffLines(snapshots["before"], snapshots["sourced"])
+	for _, line := range added {
+		if !strings.HasPrefix(line, "declare -f __shcomp2_v2_") || !strings.HasSuffix(line, namespace) {
+			suite.Fail("sourcing the script added global state that isn't namespaced for "+cliName, line)
+		}
+	}
+	suite.Empty(removed, "sourcing the script removed global state")
+	added, removed = diffLines(snapshots["sourced"], snapshots["completed"])
+	suite.Empty(added, "completing left global state behind")
+	suite.Empty(removed, "completing removed global state")
+}
+
+// diffLines are the lines only in after and the lines only in before
+func diffLines(before []string, after []string) (added []string, removed []string) {
+	count := map[string]int{}
+	for _, line := range before {
+		count[line]++
+	}
+	for _, line := range after {
+		if count[line] > 0 {
+			count[line]--
+		} else {
+			added = append(added, line)
+		}
+	}
+	for _, line := range before {
+		if count[line] > 0 {
+			count[line]--
+			removed = append(removed, line)
+		}
+	}
+	return added, removed
+}
+
 func (suite *BaseSuite) CreateFile(filename string, contents string, rest ...any) (filepath string) {
 	if suite.tmpdir == "" {
 		suite.tmpdir = suite.T().TempDir()
@@ -158,7 +267,11 @@ func (suite *BaseSuite) CreateFile(filename string, contents string, rest ...any
 
 	filepath = path.Join(suite.tmpdir, filename)
 	contents = lib.Dedent(contents)
-	err := os.WriteFile(filepath, []byte(contents), fs.FileMode(permission))
+	err := os.MkdirAll(path.Dir(filepath), 0755)
+	if err != nil {
+		panic(err)
+	}
+	err = os.WriteFile(filepath, []byte(contents), fs.FileMode(permission))
 	if err != nil {
 		panic(err)
 	}
@@ -209,7 +322,7 @@ type completeRequest struct {
 }
 
 func (c completeRequest) serialize() string {
-	if c.testMethod == "bashfunc" {
+	if c.testMethod == "bashfunc" || c.testMethod == "bashinsert" {
 		return strings.Join([]string{c.testMethod, c.cmdStr}, ":") + "\n"
 	} else if c.testMethod == "expecttcl" {
 		return strings.Join([]string{c.testMethod, c.file, c.cmdStr}, ":") + "\n"
@@ -0,0 +1,374 @@
+#!/usr/bin/env bash
+# todo: add version metadata
+# todo: add gotype to the top without effecting it somehow
+
+# cfg shell=bash
+# cfg cli_name=testcli
+# opt --verbose|-v --help="Print more output"
+# opt --mode --choices="fast slow" --desc=fast="Go fast"
+# psr run --help="Run a task"
+# pos -p=run --choices="all mine" --desc=all="Every task" --help="Tasks to run"
+
+# splits the line up to the cursor into words like the shell does, the words keep their quotes and escapes
+# as typed. =, : and @ don't break words so --opt=value, host:port and user@host stay one word.
+# current_word and previous_word have the quotes and escapes removed so they compare with candidates,
+# readline only replaces the text after an open quote so "o completes to "one. current_word_break is
+# current_word up to its last unquoted COMP_WORDBREAKS character, readline doesn't replace it either
+__shcomp2_v2_comp_words_testcli () {
+  # COMP_POINT counts bytes
+  local LC_ALL=C
+  local line="${COMP_LINE:0:COMP_POINT}" word="" plain="" previous_plain="" plain_break="" char quote="" escaped=0 in_word=0 i
+  words=()
+  for ((i = 0; i < ${#line}; i++)); do
+    char="${line:i:1}"
+    if [[ "$escaped" == 1 ]]; then
+      escaped=0
+      # in double quotes a backslash only escapes ", \, $ and `
+      if [[ "$quote" == '"' && "$char" != [\"\\\$\`] ]]; then
+        plain+="\\"
+      fi
+      plain+="$char"
+    elif [[ "$char" == "\\" && "$quote" != "'" ]]; then
+      escaped=1
+    elif [[ -n "$quote" ]]; then
+      if [[ "$char" == "$quote" ]]; then
+        quote=""
+      else
+        plain+="$char"
+      fi
+    elif [[ "$char" == [\"\'] ]]; then
+      quote="$char"
+    elif [[ "$char" == [[:space:]] ]]; then
+      if [[ "$in_word" == 1 ]]; then
+        words+=("$word")
+        previous_plain="$plain"
+        word=""
+        plain=""
+        plain_break=""
+        in_word=0
+      fi
+      continue
+    else
+      plain+="$char"
+      if [[ "$COMP_WORDBREAKS" == *"$char"* ]]; then
+        plain_break="$plain"
+      fi
+    fi
+    word+="$char"
+    in_word=1
+  done
+  words+=("$word")
+  cword_index=$((${#words[@]} - 1))
+  current_word="$plain"
+  current_word_break="$plain_break"
+  previous_word=""
+  if ((cword_index > 0)); then
+    previous_word="$previous_plain"
+  fi
+}
+
+__shcomp2_v2_autocomplete_testcli () {
+  local -A subparsers=([__base_parser__]="baseparser" [run]="run")
+
+  # options
+  local -A _option_baseparser_name_map=(["--mode"]="1" ["--verbose"]="1" ["-v"]="1")
+  local -a _option_baseparser_names=("--verbose" "-v" "--mode")
+  local -A _option_baseparser_data=(
+    ["__alternatives__,--verbose,0"]="-v" ["__alternatives__,-v,0"]="--verbose"
+    ["__type__,--mode"]="choices" ["__value__,--mode"]="fast slow"
+  )
+  local -A _description_baseparser=(
+    ["--mode,fast"]="Go fast" ["--verbose"]="Print more output"
+    ["-v"]="Print more output" ["1,run"]="Run a task"
+  )
+  local -A _option_run_name_map=()
+  local -a _option_run_names=()
+  local -A _option_run_data=()
+  local -A _description_run=(["1,all"]="Every task")
+
+  # arguments
+
+  local _positional_baseparser_1_type="choices"
+  local _positional_baseparser_1_choices=("run")
+  local _positional_run_1_type="choices"
+  local _positional_run_1_choices=("all" "mine")
+
+  # shellcheck disable=SC2034
+  local cword_index previous_word words current_word current_word_break
+  __shcomp2_v2_comp_words_testcli
+
+  # default add space after completion
+  compopt +o nospace
+
+  local -A used_options=()
+  local carg_index=0 real_carg_index
+  local i=0 # skip first word
+  local word subparser_candidate parser
+  local current_parser=""
+  local current_parser_clean="baseparser"
+  local completing_option_val=0
+  while true; do
+    i=$((i+1))
+    if [[ -z "${words[$i]+set}" ]]; then break; fi
+    word="${words[$i]}"
+
+    # argument
+    if [[ ! "$word" =~ ^'-' && "$i" -le "$cword_index" ]]; then
+      carg_index=$((carg_index+1))
+
+    fi
+
+    # option
+    local -n option_data="_option_${current_parser_clean}_data"
+    local -n option_map="_option_${current_parser_clean}_name_map"
+    if [[ "$word" == -*=* ]]; then
+      word="${word%%=*}" # --opt=value
+    fi
+    if [[ "$word" =~ ^'-' && "$i" -le "$cword_index" ]]; then
+      if [[ ${#word} == 2 || -n ${option_map[$word]} ]]; then
+        local reached_max=1
+        if [[ -v "option_data[__narg_max__,$word]" ]]; then
+          if [[ "${option_data["__narg_max__,$word"]}" == "inf" ]]; then
+            reached_max=0
+          else
+            option_data["__narg_count__,$word"]=$((option_data["__narg_count__,$word"]+1))
+            if [[ "${option_data["__narg_count__,$word"]}" -lt "${option_data["__narg_max__,$word"]}" ]]; then
+              reached_max=0
+              option_data[__narg_maxed__,$word]=1
+            fi
+          fi
+        fi
+        # todo: only add code if alternatives code is required
+        local limit=99
+        local idx=0
+        local alt
+        while true; do
+          alt="${option_data["__alternatives__,$word,$idx"]}"
+          if [[ $idx -ge $limit || -z "$alt" ]]; then break; fi
+          idx=$((idx+1))
+          option_map["$alt"]=0
+        done
+        option_data["__alternatives__,__used__,$word"]=1
+        if ((i<=cword_index)); then
+          if [[ "$reached_max" == 1 ]]; then
+            used_options["$word"]=1
+          fi
+        fi
+      elif [[ ${#word} -ge 2 || $cword_index == $i ]]; then
+        # count option usage in merged opts
+        local opt char
+        while IFS='' read -r -d '' -n 1 char; do
+          if [[ $char != $'\n' && $char != '-' ]]; then
+            opt="-$char"
+            local reached_max=1
+            if [[ -n ${option_data[__narg_max__,$opt]} ]]; then
+              if [[ "${option_data["__narg_max__,$opt"]}" == "inf" ]]; then
+                reached_max=0
+              else
+                option_data["__narg_count__,$opt"]=$((option_data["__narg_count__,$opt"]+1))
+                if [[ "${option_data["__narg_count__,$opt"]}" -lt "${option_data["__narg_max__,$opt"]}" ]]; then
+                  reached_max=0
+                fi
+              fi
+            fi
+            # todo: only add code if alternatives code is required
+            local limit=99
+            local idx=0
+            local alt
+            while true; do
+              alt="${option_data["__alternatives__,$opt,$idx"]}"
+              if [[ $idx -ge $limit || -z "$alt" ]]; then break; fi
+              idx=$((idx+1))
+              option_map["$alt"]=0
+            done
+            option_data["__alternatives__,__used__,$opt"]=1
+            if [[ "$reached_max" == 1 ]]; then
+              used_options["$opt"]=1
+              option_map["$opt"]=0
+            fi
+          fi
+        done <<< "$word"
+      fi
+    fi
+
+    # current parser
+    # todo: need a way to ensure subparser match isn't an arg or option value
+    # todo: optimize based on "subparsers are invoked based on the value of the first positional argument..."
+    if [[ "$i" -le "$cword_index" ]]; then
+      if [[ -n "${current_parser}" ]]; then
+        subparser_candidate="${current_parser},${word}"
+      else
+        subparser_candidate="${word}"
+      fi
+      if [[ -n "$subparser_candidate" && -n "${subparsers[$subparser_candidate]}" ]]; then
+        current_parser="$subparser_candidate"
+        current_parser_clean="${subparsers[$subparser_candidate]}"
+        carg_index=0 # reset
+      fi
+    fi
+  done
+
+  if [[ "$carg_index" == 0 ]]; then
+    carg_index=1  # todo: this is a hack. figure out how to properly get positional number based on line
+  fi
+
+  if [[ -z "$current_parser" ]]; then
+    parser="baseparser"
+  else
+    parser="$current_parser_clean"
+  fi
+
+  # closures are called with the word being completed as $1 and the words before it from the cli name on
+  # as $2 and up, they put their candidates in COMPREPLY. shcomp2_CURRENT_WORD is the word too for closures
+  # written before the arguments, it's local so it doesn't outlive the completion
+  local shcomp2_CURRENT_WORD
+  local choices_all=()
+  local path_candidates=()
+  local quote_candidates=0
+  local description_prefix=""
+  local candidate_prefix=""
+  local -n option_complete_data="_option_${parser}_data"
+  local option_name="" value_word="$current_word"
+  if [[ "$current_word" == -*=* ]]; then
+    # --option=value
+    option_name="${current_word%%=*}"
+    value_word="${current_word#*=}"
+    if [[ "${option_complete_data[__value_style__,$option_name]}" == "space" ]]; then
+      option_name=""
+    fi
+  elif [[ "${option_complete_data[__value_style__,$previous_word]}" != "equals" ]]; then
+    # --option value
+    option_name="$previous_word"
+  fi
+  if [[ -n "$option_name" && -v "option_complete_data[__type__,$option_name]" ]]; then
+    # --option values
+    # solve edge cases with mistaking positionals with options
+    local -a option_choices=()
+    description_prefix="$option_name,"
+    case "${option_complete_data[__type__,$option_name]}" in
+      "choices")
+        # spaces in a choice are escaped
+        IFS=' ' read -a option_choices <<< "${option_complete_data[__value__,$option_name]}"
+        quote_candidates=1
+        ;;
+      "closure")
+        local option_closure="${option_complete_data[__value__,$option_name]}"
+        COMPREPLY=()
+        shcomp2_CURRENT_WORD="$value_word"
+        "$option_closure" "$value_word" "${words[@]:0:cword_index}"
+        option_choices=("${COMPREPLY[@]}")
+        COMPREPLY=()
+        ;;
+    esac
+    # compgen -W would expand $, ` and globs in the candidates, they are compared as they are
+    local candidate
+    COMPREPLY=()
+    for candidate in "${option_choices[@]}"; do
+      if [[ "$candidate" == "$value_word"* ]]; then
+        COMPREPLY+=("$candidate")
+      fi
+    done
+    if [[ "$value_word" != "$current_word" ]]; then
+      # the candidates are values, the word is --option=value
+      candidate_prefix="$option_name="
+    fi
+  else
+    # positionals
+    description_prefix="$carg_index,"
+    local -n positional_complete_type="_positional_${parser}_${carg_index}_type"
+    case "$positional_complete_type" in
+      "choices")
+        local -n positional_choices="_positional_${parser}_${carg_index}_choices"
+        local -n positional_used="_positional_${parser}_${carg_index}_used"
+        if [[ "${#positional_used[@]}" -gt 0 ]]; then
+          local choice
+          for choice in "${positional_choices[@]}"; do
+            if [[ -z "${positional_used[$choice]}" ]]; then
+              choices_all+=("$choice")
+            fi
+          done
+        else
+          choices_all+=("${positional_choices[@]}")
+        fi
+        quote_candidates=1
+        ;;
+      "closure")
+        local -n positional_closure="_positional_${parser}_${carg_index}_closure"
+        COMPREPLY=()
+        shcomp2_CURRENT_WORD="$current_word"
+        "$positional_closure" "$current_word" "${words[@]:0:cword_index}"
+        choices_all+=("${COMPREPLY[@]}")
+        COMPREPLY=()
+        ;;
+    esac
+
+    local -n options_name_map="_option_${parser}_name_map"
+    local -n options_name_seq="_option_${parser}_names"
+    local -n options_name_dat="_option_${parser}_data"
+
+    # options
+    local name
+    for name in "${options_name_seq[@]}"; do
+
+      if [[ "${options_name_map[$name]}" == 1 && "${used_options[$name]}" != 1 ]]; then
+        if [[ "${options_name_dat[__value_style__,$name]}" == "equals" ]]; then
+          choices_all+=("$name=")
+        else
+          choices_all+=("$name")
+        fi
+      fi
+
+    done
+
+    local candidate
+    COMPREPLY=()
+    for candidate in "${choices_all[@]}"; do
+      if [[ "$candidate" == "$current_word"* ]]; then
+        COMPREPLY+=("$candidate")
+      fi
+    done
+    if [[ "${#COMPREPLY[@]}" == 1 && "${COMPREPLY[0]}" == *= ]]; then
+      compopt -o nospace # --option= is followed by its value
+    fi
+  fi
+
+  # readline inserts candidates as they are, choices with spaces are escaped so they stay one word
+  local -a candidates_unquoted=("${COMPREPLY[@]}")
+  local candidate_index
+  if [[ -n "$candidate_prefix" || -n "$current_word_break" ]]; then
+    # readline keeps the word up to its last break like db: of db:5432 and only inserts the rest
+    for candidate_index in "${!COMPREPLY[@]}"; do
+      candidate="$candidate_prefix${COMPREPLY[$candidate_index]}"
+      COMPREPLY[$candidate_index]="${candidate#"$current_word_break"}"
+    done
+  fi
+  if [[ "$quote_candidates" == 1 ]]; then
+    for candidate_index in "${!COMPREPLY[@]}"; do
+      if [[ "${COMPREPLY[$candidate_index]}" == *[[:space:]]* ]]; then
+        printf -v "COMPREPLY[$candidate_index]" '%q' "${COMPREPLY[$candidate_index]}"
+      fi
+    done
+  fi
+
+  # descriptions are only shown when listing candidates, a single candidate is inserted as is
+  local -n descriptions="_description_${parser}"
+  if [[ "${#COMPREPLY[@]}" -gt 1 && "${#descriptions[@]}" -gt 0 && "${#path_candidates[@]}" == 0 ]]; then
+    local candidate description candidate_width=0
+    for candidate in "${COMPREPLY[@]}"; do
+      if [[ "${#candidate}" -gt "$candidate_width" ]]; then
+        candidate_width="${#candidate}"
+      fi
+    done
+    for candidate_index in "${!COMPREPLY[@]}"; do
+      candidate="${candidates_unquoted[$candidate_index]}"
+      description="${descriptions[$description_prefix$candidate]:-${descriptions[${candidate%=}]}}"
+      if [[ -n "$description" ]]; then
+        printf -v "COMPREPLY[$candidate_index]" '%-*s -- %s' "$candidate_width" "${COMPREPLY[$candidate_index]}" "$description"
+      fi
+    done
+  fi
+}
+
+# todo: add closure validation when sourcing
+complete -F __shcomp2_v2_autocomplete_testcli -o nospace "testcli"
+
@@ -0,0 +1,75 @@
+# cfg shell=fish
+# cfg cli_name=testcli
+# opt --config --complete=file:*.json,*.yaml
+# opt --out --complete=dir
+# pos --complete=file
+
+# succeeds when the positional being completed is within [from, to] for the parser at depth,
+# the values of options are skipped
+function __shcomp2_v2_fish_testcli_positional -a depth from to
+    set -l value_options --config --out
+    set -l value_counts 1 1
+    set -l index 1
+    set -l skip 0
+    for token in (commandline -opc)[2..-1]
+        if test $skip -gt 0
+            set skip (math $skip - 1)
+        else if contains -- $token $value_options
+            set skip $value_counts[(contains -i -- $token $value_options)]
+        else if not string match -q -- '-*' $token
+            set index (math $index + 1)
+        end
+    end
+    set index (math $index - $depth)
+    test $index -ge $from
+    and begin
+        test "$to" = inf
+        or test $index -le $to
+    end
+end
+
+# print choices not already used on the command line
+function __shcomp2_v2_fish_testcli_unique
+    set -l tokens (commandline -opc)
+    for choice in $argv
+        if not contains -- $choice $tokens
+            echo $choice
+        end
+    end
+end
+
+# closures are fish functions called with the current word as $argv[1] and the words before it as $argv[2..]
+# that print one value per line
+function __shcomp2_v2_fish_testcli_closure -a closure
+    if functions -q $closure
+        $closure (commandline -ct) (commandline -opc)
+    end
+end
+
+# print paths for file and dir completion, comma separated globs only filter files
+function __shcomp2_v2_fish_testcli_paths -a complete_type globs
+    set -l token (commandline -ct)
+    if test "$complete_type" = dir
+        __fish_complete_directories $token
+        return
+    end
+    for candidate in (__fish_complete_path $token)
+        set -l path (string split -f1 \t -- $candidate)
+        if test -z "$globs"; or test -d "$path"
+            echo $candidate
+            continue
+        end
+        for glob in (string split , -- $globs)
+            if string match -q -- $glob $path
+                echo $candidate
+                break
+            end
+        end
+    end
+end
+
+complete -c testcli -e
+complete -c testcli -f
+complete -c testcli -n 'not __fish_contains_opt config' -l config -r -a '(__shcomp2_v2_fish_testcli_paths file \\*.json,\\*.yaml)'
+complete -c testcli -n 'not __fish_contains_opt out' -l out -r -a '(__shcomp2_v2_fish_testcli_paths dir)'
+complete -c testcli -n '__shcomp2_v2_fish_testcli_positional 0 1 1' -a '(__shcomp2_v2_fish_testcli_paths file)'
@@ -0,0 +1,60 @@
+# cfg shell=fish
+# cfg cli_name=testcli
+# opt "--help"
+# pos -p="sub-cmd" --choices="c1 c2 c3"
+# opt -p="sub-cmd" "--awesome"
+# opt -p="sub-b" --help-b
+# opt -p="sub-b.sub-c" --help-c
+# psr standalone
+
+# succeeds when the positional being completed is within [from, to] for the parser at depth,
+# the values of options are skipped
+function __shcomp2_v2_fish_testcli_positional -a depth from to
+    set -l value_options 
+    set -l value_counts 
+    set -l index 1
+    set -l skip 0
+    for token in (commandline -opc)[2..-1]
+        if test $skip -gt 0
+            set skip (math $skip - 1)
+        else if contains -- $token $value_options
+            set skip $value_counts[(contains -i -- $token $value_options)]
+        else if not string match -q -- '-*' $token
+            set index (math $index + 1)
+        end
+    end
+    set index (math $index - $depth)
+    test $index -ge $from
+    and begin
+        test "$to" = inf
+        or test $index -le $to
+    end
+end
+
+# print choices not already used on the command line
+function __shcomp2_v2_fish_testcli_unique
+    set -l tokens (commandline -opc)
+    for choice in $argv
+        if not contains -- $choice $tokens
+            echo $choice
+        end
+    end
+end
+
+# closures are fish functions called with the current word as $argv[1] and the words before it as $argv[2..]
+# that print one value per line
+function __shcomp2_v2_fish_testcli_closure -a closure
+    if functions -q $closure
+        $closure (commandline -ct) (commandline -opc)
+    end
+end
+
+complete -c testcli -e
+complete -c testcli -f
+complete -c testcli -n 'not __fish_seen_subcommand_from sub-cmd sub-b standalone; and not __fish_contains_opt help' -l help
+complete -c testcli -n 'not __fish_seen_subcommand_from sub-cmd sub-b standalone; and __shcomp2_v2_fish_testcli_positional 0 1 1' -a 'sub-cmd sub-b standalone'
+complete -c testcli -n '__fish_seen_subcommand_from sub-cmd; and not __fish_contains_opt awesome' -l awesome
+complete -c testcli -n '__fish_seen_subcommand_from sub-cmd; and __shcomp2_v2_fish_testcli_positional 1 1 1' -a 'c1 c2 c3'
+complete -c testcli -n '__fish_seen_subcommand_from sub-b; and not __fish_seen_subcommand_from sub-c; and not __fish_contains_opt help-b' -l help-b
+complete -c testcli -n '__fish_seen_subcommand_from sub-b; and not __fish_seen_subcommand_from sub-c; and __shcomp2_v2_fish_testcli_positional 1 1 1' -a 'sub-c'
+complete -c testcli -n '__fish_seen_subcommand_from sub-b; and __fish_seen_subcommand_from sub-c; and not __fish_contains_opt help-c' -l help-c